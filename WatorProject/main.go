@@ -3,17 +3,482 @@
 
 package main
 
-import "wator/Wator"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wator/viewer"
+	"wator/wator"
+)
+
+const usage = `Usage: wator <command> [flags]
+
+Commands:
+  run        open a window and run the simulation
+  headless   run the simulation without a window and print population counts
+  bench      benchmark the simulation across thread counts and save an XLSX report
+
+Run "wator <command> -h" to list the flags for a command.
+`
 
 /**
  * @brief Main function to run the Wator simulation.
  *
- * This function initializes and starts the simulation of the Wator model.
+ * This function reads the subcommand from the command line and hands the
+ * remaining arguments to it.
  *
  * @return int Returns 0 on successful completion.
  */
 func main() {
 
-	Wator.RunSimulation()
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "wator:", err)
+		}
+		os.Exit(2)
+	}
+
+}
+
+/**
+ * @brief Dispatches the command line to the matching subcommand.
+ *
+ * @param args The command line arguments, excluding the program name.
+ * @param stdout Where normal output is written.
+ * @param stderr Where usage and flag errors are written.
+ * @return nil on success, or the error that stopped the command.
+ */
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return errors.New("no command given")
+	}
+
+	switch args[0] {
+	case "run":
+		return runCommand(args[1:], stderr)
+	case "headless":
+		return headlessCommand(args[1:], stdout, stderr)
+	case "bench":
+		return benchCommand(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+/**
+ * @brief Implements `wator run`, which opens the simulation window.
+ *
+ * @param args The arguments following the subcommand name.
+ * @param stderr Where usage and flag errors are written.
+ * @return nil when the window is closed, or the error that stopped it.
+ */
+func runCommand(args []string, stderr io.Writer) error {
+	fs := newFlagSet("run", stderr)
+	cfg := addConfigFlags(fs)
+	threads := fs.Int("threads", 1, "number of threads used to update the grid")
+	load := fs.String("load", "", "snapshot to start from instead of a new grid")
+	rate := fs.Float64("rate", Viewer.DefaultRate, "steps per second, or 0 to run as fast as possible")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *threads < 1 {
+		return fmt.Errorf("threads must be at least 1, got %d", *threads)
+	}
+	if *rate < 0 || math.IsNaN(*rate) {
+		return fmt.Errorf("rate must not be negative, got %g", *rate)
+	}
+	if err := settleConfig(fs, cfg, *load, stderr); err != nil {
+		return err
+	}
+
+	sim, err := newSimulation(*cfg, *threads, *load)
+	if err != nil {
+		return err
+	}
+	return Viewer.RunGame(sim, *rate)
+}
+
+/**
+ * @brief Implements `wator headless`, which runs without a window.
+ *
+ * @param args The arguments following the subcommand name.
+ * @param stdout Where the population counts are written.
+ * @param stderr Where usage and flag errors are written.
+ * @return nil on success, or the error that stopped the run.
+ */
+func headlessCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("headless", stderr)
+	cfg := addConfigFlags(fs)
+	steps := fs.Int("steps", 100, "number of simulation steps to run")
+	threads := fs.Int("threads", 1, "number of threads used to update the grid")
+	every := fs.Int("every", 1, "print the population counts every N steps")
+	csvOut := fs.String("csv", "", "file to save the per-step statistics to as CSV")
+	jsonOut := fs.String("json", "", "file to save the per-step statistics to as JSON")
+	load := fs.String("load", "", "snapshot to start from instead of a new grid")
+	save := fs.String("save", "", "file to save a snapshot of the final grid to (.json for JSON, otherwise binary)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *steps < 0 {
+		return fmt.Errorf("steps must not be negative, got %d", *steps)
+	}
+	if *threads < 1 {
+		return fmt.Errorf("threads must be at least 1, got %d", *threads)
+	}
+	if err := settleConfig(fs, cfg, *load, stderr); err != nil {
+		return err
+	}
+
+	sim, err := newSimulation(*cfg, *threads, *load)
+	if err != nil {
+		return err
+	}
+	Wator.RunHeadless(sim, *steps, *every, stdout)
+
+	if *save != "" {
+		if err := Wator.SaveSnapshot(*save, sim.Snapshot()); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Snapshot saved to %s\n", *save)
+	}
+
+	stats := sim.Stats()
+	if *csvOut != "" {
+		if err := writeFile(*csvOut, stats.WriteCSV); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Statistics saved to %s\n", *csvOut)
+	}
+	if *jsonOut != "" {
+		if err := writeFile(*jsonOut, stats.WriteJSON); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Statistics saved to %s\n", *jsonOut)
+	}
+	return nil
+}
+
+/**
+ * @brief Creates a simulation from the flags or from a snapshot file.
+ *
+ * When a snapshot is given, its parameters and step count replace the
+ * ones from the flags, so the run continues exactly where it was saved.
+ *
+ * @param cfg The configuration parsed from the flags.
+ * @param threads The number of threads used for each step.
+ * @param load The snapshot to load, or "" for a new grid.
+ * @return The simulation, or the error from loading or validating it.
+ */
+func newSimulation(cfg Wator.Config, threads int, load string) (*Wator.Simulation, error) {
+	if load == "" {
+		return Wator.NewSimulation(cfg, threads)
+	}
+
+	snap, err := Wator.LoadSnapshot(load)
+	if err != nil {
+		return nil, err
+	}
+	return Wator.NewSimulationFromSnapshot(snap, threads)
+}
+
+/**
+ * @brief Creates a file and fills it using the given write function.
+ *
+ * @param path The file to create, replacing any existing file.
+ * @param write The function that writes the contents.
+ * @return nil on success, or the first error from creating, writing or
+ *         closing the file.
+ */
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+/**
+ * @brief Implements `wator bench`, which benchmarks thread counts.
+ *
+ * @param args The arguments following the subcommand name.
+ * @param stdout Where progress messages are written.
+ * @param stderr Where usage and flag errors are written.
+ * @return nil once the report is saved, or the error that stopped it.
+ */
+func benchCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("bench", stderr)
+	cfg := addConfigFlags(fs)
+	opts := Wator.DefaultBenchmarkOptions()
+	fs.IntVar(&opts.Steps, "steps", opts.Steps, "number of simulation steps per benchmark run")
+	fs.IntVar(&opts.Warmups, "warmup", opts.Warmups, "unmeasured runs before measuring each thread count")
+	fs.IntVar(&opts.Repetitions, "reps", opts.Repetitions, "measured runs per thread count")
+	threadList := fs.String("threads", "1,2,4,8", "comma separated thread counts to benchmark")
+	out := fs.String("out", "benchmark_results.xlsx", "file to save the benchmark results to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	threadCounts, err := parseThreadCounts(*threadList)
+	if err != nil {
+		return err
+	}
+	opts.ThreadCounts = threadCounts
+	if err := settleConfig(fs, cfg, "", stderr); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Benchmarking Wator Simulation (seed %d):\n", cfg.Seed)
+	report, err := Wator.BenchmarkSimulationToXLSX(*cfg, opts, *out)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "%8s %12s %12s %10s %10s %12s\n", "threads", "median (s)", "stddev (s)", "speedup", "efficiency", "steps/s")
+	for _, result := range report.Results {
+		fmt.Fprintf(stdout, "%8d %12.6f %12.6f %10.2f %10.2f %12.1f\n", result.Threads, result.Median,
+			result.StdDev, result.Speedup, result.Efficiency, result.StepsPerSecond)
+	}
+	fmt.Fprintf(stdout, "Results saved to %s\n", *out)
+	return nil
+}
+
+/**
+ * @brief Creates a flag set for a subcommand that reports its own errors.
+ *
+ * @param name The name of the subcommand.
+ * @param stderr Where usage and flag errors are written.
+ * @return The new flag set.
+ */
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("wator "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+/**
+ * @brief Registers a flag for every simulation parameter.
+ *
+ * Each flag defaults to the value in Wator.DefaultConfig, so only the
+ * parameters being changed need to be given. The map and start grid are
+ * only loaded while parsing; settleConfig sets the grid size from them
+ * once every flag has been read, so the order of the flags does not
+ * matter.
+ *
+ * @param fs The flag set to register the flags on.
+ * @return The configuration the flags are parsed into.
+ */
+func addConfigFlags(fs *flag.FlagSet) *Wator.Config {
+	cfg := Wator.DefaultConfig()
+	fs.IntVar(&cfg.ScreenWidth, "width", cfg.ScreenWidth, "maximum window width in pixels")
+	fs.IntVar(&cfg.ScreenHeight, "height", cfg.ScreenHeight, "maximum window height in pixels")
+	fs.IntVar(&cfg.GridWidth, "grid-width", cfg.GridWidth, "number of cells across the grid")
+	fs.IntVar(&cfg.GridHeight, "grid-height", cfg.GridHeight, "number of cells down the grid")
+	fs.Func("grid", "number of cells along each side of a square grid", func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		cfg.GridWidth, cfg.GridHeight = n, n
+		return nil
+	})
+	fs.IntVar(&cfg.InitialFishCount, "fish", cfg.InitialFishCount, "initial number of fish")
+	fs.IntVar(&cfg.InitialSharkCount, "sharks", cfg.InitialSharkCount, "initial number of sharks")
+	fs.IntVar(&cfg.FishBreedTime, "fish-breed", cfg.FishBreedTime, "steps before a fish can breed")
+	fs.IntVar(&cfg.SharkBreedTime, "shark-breed", cfg.SharkBreedTime, "steps before a shark can breed")
+	fs.IntVar(&cfg.SharkStarveTime, "shark-starve", cfg.SharkStarveTime, "steps a shark survives without eating")
+	fs.BoolVar(&cfg.SharkEnergyModel, "shark-energy", cfg.SharkEnergyModel, "use shark energy instead of the starvation counter")
+	fs.IntVar(&cfg.SharkInitialEnergy, "shark-initial-energy", cfg.SharkInitialEnergy, "energy a shark starts with under -shark-energy")
+	fs.IntVar(&cfg.SharkEnergyPerFish, "shark-energy-per-fish", cfg.SharkEnergyPerFish, "energy a shark gains per fish eaten under -shark-energy")
+	fs.IntVar(&cfg.SharkMaxEnergy, "shark-max-energy", cfg.SharkMaxEnergy, "most energy a shark can hold under -shark-energy")
+	fs.IntVar(&cfg.SharkMoveCost, "shark-move-cost", cfg.SharkMoveCost, "energy a shark spends each time it moves under -shark-energy")
+	fs.Func("food-web", `JSON file listing the species of a food web, or "example" for plankton, fish, sharks and orcas`, func(value string) error {
+		if value == "example" {
+			cfg.FoodWeb = Wator.ExampleFoodWeb()
+			return nil
+		}
+		web, err := Wator.LoadFoodWeb(value)
+		cfg.FoodWeb = web
+		return err
+	})
+	environment := func() *Wator.Environment {
+		if cfg.Environment == nil {
+			cfg.Environment = &Wator.Environment{NutrientRegrowth: Wator.DefaultNutrientRegrowth}
+		}
+		return cfg.Environment
+	}
+	fs.Func("nutrients", "image or CSV map of the nutrient each cell holds, white being one fish meal", func(value string) error {
+		layer, err := Wator.LoadLayer(value, 0, 1)
+		environment().Nutrients = layer
+		return err
+	})
+	fs.Func("nutrient-regrowth", fmt.Sprintf("nutrient a cell regains each step under -nutrients (default %g)", Wator.DefaultNutrientRegrowth), func(value string) error {
+		regrowth, err := strconv.ParseFloat(value, 64)
+		environment().NutrientRegrowth = regrowth
+		return err
+	})
+	fs.Func("temperature", fmt.Sprintf("image or CSV map of the water temperature in °C, white being %d °C", Wator.MaxImageTemperature), func(value string) error {
+		layer, err := Wator.LoadLayer(value, 0, Wator.MaxImageTemperature)
+		environment().Temperature = layer
+		return err
+	})
+	fs.Func("currents", "image or CSV map of the current, with green pushing down and red pushing right", func(value string) error {
+		x, y, err := Wator.LoadCurrents(value)
+		environment().CurrentX, environment().CurrentY = x, y
+		return err
+	})
+	fs.Func("map", "image of land (sand or white), water (black or blue), fish (green) and sharks (red) that sets the grid size", func(value string) error {
+		m, err := Wator.LoadWorldMap(value)
+		cfg.Map = m
+		return err
+	})
+	fs.Func("start-from", "snapshot whose land and entities, counters and ages included, start the run and set the grid size", func(value string) error {
+		snap, err := Wator.LoadSnapshot(value)
+		cfg.Placement.Start = &snap.Grid
+		return err
+	})
+	fs.TextVar(&cfg.Placement.Kind, "placement", cfg.Placement.Kind, "how the initial entities are spread: uniform, clustered, stripes, image, density or snapshot (set by -start-from)")
+	fs.IntVar(&cfg.Placement.Clusters, "clusters", cfg.Placement.Clusters, "blobs of each species under -placement clustered")
+	fs.Float64Var(&cfg.Placement.Spread, "cluster-spread", cfg.Placement.Spread, "standard deviation of a blob in cells under -placement clustered")
+	fs.IntVar(&cfg.Placement.StripeWidth, "stripe-width", cfg.Placement.StripeWidth, "rows in each band under -placement stripes")
+	fs.Func("density-map", "image or CSV map of where entities start under -placement image, black cells staying empty", func(value string) error {
+		layer, err := Wator.LoadLayer(value, 0, 1)
+		cfg.Placement.Density = layer
+		return err
+	})
+	fs.TextVar(&cfg.Boundary, "boundary", cfg.Boundary, "what happens at the grid edges: torus, walls or reflective")
+	fs.TextVar(&cfg.Neighbourhood, "neighbourhood", cfg.Neighbourhood, "cells an entity can reach: von-neumann, moore or hex")
+	fs.IntVar(&cfg.Radius, "radius", cfg.Radius, "how many cells away the neighbourhood reaches")
+	fs.Int64Var(&cfg.Seed, "seed", 0, "random seed for a reproducible run (picked from the clock and printed if not given)")
+	return &cfg
+}
 
+/**
+ * @brief Finishes the configuration once the flags have been parsed.
+ *
+ * A run loaded from a snapshot takes every parameter from it, so giving
+ * any simulation flag as well is an error rather than being ignored.
+ * Otherwise the world map or start grid sets the grid size, which must
+ * agree with any size flags given, and pickSeed picks a seed if none was
+ * given.
+ *
+ * @param fs The parsed flag set, holding the flags of addConfigFlags.
+ * @param cfg The configuration parsed from the flags.
+ * @param load The snapshot the run is loaded from, or "" for a new grid.
+ * @param stderr Where a picked seed is printed.
+ * @return nil on success, or an error if the flags conflict.
+ */
+func settleConfig(fs *flag.FlagSet, cfg *Wator.Config, load string, stderr io.Writer) error {
+	if load != "" {
+		configFlags := flag.NewFlagSet("config", flag.ContinueOnError)
+		addConfigFlags(configFlags)
+		var conflicts []string
+		fs.Visit(func(f *flag.Flag) {
+			if configFlags.Lookup(f.Name) != nil {
+				conflicts = append(conflicts, "-"+f.Name)
+			}
+		})
+		if len(conflicts) > 0 {
+			return fmt.Errorf("%s cannot be used with -load, which takes the simulation from the snapshot",
+				strings.Join(conflicts, ", "))
+		}
+		return nil
+	}
+
+	given := givenFlags(fs)
+	var layout string
+	var rows, cols int
+	switch {
+	case given["map"] && given["start-from"]:
+		return errors.New("-map and -start-from cannot be used together, as both set the land")
+	case given["start-from"]:
+		layout, rows, cols = "-start-from", cfg.Placement.Start.Rows, cfg.Placement.Start.Cols
+	case given["map"]:
+		layout, rows, cols = "-map", cfg.Map.Rows, cfg.Map.Cols
+	}
+	if layout != "" {
+		if (given["grid"] || given["grid-width"]) && cfg.GridWidth != cols ||
+			(given["grid"] || given["grid-height"]) && cfg.GridHeight != rows {
+			return fmt.Errorf("the grid size flags give %dx%d, but %s is %dx%d", cfg.GridWidth, cfg.GridHeight, layout, cols, rows)
+		}
+		cfg.GridWidth, cfg.GridHeight = cols, rows
+	}
+	if given["start-from"] {
+		cfg.StartFrom(*cfg.Placement.Start)
+	}
+
+	pickSeed(fs, cfg, stderr)
+	return nil
+}
+
+/**
+ * @brief Lists the flags given on the command line.
+ *
+ * @param fs The parsed flag set.
+ * @return The names of the flags that were set, leaving out those left at
+ *         their defaults.
+ */
+func givenFlags(fs *flag.FlagSet) map[string]bool {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	return given
+}
+
+/**
+ * @brief Picks a seed from the clock if the seed flag was not given.
+ *
+ * Whether the flag was given is taken from the flag set rather than the
+ * seed's value, so every seed, zero included, can be asked for again. A
+ * picked seed is printed, so the run can be repeated.
+ *
+ * @param fs The parsed flag set, holding the flags of addConfigFlags.
+ * @param cfg The configuration parsed from the flags.
+ * @param stderr Where a picked seed is printed.
+ */
+func pickSeed(fs *flag.FlagSet, cfg *Wator.Config, stderr io.Writer) {
+	if !givenFlags(fs)["seed"] {
+		cfg.Seed = time.Now().UnixNano()
+		fmt.Fprintf(stderr, "Using seed %d (repeat the run with --seed %d)\n", cfg.Seed, cfg.Seed)
+	}
+}
+
+/**
+ * @brief Parses a comma separated list of thread counts such as "1,2,4,8".
+ *
+ * @param list The list to parse.
+ * @return The thread counts, or an error if any entry is not a positive integer.
+ */
+func parseThreadCounts(list string) ([]int, error) {
+	var counts []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid thread count %q: must be a positive integer", field)
+		}
+		counts = append(counts, n)
+	}
+	if len(counts) == 0 {
+		return nil, errors.New("no thread counts given")
+	}
+	return counts, nil
 }
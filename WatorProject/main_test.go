@@ -0,0 +1,222 @@
+// Seán Rourke
+// C00251168
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"wator/wator"
+)
+
+func TestParseThreadCounts(t *testing.T) {
+	tests := map[string][]int{
+		"1,2,4,8": {1, 2, 4, 8},
+		" 3 , 1 ": {3, 1},
+		"2,,4,":   {2, 4},
+		"":        nil,
+		",":       nil,
+		"1,0":     nil,
+		"1,-2":    nil,
+		"four":    nil,
+		"1,2.5,4": nil,
+		"16":      {16},
+	}
+	for list, want := range tests {
+		got, err := parseThreadCounts(list)
+		if want == nil {
+			if err == nil {
+				t.Errorf("%q: got %v, want an error", list, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, want) {
+			t.Errorf("%q: got %v, %v, want %v", list, got, err, want)
+		}
+	}
+}
+
+func TestPickSeed(t *testing.T) {
+	for _, args := range [][]string{{"-seed", "0"}, {"-seed", "42"}} {
+		fs := newFlagSet("test", &bytes.Buffer{})
+		cfg := addConfigFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		want := cfg.Seed
+		var stderr bytes.Buffer
+		pickSeed(fs, cfg, &stderr)
+		if cfg.Seed != want || stderr.Len() != 0 {
+			t.Errorf("%v: seed became %d and printed %q", args, cfg.Seed, stderr.String())
+		}
+	}
+
+	fs := newFlagSet("test", &bytes.Buffer{})
+	cfg := addConfigFlags(fs)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	pickSeed(fs, cfg, &stderr)
+	if cfg.Seed == 0 || !strings.Contains(stderr.String(), "--seed") {
+		t.Errorf("no seed flag: seed %d, printed %q", cfg.Seed, stderr.String())
+	}
+}
+
+func TestRunDispatchesCommands(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+		stdout  string
+	}{
+		{args: nil, wantErr: "no command"},
+		{args: []string{"swim"}, wantErr: "unknown command"},
+		{args: []string{"help"}, stdout: "Commands:"},
+		{args: []string{"headless", "-grid", "10", "-fish", "5", "-sharks", "2", "-steps", "2", "-seed", "1"}, stdout: "fish"},
+		{args: []string{"headless", "-steps", "-1"}, wantErr: "steps"},
+		{args: []string{"headless", "-no-such-flag"}, wantErr: "not defined"},
+		{args: []string{"bench", "-threads", "0"}, wantErr: "invalid thread count"},
+		{args: []string{"run", "-threads", "0"}, wantErr: "threads"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		err := run(tt.args, &stdout, &stderr)
+		switch {
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%v: error = %v, want one about %q", tt.args, err, tt.wantErr)
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%v: %v", tt.args, err)
+		case !strings.Contains(stdout.String(), tt.stdout):
+			t.Errorf("%v: output %q does not mention %q", tt.args, stdout.String(), tt.stdout)
+		}
+	}
+}
+
+// writeMap saves a 4x3 world map of water with one cell of land
+func writeMap(t *testing.T) string {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for py := 0; py < 3; py++ {
+		for px := 0; px < 4; px++ {
+			img.Set(px, py, color.Black)
+		}
+	}
+	img.Set(1, 1, color.White)
+	path := filepath.Join(t.TempDir(), "map.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMapSizeDoesNotDependOnFlagOrder(t *testing.T) {
+	path := writeMap(t)
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{args: []string{"-map", path}},
+		{args: []string{"-grid-width", "4", "-map", path}},
+		{args: []string{"-map", path, "-grid-width", "4"}},
+		{args: []string{"-grid", "50", "-map", path}, wantErr: true},
+		{args: []string{"-map", path, "-grid", "50"}, wantErr: true},
+		{args: []string{"-map", path, "-grid-height", "4"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		fs := newFlagSet("test", &bytes.Buffer{})
+		cfg := addConfigFlags(fs)
+		if err := fs.Parse(append(tt.args, "-seed", "1")); err != nil {
+			t.Fatal(err)
+		}
+		err := settleConfig(fs, cfg, "", &bytes.Buffer{})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected a conflict with the 4x3 map", tt.args)
+			}
+			continue
+		}
+		if err != nil || cfg.GridWidth != 4 || cfg.GridHeight != 3 {
+			t.Errorf("%v: grid %dx%d, error %v, want 4x3", tt.args, cfg.GridWidth, cfg.GridHeight, err)
+		}
+	}
+}
+
+// saveRun saves a snapshot of a short headless run on a 10x10 grid
+func saveRun(t *testing.T) string {
+	snapshot := filepath.Join(t.TempDir(), "run.snap")
+	var stdout bytes.Buffer
+	if err := run([]string{"headless", "-grid", "10", "-fish", "5", "-sharks", "2", "-steps", "1", "-seed", "1", "-save", snapshot}, &stdout, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	return snapshot
+}
+
+func TestStartFromSetsTheGrid(t *testing.T) {
+	snapshot := saveRun(t)
+	mapPath := writeMap(t)
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{args: []string{"-start-from", snapshot}},
+		{args: []string{"-start-from", snapshot, "-grid", "10"}},
+		{args: []string{"-placement", "uniform", "-start-from", snapshot}},
+		{args: []string{"-grid", "20", "-start-from", snapshot}, wantErr: true},
+		{args: []string{"-start-from", snapshot, "-map", mapPath}, wantErr: true},
+	}
+	for _, tt := range tests {
+		fs := newFlagSet("test", &bytes.Buffer{})
+		cfg := addConfigFlags(fs)
+		if err := fs.Parse(append(tt.args, "-seed", "1")); err != nil {
+			t.Fatal(err)
+		}
+		err := settleConfig(fs, cfg, "", &bytes.Buffer{})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected a conflict", tt.args)
+			}
+			continue
+		}
+		if err != nil || cfg.GridWidth != 10 || cfg.GridHeight != 10 || cfg.Placement.Kind != Wator.FromSnapshot {
+			t.Errorf("%v: grid %dx%d, placement %v, error %v", tt.args, cfg.GridWidth, cfg.GridHeight, cfg.Placement.Kind, err)
+		}
+	}
+}
+
+func TestLoadRejectsSimulationFlags(t *testing.T) {
+	snapshot := saveRun(t)
+	var stdout bytes.Buffer
+
+	if err := run([]string{"headless", "-load", snapshot, "-steps", "1"}, &stdout, &stdout); err != nil {
+		t.Errorf("loading alone: %v", err)
+	}
+	for _, flags := range [][]string{{"-fish", "9"}, {"-seed", "3"}, {"-grid", "20", "-shark-breed", "4"}} {
+		args := append([]string{"headless", "-load", snapshot}, flags...)
+		err := run(args, &stdout, &stdout)
+		if err == nil || !strings.Contains(err.Error(), flags[0]) {
+			t.Errorf("%v: error = %v, want one naming %s", flags, err, flags[0])
+		}
+	}
+
+	fs := newFlagSet("test", &bytes.Buffer{})
+	threads := fs.Int("threads", 1, "")
+	cfg := addConfigFlags(fs)
+	if err := fs.Parse([]string{"-threads", "4"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := settleConfig(fs, cfg, snapshot, &bytes.Buffer{}); err != nil || *threads != 4 {
+		t.Errorf("-threads with -load: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Viewer
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"wator/wator"
+)
+
+const (
+	// historyLength is the number of steps shown by the population graph
+	// and the phase plot
+	historyLength = 300
+	// hudMargin is the gap in pixels between the panels and the edges of
+	// the window
+	hudMargin = 6
+	// Size in pixels of a character of the debug font
+	charWidth, lineHeight = 6, 16
+	// smallestHUDScreen is the smallest window, in pixels along each side,
+	// that the graph and the phase plot are drawn in
+	smallestHUDScreen = 160
+)
+
+// Colours of the HUD panels
+var (
+	panelColour = color.RGBA{0, 0, 0, 170}
+	axisColour  = color.RGBA{90, 90, 90, 255}
+	phaseColour = color.RGBA{200, 200, 200, 255}
+)
+
+/**
+ * @brief Draws the HUD over the grid.
+ *
+ * The HUD is a panel of text in the top left corner showing the step, the
+ * rate, the population of each species, the steps and frames per second
+ * and the thread count; a scrolling graph of the populations over the last
+ * historyLength steps in the bottom left corner; and a phase plot of the
+ * sharks against the fish over the same steps in the bottom right corner.
+ * The graph and the phase plot are left out of very small windows.
+ *
+ * @param screen The image to draw onto.
+ * @param f The frame being drawn.
+ */
+func (g *Game) drawHUD(screen *ebiten.Image, f *frame) {
+	g.drawText(screen, g.hudText(f), 0, 0)
+
+	width, height := screen.Bounds().Dx(), screen.Bounds().Dy()
+	if width < smallestHUDScreen || height < smallestHUDScreen {
+		return
+	}
+	history := f.history
+	panel := float32(height / 5)
+	top := float32(height-hudMargin) - panel
+	phaseSide := min(panel, float32(width)/3)
+	graphWidth := float32(width-3*hudMargin) - phaseSide
+	g.drawPopulationGraph(screen, f.rules, history, hudMargin, top, graphWidth, panel)
+	if len(g.types) >= 2 {
+		g.drawPhasePlot(screen, history, float32(width-hudMargin)-phaseSide, top, phaseSide, panel)
+	}
+}
+
+/**
+ * @brief Returns the text of the HUD.
+ *
+ * @param f The frame being drawn.
+ * @return The lines of text, joined by newlines.
+ */
+func (g *Game) hudText(f *frame) string {
+	rate := "unthrottled"
+	if !math.IsInf(g.rate, 1) {
+		rate = fmt.Sprintf("%g steps/s", g.rate)
+	}
+	state := ""
+	if g.paused {
+		state = "  paused"
+	}
+	if g.zoom > 1 {
+		state += fmt.Sprintf("  zoom %.1fx", g.zoom)
+	}
+
+	counts := make([]string, len(f.populations))
+	for i, p := range f.populations {
+		counts[i] = fmt.Sprintf("%s %d", p.Name, p.Count)
+	}
+
+	lines := []string{
+		fmt.Sprintf("step %d  %s%s", f.step, rate, state),
+		strings.Join(counts, "  "),
+		fmt.Sprintf("steps/s %.1f  FPS %.1f  threads %d", f.stepRate, ebiten.ActualFPS(), g.threads),
+	}
+	if g.paused {
+		lines = append(lines, fmt.Sprintf("brush: %s (0-9)  N: step  space: run", g.brushName(f.rules)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+/**
+ * @brief Draws lines of text on a dark panel.
+ *
+ * @param screen The image to draw onto.
+ * @param text The text, with lines separated by newlines.
+ * @param x The x-coordinate of the top left corner of the panel.
+ * @param y The y-coordinate of the top left corner of the panel.
+ */
+func (g *Game) drawText(screen *ebiten.Image, text string, x, y int) {
+	width, height := textSize(text)
+	vector.DrawFilledRect(screen, float32(x), float32(y), float32(width), float32(height), panelColour, false)
+	ebitenutil.DebugPrintAt(screen, text, x+2, y)
+}
+
+/**
+ * @brief Returns the size of the panel drawText draws for some text.
+ *
+ * @param text The text, with lines separated by newlines.
+ * @return The width and height of the panel in pixels.
+ */
+func textSize(text string) (width, height int) {
+	lines := strings.Split(text, "\n")
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, len(line))
+	}
+	return longest*charWidth + 4, len(lines) * lineHeight
+}
+
+/**
+ * @brief Draws the population of each species over the recent steps.
+ *
+ * Each species is a line in its own colour. The x axis always spans
+ * historyLength steps, so the lines grow from the left until the history
+ * is full and then scroll, and the y axis runs from zero to the largest
+ * population shown, which is printed in the corner.
+ *
+ * @param screen The image to draw onto.
+ * @param rules The species of the simulation.
+ * @param history The statistics of the recent steps, oldest first.
+ * @param x The x-coordinate of the left of the panel.
+ * @param y The y-coordinate of the top of the panel.
+ * @param width The width of the panel.
+ * @param height The height of the panel.
+ */
+func (g *Game) drawPopulationGraph(screen *ebiten.Image, rules *Wator.Rules, history Wator.Statistics,
+	x, y, width, height float32) {
+	vector.DrawFilledRect(screen, x, y, width, height, panelColour, false)
+	vector.StrokeLine(screen, x, y+height-1, x+width, y+height-1, 1, axisColour, false)
+
+	counts := make([][]int, len(history))
+	highest := 1
+	for j, entry := range history {
+		counts[j] = populationCounts(entry)
+		for _, count := range counts[j] {
+			highest = max(highest, count)
+		}
+	}
+	stepWidth := width / (historyLength - 1)
+	for i, t := range rules.Types() {
+		colour := speciesColour(rules, t)
+		for j := 1; j < len(history); j++ {
+			if i >= len(counts[j-1]) || i >= len(counts[j]) {
+				continue
+			}
+			y0 := y + height - 1 - float32(counts[j-1][i])/float32(highest)*(height-2)
+			y1 := y + height - 1 - float32(counts[j][i])/float32(highest)*(height-2)
+			vector.StrokeLine(screen, x+float32(j-1)*stepWidth, y0, x+float32(j)*stepWidth, y1, 1, colour, true)
+		}
+	}
+	ebitenutil.DebugPrintAt(screen, fmt.Sprint(highest), int(x)+2, int(y))
+}
+
+/**
+ * @brief Draws the number of sharks against the number of fish over the
+ *        recent steps.
+ *
+ * The fish run along the x axis and the sharks up the y axis, each scaled
+ * to the range shown, so the predator-prey cycle appears as a loop. The
+ * latest step is marked with a dot. In a food web the first two species
+ * take the place of the fish and sharks.
+ *
+ * @param screen The image to draw onto.
+ * @param history The statistics of the recent steps, oldest first.
+ * @param x The x-coordinate of the left of the panel.
+ * @param y The y-coordinate of the top of the panel.
+ * @param width The width of the panel.
+ * @param height The height of the panel.
+ */
+func (g *Game) drawPhasePlot(screen *ebiten.Image, history Wator.Statistics, x, y, width, height float32) {
+	vector.DrawFilledRect(screen, x, y, width, height, panelColour, false)
+	if len(history) == 0 {
+		return
+	}
+
+	lowFish, highFish := math.MaxInt, 0
+	lowSharks, highSharks := math.MaxInt, 0
+	for _, entry := range history {
+		lowFish, highFish = min(lowFish, entry.Fish), max(highFish, entry.Fish)
+		lowSharks, highSharks = min(lowSharks, entry.Sharks), max(highSharks, entry.Sharks)
+	}
+	point := func(entry Wator.StepStats) (float32, float32) {
+		fx := float32(entry.Fish-lowFish) / float32(max(highFish-lowFish, 1))
+		fy := float32(entry.Sharks-lowSharks) / float32(max(highSharks-lowSharks, 1))
+		return x + 2 + fx*(width-4), y + height - 2 - fy*(height-4)
+	}
+
+	for j := 1; j < len(history); j++ {
+		x0, y0 := point(history[j-1])
+		x1, y1 := point(history[j])
+		vector.StrokeLine(screen, x0, y0, x1, y1, 1, phaseColour, true)
+	}
+	latestX, latestY := point(history[len(history)-1])
+	vector.DrawFilledCircle(screen, latestX, latestY, 2.5, color.White, true)
+}
+
+/**
+ * @brief Returns the population of every species in a step.
+ *
+ * @param entry The statistics of the step.
+ * @return The counts in the order the species were registered.
+ */
+func populationCounts(entry Wator.StepStats) []int {
+	if entry.Populations == nil {
+		return []int{entry.Fish, entry.Sharks}
+	}
+	counts := make([]int, len(entry.Populations))
+	for i, p := range entry.Populations {
+		counts[i] = p.Count
+	}
+	return counts
+}
+
+/**
+ * @brief Returns the colour a species is drawn in.
+ *
+ * The colour does not depend on any entity's counters, whichever rules
+ * the sharks follow: fish and sharks are drawn at their full brightness,
+ * as a fish ready to breed and a well fed shark are.
+ *
+ * @param rules The species of the simulation.
+ * @param t The cell type of the species.
+ * @return The colour of the species.
+ */
+func speciesColour(rules *Wator.Rules, t Wator.CellType) color.RGBA {
+	if species, ok := rules.Species(t).(Wator.Coloured); ok {
+		return species.Colour()
+	}
+	switch t {
+	case Wator.Fish:
+		return fishShade(1)
+	case Wator.Shark:
+		return sharkShade(1)
+	case Wator.Land:
+		return landColour
+	}
+	return otherColour
+}
@@ -0,0 +1,382 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Viewer
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"wator/wator"
+)
+
+const (
+	// commandQueue is the number of commands the window can send before it
+	// waits for the simulation to take them
+	commandQueue = 64
+	// maxLag is how far the simulation can fall behind its rate before it
+	// stops trying to catch up, so a slow stretch is not followed by a burst
+	maxLag = 250 * time.Millisecond
+	// rateWindow is how often the measured step rate is updated
+	rateWindow = 500 * time.Millisecond
+)
+
+// frame is a copy of everything the window draws from the simulation, taken
+// between steps. A published frame is never changed, so it can be drawn
+// while the simulation carries on with the next step.
+type frame struct {
+	grid Wator.Grid
+	// nutrients is the nutrient left in each cell, or nil without a
+	// nutrient map
+	nutrients   []float32
+	rules       *Wator.Rules
+	step        int
+	populations []Wator.SpeciesPopulation
+	// history is the statistics of the last historyLength steps
+	history Wator.Statistics
+	// stepRate is the number of steps taken a second, measured over the
+	// last rateWindow
+	stepRate float64
+}
+
+// runner steps a simulation on its own goroutine at a chosen rate, so a slow
+// step never holds up drawing and the simulation is not tied to the frame
+// rate. After a step it copies the simulation into the back frame and swaps
+// it with the front frame that the window draws; the window reads the front
+// frame under the lock and changes the simulation only through commands,
+// which the goroutine runs between steps.
+type runner struct {
+	sim      *Wator.Simulation
+	commands chan func()
+	quit     chan struct{}
+	done     chan struct{}
+	stopping sync.Once
+
+	mu    sync.Mutex
+	front *frame
+	err   error // the first error from a command
+	// drawn is set once the front frame has been read, so the goroutine
+	// only copies a new frame when the last one has been seen, and seen
+	// tells the goroutine when it is set
+	drawn atomic.Bool
+	seen  chan struct{}
+	back  *frame
+
+	// Owned by the goroutine
+	paused   bool
+	rate     float64   // steps a second, infinite to run as fast as it can
+	since    time.Time // when the current rate began
+	taken    int       // steps taken at the current rate
+	counted  int       // steps taken since counting began
+	counting time.Time // when the step rate was last measured
+	stepRate float64
+	stale    bool // whether a step has been taken since the last frame
+}
+
+/**
+ * @brief Creates a runner for a simulation and publishes its first frame.
+ *
+ * The goroutine does not run until start is called, and the simulation
+ * must not be used by anything else from then on. Only the statistics the
+ * HUD graphs are kept, so a long run does not grow without bound.
+ *
+ * @param sim The simulation to step.
+ * @param rate The number of steps to take a second, or +Inf to run as fast
+ *        as the simulation can.
+ * @return The new runner.
+ */
+func newRunner(sim *Wator.Simulation, rate float64) *runner {
+	sim.KeepStats(historyLength)
+	r := &runner{
+		sim:      sim,
+		commands: make(chan func(), commandQueue),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+		seen:     make(chan struct{}, 1),
+		front:    &frame{},
+		back:     &frame{},
+		rate:     rate,
+	}
+	r.publish(true)
+	return r
+}
+
+/**
+ * @brief Starts stepping the simulation on its own goroutine.
+ */
+func (r *runner) start() {
+	r.since, r.taken = time.Now(), 0
+	r.counting = r.since
+	go r.run()
+}
+
+/**
+ * @brief Stops the goroutine and waits for it to finish its step.
+ *
+ * Stopping a runner again does nothing.
+ */
+func (r *runner) stop() {
+	r.stopping.Do(func() {
+		close(r.quit)
+		<-r.done
+	})
+}
+
+/**
+ * @brief Steps the simulation and runs commands until stopped.
+ */
+func (r *runner) run() {
+	defer close(r.done)
+	for {
+		if r.paused {
+			select {
+			case <-r.quit:
+				return
+			case command := <-r.commands:
+				r.obey(command)
+			case <-r.seen:
+				r.catchUp()
+			}
+			continue
+		}
+
+		wait := r.untilDue()
+		if wait <= 0 {
+			// Commands still come first, without waiting for them
+			select {
+			case <-r.quit:
+				return
+			case command := <-r.commands:
+				r.obey(command)
+			default:
+				r.step()
+			}
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-r.quit:
+			timer.Stop()
+			return
+		case command := <-r.commands:
+			timer.Stop()
+			r.obey(command)
+		case <-r.seen:
+			timer.Stop()
+			r.catchUp()
+		case <-timer.C:
+		}
+	}
+}
+
+/**
+ * @brief Returns how long until the next step is due at the current rate.
+ *
+ * A simulation that has fallen more than maxLag behind starts counting
+ * again from now, so it runs as fast as it can rather than in bursts.
+ *
+ * @return The time to wait, which is zero or less when a step is due.
+ */
+func (r *runner) untilDue() time.Duration {
+	if math.IsInf(r.rate, 1) {
+		return 0
+	}
+	due := r.since.Add(time.Duration(float64(r.taken) / r.rate * float64(time.Second)))
+	wait := time.Until(due)
+	if wait < -maxLag {
+		r.since, r.taken = time.Now(), 0
+		return 0
+	}
+	return wait
+}
+
+/**
+ * @brief Takes one step and publishes it if the last frame has been drawn.
+ */
+func (r *runner) step() {
+	r.sim.Step()
+	r.taken++
+	r.counted++
+	if elapsed := time.Since(r.counting); elapsed >= rateWindow {
+		r.stepRate = float64(r.counted) / elapsed.Seconds()
+		r.counting, r.counted = time.Now(), 0
+	}
+	r.publish(false)
+}
+
+/**
+ * @brief Publishes the last step if it was taken while the frame before it
+ *        was still waiting to be drawn.
+ */
+func (r *runner) catchUp() {
+	if r.stale {
+		r.publish(false)
+	}
+}
+
+/**
+ * @brief Runs a command from the window and publishes its effect.
+ *
+ * @param command The command.
+ */
+func (r *runner) obey(command func()) {
+	command()
+	r.since, r.taken = time.Now(), 0
+	if r.paused {
+		r.stepRate, r.counted = 0, 0
+	}
+	r.counting = time.Now()
+	r.publish(true)
+}
+
+/**
+ * @brief Copies the simulation into the back frame and swaps it to the
+ *        front.
+ *
+ * @param force Whether to publish even if the front frame has not been
+ *        drawn yet, as after a command, when there may be no step to
+ *        publish the change with.
+ */
+func (r *runner) publish(force bool) {
+	if !force && !r.drawn.Load() {
+		r.stale = true
+		return
+	}
+	r.stale = false
+
+	f := r.back
+	view := r.sim.View()
+	if f.grid.Rows != view.Rows || f.grid.Cols != view.Cols {
+		f.grid = view.Clone()
+	} else {
+		Wator.CopyGrid(f.grid, view)
+	}
+	if nutrients := r.sim.Nutrients(); nutrients != nil {
+		f.nutrients = append(f.nutrients[:0], nutrients...)
+	} else {
+		f.nutrients = nil
+	}
+	f.rules = r.sim.Rules()
+	f.step = r.sim.StepCount()
+	f.populations = r.sim.Populations()
+	f.history = r.sim.RecentStats(historyLength)
+	f.stepRate = r.stepRate
+
+	r.mu.Lock()
+	r.front, r.back = r.back, r.front
+	r.drawn.Store(false)
+	r.mu.Unlock()
+}
+
+/**
+ * @brief Returns the latest frame, which must be released before the
+ *        simulation can publish another.
+ *
+ * @return The frame.
+ */
+func (r *runner) acquire() *frame {
+	r.mu.Lock()
+	if !r.drawn.Swap(true) {
+		select {
+		case r.seen <- struct{}{}:
+		default:
+		}
+	}
+	return r.front
+}
+
+/**
+ * @brief Releases the frame returned by acquire.
+ */
+func (r *runner) release() {
+	r.mu.Unlock()
+}
+
+/**
+ * @brief Sends a command to be run on the simulation's goroutine between
+ *        steps.
+ *
+ * @param command The command, which may use the simulation and the
+ *        runner's own state.
+ */
+func (r *runner) send(command func()) {
+	r.commands <- command
+}
+
+/**
+ * @brief Records the error of a failed command.
+ *
+ * @param err The error, or nil.
+ */
+func (r *runner) fail(err error) {
+	if err == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+}
+
+/**
+ * @brief Returns the first error from a command.
+ *
+ * @return The error, or nil.
+ */
+func (r *runner) failure() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+/**
+ * @brief Pauses or resumes the simulation.
+ *
+ * @param paused Whether to pause.
+ */
+func (r *runner) setPaused(paused bool) {
+	r.send(func() { r.paused = paused })
+}
+
+/**
+ * @brief Pauses the simulation and takes a single step.
+ */
+func (r *runner) stepOnce() {
+	r.send(func() {
+		r.paused = true
+		r.sim.Step()
+	})
+}
+
+/**
+ * @brief Changes the number of steps taken a second.
+ *
+ * @param rate The new rate, or +Inf to run as fast as possible.
+ */
+func (r *runner) setRate(rate float64) {
+	r.send(func() { r.rate = rate })
+}
+
+/**
+ * @brief Starts the simulation again with a new seed.
+ *
+ * @param seed The seed.
+ */
+func (r *runner) reset(seed int64) {
+	r.send(func() { r.fail(r.sim.Reset(seed)) })
+}
+
+/**
+ * @brief Paints a cell, as Wator.Simulation.Paint does.
+ *
+ * Painting over land is refused, which is all it can fail with from the
+ * window, so failures are ignored.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @param cellType The type to paint.
+ */
+func (r *runner) paint(x, y int, cellType Wator.CellType) {
+	r.send(func() { _ = r.sim.Paint(x, y, cellType) })
+}
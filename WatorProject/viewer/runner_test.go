@@ -0,0 +1,121 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Viewer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"wator/wator"
+)
+
+// newTestRunner returns a runner for a small seeded simulation, stopped when
+// the test ends
+func newTestRunner(t *testing.T, rate float64, paused bool) (*runner, *Wator.Simulation) {
+	t.Helper()
+	cfg := Wator.DefaultConfig()
+	cfg.GridWidth, cfg.GridHeight = 20, 20
+	cfg.InitialFishCount, cfg.InitialSharkCount = 80, 20
+	cfg.Seed = 1
+	sim, err := Wator.NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRunner(sim, rate)
+	r.paused = paused
+	r.start()
+	t.Cleanup(r.stop)
+	return r, sim
+}
+
+// waitFor waits until the runner publishes a frame that satisfies done
+func waitFor(t *testing.T, r *runner, done func(f *frame) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		f := r.acquire()
+		ok := done(f)
+		r.release()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("timed out waiting for a frame")
+}
+
+func TestRunnerRunsUnthrottled(t *testing.T) {
+	r, _ := newTestRunner(t, math.Inf(1), false)
+	waitFor(t, r, func(f *frame) bool { return f.step >= 100 })
+}
+
+func TestRunnerFollowsCommandsWhilePaused(t *testing.T) {
+	r, sim := newTestRunner(t, DefaultRate, true)
+	for i := 0; i < 3; i++ {
+		r.stepOnce()
+	}
+	r.paint(0, 0, Wator.Shark)
+	waitFor(t, r, func(f *frame) bool {
+		return f.step == 3 && f.grid.At(0, 0).Type == Wator.Shark
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	f := r.acquire()
+	step := f.step
+	r.release()
+	if step != 3 {
+		t.Errorf("paused runner reached step %d, want 3", step)
+	}
+	r.stop()
+	if sim.StepCount() != 3 {
+		t.Errorf("simulation took %d steps, want 3", sim.StepCount())
+	}
+}
+
+func TestRunnerLeavesHeldFramesAlone(t *testing.T) {
+	r, _ := newTestRunner(t, DefaultRate, true)
+	f := r.acquire()
+	grid, step := f.grid.Clone(), f.step
+	r.stepOnce()
+	time.Sleep(50 * time.Millisecond)
+	if f.step != step || !f.grid.Equal(grid) {
+		t.Error("the frame being drawn changed while the simulation stepped")
+	}
+	r.release()
+	waitFor(t, r, func(f *frame) bool { return f.step == step+1 })
+}
+
+func TestRunnerKeepsToItsRate(t *testing.T) {
+	r, _ := newTestRunner(t, 20, false)
+	time.Sleep(500 * time.Millisecond)
+	// Ten steps are due, with room for a slow machine
+	step := 0
+	waitFor(t, r, func(f *frame) bool {
+		step = f.step
+		return step >= 5
+	})
+	if step > 15 {
+		t.Errorf("runner at 20 steps a second took %d steps in half a second", step)
+	}
+}
+
+func TestRates(t *testing.T) {
+	if got := fasterRate(DefaultRate); got != 120 {
+		t.Errorf("fasterRate(%d) = %g, want 120", DefaultRate, got)
+	}
+	if got := slowerRate(DefaultRate); got != 30 {
+		t.Errorf("slowerRate(%d) = %g, want 30", DefaultRate, got)
+	}
+	if got := fasterRate(960); !math.IsInf(got, 1) {
+		t.Errorf("fasterRate(960) = %g, want unthrottled", got)
+	}
+	if got := fasterRate(math.Inf(1)); !math.IsInf(got, 1) {
+		t.Errorf("fasterRate(unthrottled) = %g", got)
+	}
+	if got := slowerRate(1); got != 1 {
+		t.Errorf("slowerRate(1) = %g, want 1", got)
+	}
+	if got := slowerRate(100); got != 60 {
+		t.Errorf("slowerRate(100) = %g, want 60", got)
+	}
+}
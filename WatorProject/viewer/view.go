@@ -0,0 +1,267 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Viewer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"wator/wator"
+)
+
+const (
+	// zoomStep is how much one notch of the mouse wheel zooms in or out
+	zoomStep = 1.25
+	// maxCellPixels is the largest a cell can be zoomed to, in pixels
+	// along its width
+	maxCellPixels = 48
+	// tooltipGap is the distance in pixels between the cursor and the
+	// tooltip
+	tooltipGap = 12
+)
+
+/**
+ * @brief Acts on the mouse wheel, dragging and the F key, which move the
+ *        view of the grid.
+ *
+ * The wheel zooms in and out around the cursor, dragging with the right or
+ * middle button, or with the left button while the simulation runs, pans
+ * the view, and F fits the whole grid in the window again.
+ */
+func (g *Game) handleView() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF) {
+		g.zoom, g.panX, g.panY = 1, 0, 0
+	}
+	px, py := ebiten.CursorPosition()
+	if _, wheel := ebiten.Wheel(); wheel != 0 {
+		g.zoomAt(px, py, math.Pow(zoomStep, wheel))
+	}
+
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) ||
+		ebiten.IsMouseButtonPressed(ebiten.MouseButtonMiddle) ||
+		(!g.paused && ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)) {
+		if g.dragging {
+			g.panBy(px-g.dragX, py-g.dragY)
+		}
+		g.dragging, g.dragX, g.dragY = true, px, py
+	} else {
+		g.dragging = false
+	}
+}
+
+/**
+ * @brief Zooms the view, keeping the point under the cursor where it is.
+ *
+ * The zoom runs from 1, where the whole grid fits the window, to where a
+ * cell is maxCellPixels wide.
+ *
+ * @param px The x-coordinate of the cursor in pixels.
+ * @param py The y-coordinate of the cursor in pixels.
+ * @param factor How much to zoom in by, or out by if below one.
+ */
+func (g *Game) zoomAt(px, py int, factor float64) {
+	maxZoom := max(1, maxCellPixels/g.cfg.CellSize())
+	zoom := min(max(g.zoom*factor, 1), maxZoom)
+	width, height := g.cellExtent()
+	// The cell under the cursor, in fractions of a cell, stays under it
+	col := g.panY + float64(px)/(width*g.zoom)
+	row := g.panX + float64(py)/(height*g.zoom)
+	g.zoom = zoom
+	g.panY = col - float64(px)/(width*zoom)
+	g.panX = row - float64(py)/(height*zoom)
+	g.clampPan()
+}
+
+/**
+ * @brief Moves the view with the cursor as it is dragged.
+ *
+ * @param dx How far the cursor has moved right, in pixels.
+ * @param dy How far the cursor has moved down, in pixels.
+ */
+func (g *Game) panBy(dx, dy int) {
+	width, height := g.cellExtent()
+	g.panY -= float64(dx) / (width * g.zoom)
+	g.panX -= float64(dy) / (height * g.zoom)
+	g.clampPan()
+}
+
+/**
+ * @brief Keeps the view over the grid.
+ *
+ * On a torus the view wraps round, so the pan is taken modulo the size of
+ * the grid; otherwise the view is stopped at the edges.
+ */
+func (g *Game) clampPan() {
+	if g.wraps() {
+		g.panX = wrapFloat(g.panX, float64(g.rows))
+		g.panY = wrapFloat(g.panY, float64(g.cols))
+		return
+	}
+	g.panX = min(max(g.panX, 0), float64(g.rows)*(1-1/g.zoom))
+	g.panY = min(max(g.panY, 0), float64(g.cols)*(1-1/g.zoom))
+}
+
+/**
+ * @brief Reports whether the grid wraps round at its edges.
+ *
+ * @return true if the boundary is a torus.
+ */
+func (g *Game) wraps() bool {
+	return g.cfg.Boundary == Wator.Torus
+}
+
+/**
+ * @brief Returns the distance between neighbouring cells before zooming.
+ *
+ * @return The distance in pixels between the centres of cells next to
+ *         each other in a row, and between those of neighbouring rows,
+ *         which are closer together in a hexagonal grid.
+ */
+func (g *Game) cellExtent() (width, height float64) {
+	width = g.cfg.CellSize()
+	if g.cfg.Neighbourhood == Wator.Hexagonal {
+		return width, width * math.Sqrt(3) / 2
+	}
+	return width, width
+}
+
+/**
+ * @brief Finds the cell drawn at a point of the screen.
+ *
+ * @param px The x-coordinate of the point in pixels.
+ * @param py The y-coordinate of the point in pixels.
+ * @return The row and column of the cell, and false if the point is not
+ *         over the grid.
+ */
+func (g *Game) cellAt(px, py int) (x, y int, ok bool) {
+	width, height := g.cellExtent()
+	// The point in the grid's own pixels, before zooming and panning
+	fx := float64(px)/g.zoom + g.panY*width
+	fy := float64(py)/g.zoom + g.panX*height
+	if g.cfg.Neighbourhood != Wator.Hexagonal {
+		return g.wrapCell(int(math.Floor(fy/width)), int(math.Floor(fx/width)))
+	}
+
+	// The nearest centre, among the rows and columns around the point, is
+	// the hexagon the point lies in. Rows and columns past the edges are
+	// wrapped afterwards, and a wrapping grid has an even number of rows,
+	// so the parity of a row is the same on either side of the edge.
+	radius := width / math.Sqrt(3)
+	guess := int(math.Floor((fy - radius) / height))
+	best := math.Inf(1)
+	for row := guess - 1; row <= guess+2; row++ {
+		shift := 0.5 * float64(row&1)
+		near := int(math.Floor(fx/width - shift))
+		for col := near - 1; col <= near+1; col++ {
+			dx := fx - (float64(col)+0.5+shift)*width
+			dy := fy - (float64(row)*height + radius)
+			if d := dx*dx + dy*dy; d < best {
+				best, x, y = d, row, col
+			}
+		}
+	}
+	if best > radius*radius {
+		return 0, 0, false
+	}
+	return g.wrapCell(x, y)
+}
+
+/**
+ * @brief Brings a cell that may lie past the edges of the grid back onto
+ *        it.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return The cell, wrapped round on a torus, and false if it is off a
+ *         grid that does not wrap.
+ */
+func (g *Game) wrapCell(x, y int) (int, int, bool) {
+	if g.wraps() {
+		return (x%g.rows + g.rows) % g.rows, (y%g.cols + g.cols) % g.cols, true
+	}
+	return x, y, x >= 0 && x < g.rows && y >= 0 && y < g.cols
+}
+
+/**
+ * @brief Returns a value taken modulo a size, in the range [0, size).
+ *
+ * @param v The value.
+ * @param size The size.
+ * @return The wrapped value.
+ */
+func wrapFloat(v, size float64) float64 {
+	v = math.Mod(v, size)
+	if v < 0 {
+		v += size
+	}
+	return v
+}
+
+/**
+ * @brief Draws a tooltip describing the cell under the cursor.
+ *
+ * Nothing is drawn while the view is being dragged or the cursor is not
+ * over the grid.
+ *
+ * @param screen The image to draw onto.
+ * @param f The frame being drawn.
+ */
+func (g *Game) drawTooltip(screen *ebiten.Image, f *frame) {
+	px, py := ebiten.CursorPosition()
+	bounds := screen.Bounds()
+	if g.dragging || px < 0 || py < 0 || px >= bounds.Dx() || py >= bounds.Dy() {
+		return
+	}
+	x, y, ok := g.cellAt(px, py)
+	if !ok {
+		return
+	}
+
+	text := g.tooltipText(f, x, y)
+	width, height := textSize(text)
+	// Kept inside the window, flipping to the other side of the cursor
+	left, top := px+tooltipGap, py+tooltipGap
+	if left+width > bounds.Dx() {
+		left = max(px-tooltipGap-width, 0)
+	}
+	if top+height > bounds.Dy() {
+		top = max(py-tooltipGap-height, 0)
+	}
+	g.drawText(screen, text, left, top)
+}
+
+/**
+ * @brief Returns the description of a cell shown in the tooltip.
+ *
+ * @param f The frame being drawn.
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return The cell's position and what it holds: the species, counters
+ *         and age of an entity, the nutrient of empty water under a
+ *         nutrient map, or land.
+ */
+func (g *Game) tooltipText(f *frame, x, y int) string {
+	cell := f.grid.At(x, y)
+	position := fmt.Sprintf("(%d, %d)", x, y)
+	switch cell.Type {
+	case Wator.Empty:
+		if f.nutrients != nil {
+			return fmt.Sprintf("%s empty\nnutrient %.2f", position, f.nutrients[f.grid.Index(x, y)])
+		}
+		return position + " empty"
+	case Wator.Land:
+		return position + " land"
+	}
+
+	name := fmt.Sprintf("type %d", cell.Type)
+	if species := f.rules.Species(cell.Type); species != nil {
+		name = species.Name()
+	}
+	hunger := fmt.Sprintf("starve %d", cell.StarveCounter)
+	if _, shark := f.rules.Species(cell.Type).(Wator.SharkSpecies); shark && g.cfg.SharkEnergyModel {
+		hunger = fmt.Sprintf("energy %d", cell.Energy)
+	}
+	return fmt.Sprintf("%s %s\nbreed %d  %s  age %d", position, name, cell.BreedCounter, hunger, cell.Age)
+}
@@ -0,0 +1,147 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Viewer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"wator/wator"
+)
+
+// newViewGame returns a game showing an empty square grid of the given size
+// in a 500 pixel window
+func newViewGame(t *testing.T, size int, boundary Wator.Boundary, neighbourhood Wator.NeighbourhoodKind) *Game {
+	t.Helper()
+	cfg := Wator.DefaultConfig()
+	cfg.GridWidth, cfg.GridHeight = size, size
+	cfg.ScreenWidth, cfg.ScreenHeight = 500, 500
+	cfg.InitialFishCount, cfg.InitialSharkCount = 0, 0
+	cfg.Boundary, cfg.Neighbourhood = boundary, neighbourhood
+	sim, err := Wator.NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGame(sim, DefaultRate)
+}
+
+func TestCellAtFollowsZoomAndPan(t *testing.T) {
+	g := newViewGame(t, 10, Wator.Torus, Wator.VonNeumann)
+	g.zoom, g.panX, g.panY = 2, 3, 4
+	if x, y, ok := g.cellAt(10, 130); !ok || x != 4 || y != 4 {
+		t.Errorf("cellAt(10, 130) = (%d, %d, %v), want (4, 4, true)", x, y, ok)
+	}
+
+	// Past the right edge of a torus is the first column again
+	g.panY = 9.5
+	if x, y, ok := g.cellAt(60, 0); !ok || x != 3 || y != 0 {
+		t.Errorf("cellAt(60, 0) across the edge = (%d, %d, %v), want (3, 0, true)", x, y, ok)
+	}
+	walled := newViewGame(t, 10, Wator.Walls, Wator.VonNeumann)
+	walled.zoom, walled.panX, walled.panY = 2, 3, 9.5
+	if _, _, ok := walled.cellAt(60, 0); ok {
+		t.Error("cellAt past the edge of a walled grid found a cell")
+	}
+}
+
+func TestCellAtFindsHexagonsWhenPanned(t *testing.T) {
+	g := newViewGame(t, 10, Wator.Torus, Wator.Hexagonal)
+	width, rowHeight := g.cfg.CellSize(), g.cfg.CellSize()*math.Sqrt(3)/2
+	centreX := (4 + 0.5 + 0.5) * width
+	centreY := 3*rowHeight + width/math.Sqrt(3)
+	if x, y, ok := g.cellAt(int(centreX), int(centreY)); !ok || x != 3 || y != 4 {
+		t.Errorf("cellAt the centre of (3, 4) = (%d, %d, %v)", x, y, ok)
+	}
+
+	// Panned down four rows, the hexagon is drawn four rows higher, and
+	// the top row is drawn again below the bottom one
+	g.panX = 4
+	if x, y, ok := g.cellAt(int(centreX), int(centreY-4*rowHeight)); !ok || x != 3 || y != 4 {
+		t.Errorf("cellAt the panned centre of (3, 4) = (%d, %d, %v)", x, y, ok)
+	}
+	if x, _, ok := g.cellAt(int(centreX), int(centreY+3*rowHeight)); !ok || x != 0 {
+		t.Errorf("cellAt below the last row = row %d, %v, want row 0", x, ok)
+	}
+}
+
+func TestZoomKeepsTheCellUnderTheCursor(t *testing.T) {
+	g := newViewGame(t, 100, Wator.Torus, Wator.VonNeumann)
+	beforeX, beforeY, _ := g.cellAt(137, 242)
+	g.zoomAt(137, 242, 3)
+	if g.zoom != 3 {
+		t.Fatalf("zoom = %g, want 3", g.zoom)
+	}
+	if x, y, _ := g.cellAt(137, 242); x != beforeX || y != beforeY {
+		t.Errorf("cell under the cursor moved from (%d, %d) to (%d, %d)", beforeX, beforeY, x, y)
+	}
+
+	g.zoomAt(0, 0, 1000)
+	if want := maxCellPixels / g.cfg.CellSize(); g.zoom != want {
+		t.Errorf("zoom = %g, want the largest of %g", g.zoom, want)
+	}
+	g.zoomAt(0, 0, 1e-6)
+	if g.zoom != 1 {
+		t.Errorf("zoom = %g, want no less than 1", g.zoom)
+	}
+}
+
+func TestPanStopsAtWallsAndWrapsOnTorus(t *testing.T) {
+	walled := newViewGame(t, 10, Wator.Walls, Wator.VonNeumann)
+	walled.zoom = 2
+	walled.panBy(-10000, -10000)
+	if walled.panX != 5 || walled.panY != 5 {
+		t.Errorf("pan past the bottom right = (%g, %g), want (5, 5)", walled.panX, walled.panY)
+	}
+	walled.panBy(10000, 10000)
+	if walled.panX != 0 || walled.panY != 0 {
+		t.Errorf("pan past the top left = (%g, %g), want (0, 0)", walled.panX, walled.panY)
+	}
+
+	torus := newViewGame(t, 10, Wator.Torus, Wator.VonNeumann)
+	torus.panBy(60, -30)
+	if math.Abs(torus.panY-8.8) > 1e-9 || math.Abs(torus.panX-0.6) > 1e-9 {
+		t.Errorf("pan on a torus = (%g, %g), want (0.6, 8.8)", torus.panX, torus.panY)
+	}
+}
+
+func TestTooltipDescribesTheCell(t *testing.T) {
+	cfg := Wator.DefaultConfig()
+	cfg.GridWidth, cfg.GridHeight = 6, 6
+	cfg.InitialFishCount, cfg.InitialSharkCount = 0, 0
+	cfg.FishBreedTime = 10
+	sim, err := Wator.NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Paint(1, 1, Wator.Fish); err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(2)
+	if err := sim.Paint(4, 4, Wator.Shark); err != nil {
+		t.Fatal(err)
+	}
+	var fishX, fishY int
+	grid := sim.View()
+	for i, cellType := range grid.Types {
+		if cellType == Wator.Fish {
+			fishX, fishY = i/grid.Cols, i%grid.Cols
+		}
+	}
+
+	g := NewGame(sim, DefaultRate)
+	f := g.runner.acquire()
+	defer g.runner.release()
+	tests := []struct {
+		x, y int
+		want string
+	}{
+		{fishX, fishY, fmt.Sprintf("(%d, %d) fish\nbreed 2  starve 0  age 2", fishX, fishY)},
+		{4, 4, fmt.Sprintf("(4, 4) shark\nbreed 0  starve %d  age 0", cfg.SharkStarveTime)},
+		{0, 5, "(0, 5) empty"},
+	}
+	for _, tt := range tests {
+		if got := g.tooltipText(f, tt.x, tt.y); got != tt.want {
+			t.Errorf("tooltip at (%d, %d) = %q, want %q", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
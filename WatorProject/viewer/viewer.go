@@ -0,0 +1,739 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Viewer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"wator/wator"
+)
+
+// Game draws a Wator.Simulation in an ebiten window while a runner steps it
+// on another goroutine at a rate chosen from the keyboard. All of the
+// simulation state lives in the Simulation, which the game only sees
+// through the runner's frames; the game holds the state of the controls.
+type Game struct {
+	runner *runner
+	// The parameters, size and species of the grid, which a reset leaves
+	// alone
+	cfg        Wator.Config
+	rows, cols int
+	types      []Wator.CellType
+	threads    int
+
+	paused bool
+	rate   float64 // steps a second, infinite to run as fast as it can
+	hud    bool
+	// brush is what the left mouse button paints while paused
+	brush Wator.CellType
+
+	// The view of the grid: zoom is how far it is magnified, 1 showing the
+	// whole grid, and panX and panY are the row and column, in fractions
+	// of a cell, at the top left of the window
+	zoom       float64
+	panX, panY float64
+	// Whether the view is being dragged, and where the cursor was
+	dragging     bool
+	dragX, dragY int
+
+	// Reused between frames when drawing square cells: one pixel per cell
+	// and the tiles they are uploaded into
+	pixels []byte
+	tiles  []gridTile
+
+	// Reused between frames when drawing hexagonal cells
+	vertices []ebiten.Vertex
+	indices  []uint16
+}
+
+// maxTileSize is the largest image, in pixels along each side, a grid of
+// square cells is uploaded into. Larger grids are split into tiles, as
+// a single image larger than the GPU's largest texture cannot be made.
+const maxTileSize = 2048
+
+// gridTile is a block of the cells of a grid of square cells, uploaded into
+// an image of its own
+type gridTile struct {
+	image      *ebiten.Image
+	row, col   int // the top left cell of the tile
+	rows, cols int
+	pixels     []byte // the tile's part of Game.pixels, nil for a single tile
+}
+
+// Colours of the cell types, with other species drawn in grey
+var (
+	fishColour  = color.RGBA{0, 255, 0, 255}
+	sharkColour = color.RGBA{255, 0, 0, 255}
+	otherColour = color.RGBA{160, 160, 160, 255}
+	landColour  = color.RGBA{194, 178, 128, 255}
+	// Empty water full of nutrient, fading to black as it is grazed
+	nutrientColour = color.RGBA{0, 60, 110, 255}
+)
+
+// Rates the + and - keys step through, in steps a second, from one step a
+// second to as fast as the simulation can run
+var rates = []float64{1, 2, 4, 8, 15, 30, 60, 120, 240, 480, 960, math.Inf(1)}
+
+// DefaultRate is one step for each frame at the usual 60 frames a second,
+// the speed the window has always run at
+const DefaultRate = 60
+
+// A white pixel that hexagons are filled from, taken from the middle of a
+// larger image so that filtering never samples past its edge
+var whitePixel = func() *ebiten.Image {
+	img := ebiten.NewImage(3, 3)
+	img.Fill(color.White)
+	return img.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image)
+}()
+
+/**
+ * @brief Creates a game that renders the given simulation.
+ *
+ * The simulation belongs to the game from then on and must not be used by
+ * anything else. It is not stepped until the game is run.
+ *
+ * @param sim The simulation to step and draw.
+ * @param rate The number of steps to take a second, or 0 to run as fast as
+ *        the simulation can.
+ * @return The new game.
+ */
+func NewGame(sim *Wator.Simulation, rate float64) *Game {
+	if rate <= 0 {
+		rate = math.Inf(1)
+	}
+	rows, cols := sim.Size()
+	return &Game{
+		runner:  newRunner(sim, rate),
+		cfg:     sim.Config(),
+		rows:    rows,
+		cols:    cols,
+		types:   sim.Rules().Types(),
+		threads: sim.Threads(),
+		rate:    rate,
+		brush:   Wator.Fish,
+		hud:     true,
+		zoom:    1,
+	}
+}
+
+/**
+ * @brief Draws the game grid onto the provided screen.
+ *
+ * This method fills the screen with a black background and draws each cell
+ * of the grid based on its type. Cells representing fish and sharks are
+ * drawn in green and red, respectively, with fish brighter the closer they
+ * are to breeding and sharks darker the hungrier they are. Species of a
+ * food web are drawn in
+ * their own colours, any other species in grey and the land of a world map
+ * in sand. Under a nutrient map empty water is blue where it is rich in
+ * nutrient. Cells are scaled so the whole grid fits the screen, and may be
+ * smaller than a pixel on very large grids. Grids using the hexagonal
+ * neighbourhood are drawn as hexagons. The grid is drawn as zoomed and
+ * panned by the mouse (see handleView), repeating across the edges of a
+ * torus. The HUD and a tooltip describing the cell under the cursor are
+ * drawn on top (see drawHUD and drawTooltip) unless they have been hidden,
+ * which leaves only a note while paused.
+ * Everything is drawn from the latest frame the runner has published, so
+ * drawing never waits for a step.
+ *
+ * @param screen A pointer to an `ebiten.Image` where the game grid will be drawn.
+ */
+func (g *Game) Draw(screen *ebiten.Image) {
+	f := g.runner.acquire()
+	defer g.runner.release()
+	screen.Fill(color.RGBA{0, 0, 0, 255})
+
+	if g.cfg.Neighbourhood == Wator.Hexagonal {
+		g.drawHexagons(screen, f)
+	} else {
+		g.drawSquares(screen, f)
+	}
+	if g.hud {
+		g.drawHUD(screen, f)
+		g.drawTooltip(screen, f)
+	} else if g.paused {
+		g.drawText(screen, "paused", 0, 0)
+	}
+}
+
+/**
+ * @brief Draws the grid as rows of square cells.
+ *
+ * The colour of every cell is written into a buffer holding one pixel per
+ * cell, which is uploaded with WritePixels and drawn scaled up to the cell
+ * size, one draw call for each tile of at most maxTileSize cells a side,
+ * so the cost of a frame on the GPU does not grow with the number of
+ * occupied cells. Grids larger than the screen are shrunk with linear
+ * filtering, which ebiten samples from mipmaps of the image, halved up to
+ * six times, so each pixel is roughly the average of the cells it covers;
+ * only a grid shrunk more than 64 times has cells no pixel samples. On a
+ * torus that has been panned the image is drawn again beyond each edge it
+ * has moved away from, so the grid wraps round seamlessly.
+ *
+ * @param screen The image to draw onto.
+ * @param f The frame to draw.
+ */
+func (g *Game) drawSquares(screen *ebiten.Image, f *frame) {
+	if len(g.pixels) != 4*g.rows*g.cols {
+		g.pixels = make([]byte, 4*g.rows*g.cols)
+		g.tiles = newGridTiles(g.rows, g.cols)
+		for i := range g.tiles {
+			g.tiles[i].image = ebiten.NewImage(g.tiles[i].cols, g.tiles[i].rows)
+		}
+	}
+	g.fillPixels(f, g.pixels)
+	for i := range g.tiles {
+		g.tiles[i].upload(g.pixels, g.cols)
+	}
+
+	cellSize := g.cfg.CellSize() * g.zoom
+	for _, copyY := range g.wrapCopies(g.panY) {
+		for _, copyX := range g.wrapCopies(g.panX) {
+			for _, tile := range g.tiles {
+				op := &ebiten.DrawImageOptions{}
+				op.GeoM.Scale(cellSize, cellSize)
+				op.GeoM.Translate((copyY*float64(g.cols)+float64(tile.col)-g.panY)*cellSize,
+					(copyX*float64(g.rows)+float64(tile.row)-g.panX)*cellSize)
+				if cellSize < 1 {
+					op.Filter = ebiten.FilterLinear
+				}
+				screen.DrawImage(tile.image, op)
+			}
+		}
+	}
+}
+
+/**
+ * @brief Splits a grid of square cells into tiles no larger than
+ *        maxTileSize cells a side.
+ *
+ * @param rows The number of rows in the grid.
+ * @param cols The number of columns in the grid.
+ * @return The tiles, covering every cell once, in row-major order, without
+ *         their images.
+ */
+func newGridTiles(rows, cols int) []gridTile {
+	var tiles []gridTile
+	for row := 0; row < rows; row += maxTileSize {
+		for col := 0; col < cols; col += maxTileSize {
+			tile := gridTile{row: row, col: col, rows: min(maxTileSize, rows-row), cols: min(maxTileSize, cols-col)}
+			if tile.rows != rows || tile.cols != cols {
+				tile.pixels = make([]byte, 4*tile.rows*tile.cols)
+			}
+			tiles = append(tiles, tile)
+		}
+	}
+	return tiles
+}
+
+/**
+ * @brief Uploads the tile's part of the grid's pixels into its image.
+ *
+ * @param pixels The pixels of the whole grid, as filled by fillPixels.
+ * @param cols The number of columns in the grid.
+ */
+func (t *gridTile) upload(pixels []byte, cols int) {
+	if t.pixels == nil {
+		// The tile is the whole grid
+		t.image.WritePixels(pixels)
+		return
+	}
+	t.copyFrom(pixels, cols)
+	t.image.WritePixels(t.pixels)
+}
+
+/**
+ * @brief Copies the tile's part of the grid's pixels into its own buffer.
+ *
+ * @param pixels The pixels of the whole grid.
+ * @param cols The number of columns in the grid.
+ */
+func (t *gridTile) copyFrom(pixels []byte, cols int) {
+	for r := 0; r < t.rows; r++ {
+		from := 4 * ((t.row+r)*cols + t.col)
+		copy(t.pixels[4*r*t.cols:4*(r+1)*t.cols], pixels[from:from+4*t.cols])
+	}
+}
+
+/**
+ * @brief Returns where copies of the grid are drawn along one axis.
+ *
+ * @param pan How far the view is panned along the axis, in cells.
+ * @return 0 for the grid itself, followed by 1 for a copy one grid further
+ *         on when the grid wraps round and has been panned along the axis.
+ */
+func (g *Game) wrapCopies(pan float64) []float64 {
+	if g.wraps() && pan > 0 {
+		return []float64{0, 1}
+	}
+	return []float64{0}
+}
+
+/**
+ * @brief Writes the colour of every cell into a pixel buffer.
+ *
+ * @param f The frame to draw.
+ * @param pixels The buffer, holding four bytes (red, green, blue and
+ *        alpha) for each cell in row-major order. Cells that are not drawn
+ *        are black.
+ */
+func (g *Game) fillPixels(f *frame, pixels []byte) {
+	cfg, rules, grid := g.cfg, f.rules, f.grid
+
+	// Types drawn in one colour are looked up, and fish and sharks without
+	// a colour of their own are shaded by their counters
+	var palette [256]color.RGBA
+	for _, t := range rules.Types() {
+		palette[t] = cellColour(cfg, rules, Wator.Entity{Type: t})
+	}
+	palette[Wator.Land] = landColour
+	_, colouredFish := rules.Species(Wator.Fish).(Wator.Coloured)
+	_, colouredSharks := rules.Species(Wator.Shark).(Wator.Coloured)
+	shadeFish := rules.Species(Wator.Fish) != nil && !colouredFish
+	shadeSharks := rules.Species(Wator.Shark) != nil && !colouredSharks
+	sharkCounter, sharkFull := grid.Starve, cfg.SharkStarveTime
+	if cfg.SharkEnergyModel {
+		sharkCounter, sharkFull = grid.Energy, cfg.SharkMaxEnergy
+	}
+	fishShades := shadeTable(cfg.FishBreedTime, fishShade)
+	sharkShades := shadeTable(sharkFull, sharkShade)
+
+	for i, t := range grid.Types {
+		var colour color.RGBA
+		switch {
+		case t == Wator.Empty:
+			if f.nutrients != nil {
+				colour, _ = nutrientShade(f.nutrients[i])
+			}
+		case t == Wator.Fish && shadeFish:
+			colour = fishShades[min(max(int(grid.Breed[i]), 0), len(fishShades)-1)]
+		case t == Wator.Shark && shadeSharks:
+			colour = sharkShades[min(max(int(sharkCounter[i]), 0), len(sharkShades)-1)]
+		default:
+			colour = palette[t]
+		}
+		p := pixels[4*i : 4*i+4]
+		p[0], p[1], p[2], p[3] = colour.R, colour.G, colour.B, 255
+	}
+}
+
+/**
+ * @brief Returns the colour a cell is drawn in, if it is drawn at all.
+ *
+ * Empty cells are left black unless there is a nutrient map, in which
+ * case they are shaded by the nutrient they hold.
+ *
+ * @param cfg The simulation parameters.
+ * @param f The frame being drawn.
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return The fill colour of the cell, and false if it is left black.
+ */
+func colourAt(cfg Wator.Config, f *frame, x, y int) (color.RGBA, bool) {
+	cell := f.grid.At(x, y)
+	if cell.Type != Wator.Empty {
+		return cellColour(cfg, f.rules, cell), true
+	}
+	if f.nutrients == nil {
+		return color.RGBA{}, false
+	}
+	return nutrientShade(f.nutrients[f.grid.Index(x, y)])
+}
+
+/**
+ * @brief Returns the colour an empty cell is drawn in for its nutrients.
+ *
+ * @param level The nutrient level of the cell.
+ * @return The colour, and false if the cell has no nutrients to draw.
+ */
+func nutrientShade(level float32) (color.RGBA, bool) {
+	if level <= 0 {
+		return color.RGBA{}, false
+	}
+	level = min(level, 1)
+	return color.RGBA{
+		uint8(float32(nutrientColour.R) * level),
+		uint8(float32(nutrientColour.G) * level),
+		uint8(float32(nutrientColour.B) * level),
+		255,
+	}, true
+}
+
+/**
+ * @brief Returns the colour a cell is drawn in.
+ *
+ * Land is sand coloured. Species that choose their own colour, such as
+ * those of a food web, are drawn in it. A fish's green brightens from
+ * two fifths of its full brightness after breeding to full brightness when
+ * it is ready to breed again. A shark's red fades towards a quarter of its
+ * full brightness as its starvation counter, or its energy under the
+ * energy model, runs down, so hungry sharks stand out.
+ *
+ * @param cfg The simulation parameters.
+ * @param rules The species of the simulation.
+ * @param cell The occupied cell to colour.
+ * @return The fill colour of the cell.
+ */
+func cellColour(cfg Wator.Config, rules *Wator.Rules, cell Wator.Entity) color.RGBA {
+	if cell.Type == Wator.Land {
+		return landColour
+	}
+	if species, ok := rules.Species(cell.Type).(Wator.Coloured); ok {
+		return species.Colour()
+	}
+	switch cell.Type {
+	case Wator.Fish:
+		return fishShade(counterLevel(cell.BreedCounter, cfg.FishBreedTime))
+	case Wator.Shark:
+		if cfg.SharkEnergyModel {
+			return sharkShade(counterLevel(cell.Energy, cfg.SharkMaxEnergy))
+		}
+		return sharkShade(counterLevel(cell.StarveCounter, cfg.SharkStarveTime))
+	}
+	return otherColour
+}
+
+/**
+ * @brief Returns the colour of every value of a counter up to full.
+ *
+ * @param full The value at which the counter is full.
+ * @param shade Returns the colour for how far the counter has got.
+ * @return The colours indexed by the counter, up to and including full.
+ */
+func shadeTable(full int, shade func(level float64) color.RGBA) []color.RGBA {
+	table := make([]color.RGBA, max(full, 1)+1)
+	for counter := range table {
+		table[counter] = shade(counterLevel(counter, full))
+	}
+	return table
+}
+
+/**
+ * @brief Returns the colour of a fish, which brightens as it nears
+ *        breeding.
+ *
+ * @param level How far the fish's breed counter has got, from 0 to 1.
+ * @return The colour.
+ */
+func fishShade(level float64) color.RGBA {
+	colour := fishColour
+	colour.G = uint8(float64(fishColour.G) * (0.4 + 0.6*level))
+	return colour
+}
+
+/**
+ * @brief Returns the colour of a shark, which darkens as it starves.
+ *
+ * @param level How well fed the shark is, from 0 when starving to 1.
+ * @return The colour.
+ */
+func sharkShade(level float64) color.RGBA {
+	colour := sharkColour
+	colour.R = uint8(float64(sharkColour.R) * (0.25 + 0.75*level))
+	return colour
+}
+
+/**
+ * @brief Returns how far a counter has got towards its full value.
+ *
+ * @param counter The counter.
+ * @param full The value at which the counter is full.
+ * @return The counter over its full value, clamped between 0 and 1.
+ */
+func counterLevel(counter, full int) float64 {
+	return min(max(float64(counter)/float64(max(full, 1)), 0), 1)
+}
+
+/**
+ * @brief Draws the grid as rows of hexagons standing on a point.
+ *
+ * Each row is √3/2 of a cell below the one above and odd rows are shifted
+ * half a cell to the right, matching Wator.Hexagonal. The hexagons are
+ * collected into as few DrawTriangles calls as the index limit allows, and
+ * those outside the window are left out. On a torus the rows and columns
+ * panned off the top and left are drawn again below and to the right.
+ *
+ * @param screen The image to draw onto.
+ * @param f The frame to draw.
+ */
+func (g *Game) drawHexagons(screen *ebiten.Image, f *frame) {
+	width := g.cfg.CellSize() * g.zoom
+	radius := width / math.Sqrt(3)
+	rowHeight := width * math.Sqrt(3) / 2
+	screenWidth, screenHeight := float64(screen.Bounds().Dx()), float64(screen.Bounds().Dy())
+
+	g.vertices, g.indices = g.vertices[:0], g.indices[:0]
+	for x := 0; x < g.rows; x++ {
+		for y := 0; y < g.cols; y++ {
+			colour, ok := colourAt(g.cfg, f, x, y)
+			if !ok {
+				continue
+			}
+			// The cell's place in the window, in cells from the top left
+			u, v := float64(y)-g.panY, float64(x)-g.panX
+			if g.wraps() && u < -1 {
+				u += float64(g.cols)
+			}
+			if g.wraps() && v < -1 {
+				v += float64(g.rows)
+			}
+			centreX := (u + 0.5 + 0.5*float64(x&1)) * width
+			centreY := v*rowHeight + radius
+			if centreX < -width || centreX > screenWidth+width || centreY < -width || centreY > screenHeight+width {
+				continue
+			}
+
+			if len(g.indices)+18 > ebiten.MaxIndicesCount {
+				g.flush(screen)
+			}
+			g.appendHexagon(centreX, centreY, radius, colour)
+		}
+	}
+	g.flush(screen)
+}
+
+/**
+ * @brief Adds a filled hexagon to the batch being drawn.
+ *
+ * The hexagon is a fan of six triangles around its centre.
+ *
+ * @param centreX The x-coordinate of the centre in pixels.
+ * @param centreY The y-coordinate of the centre in pixels.
+ * @param radius The distance from the centre to each corner.
+ * @param colour The fill colour.
+ */
+func (g *Game) appendHexagon(centreX, centreY, radius float64, colour color.RGBA) {
+	r, gr, b, a := float32(colour.R)/255, float32(colour.G)/255, float32(colour.B)/255, float32(colour.A)/255
+	vertex := func(px, py float64) ebiten.Vertex {
+		return ebiten.Vertex{DstX: float32(px), DstY: float32(py), SrcX: 1, SrcY: 1, ColorR: r, ColorG: gr, ColorB: b, ColorA: a}
+	}
+
+	base := uint16(len(g.vertices))
+	g.vertices = append(g.vertices, vertex(centreX, centreY))
+	for corner := 0; corner < 6; corner++ {
+		angle := math.Pi/6 + float64(corner)*math.Pi/3
+		g.vertices = append(g.vertices, vertex(centreX+radius*math.Cos(angle), centreY+radius*math.Sin(angle)))
+	}
+	for corner := uint16(0); corner < 6; corner++ {
+		g.indices = append(g.indices, base, base+1+corner, base+1+(corner+1)%6)
+	}
+}
+
+/**
+ * @brief Draws the batched hexagons and empties the batch.
+ *
+ * @param screen The image to draw onto.
+ */
+func (g *Game) flush(screen *ebiten.Image) {
+	if len(g.indices) > 0 {
+		screen.DrawTriangles(g.vertices, g.indices, whitePixel, nil)
+	}
+	g.vertices, g.indices = g.vertices[:0], g.indices[:0]
+}
+
+/**
+ * @brief Returns the name of what the mouse paints.
+ *
+ * @param rules The species of the simulation.
+ * @return The name of the brush's species, or "empty".
+ */
+func (g *Game) brushName(rules *Wator.Rules) string {
+	if species := rules.Species(g.brush); species != nil {
+		return species.Name()
+	}
+	return "empty"
+}
+
+/**
+ * @brief Handles the controls of the game.
+ *
+ * This method handles the keyboard and mouse, passing what they ask for to
+ * the runner, which steps the simulation on its own goroutine:
+ *   - space pauses and resumes the simulation;
+ *   - N takes a single step and pauses;
+ *   - + and - change the rate, from one step a second to as fast as the
+ *     simulation can run;
+ *   - R starts again from a new seed;
+ *   - 1 to 9 choose a species to paint, in the order they were registered,
+ *     and 0 chooses empty water;
+ *   - H hides and shows the HUD and the tooltip;
+ *   - the mouse wheel zooms, dragging pans and F fits the whole grid in the
+ *     window again (see handleView);
+ *   - while paused, the left mouse button paints the brush onto the cell
+ *     under the cursor.
+ *
+ * @return nil if the update is successful, or the error from rebuilding
+ *         the grid after R.
+ */
+func (g *Game) Update() error {
+	if err := g.runner.failure(); err != nil {
+		return err
+	}
+	g.handleKeys()
+	g.handleView()
+	if g.paused {
+		g.paint()
+	}
+	return nil
+}
+
+/**
+ * @brief Acts on the keys pressed since the last update.
+ */
+func (g *Game) handleKeys() {
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		g.paused = !g.paused
+		g.runner.setPaused(g.paused)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyN) {
+		g.paused = true
+		g.runner.stepOnce()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEqual) || inpututil.IsKeyJustPressed(ebiten.KeyKPAdd) {
+		g.setRate(fasterRate(g.rate))
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyMinus) || inpututil.IsKeyJustPressed(ebiten.KeyKPSubtract) {
+		g.setRate(slowerRate(g.rate))
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyH) {
+		g.hud = !g.hud
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		seed := time.Now().UnixNano()
+		g.runner.reset(seed)
+		ebiten.SetWindowTitle(windowTitle(seed))
+	}
+
+	for digit := 0; digit <= 9; digit++ {
+		if !inpututil.IsKeyJustPressed(ebiten.KeyDigit0+ebiten.Key(digit)) &&
+			!inpututil.IsKeyJustPressed(ebiten.KeyNumpad0+ebiten.Key(digit)) {
+			continue
+		}
+		if digit == 0 {
+			g.brush = Wator.Empty
+		} else if digit <= len(g.types) {
+			g.brush = g.types[digit-1]
+		}
+	}
+}
+
+/**
+ * @brief Changes the number of steps taken a second.
+ *
+ * @param rate The new rate, or +Inf to run as fast as possible.
+ */
+func (g *Game) setRate(rate float64) {
+	if rate != g.rate {
+		g.rate = rate
+		g.runner.setRate(rate)
+	}
+}
+
+/**
+ * @brief Returns the next rate up from a rate.
+ *
+ * @param rate The current rate.
+ * @return The slowest of rates that is faster, or rate if there is none.
+ */
+func fasterRate(rate float64) float64 {
+	for _, r := range rates {
+		if r > rate {
+			return r
+		}
+	}
+	return rate
+}
+
+/**
+ * @brief Returns the next rate down from a rate.
+ *
+ * @param rate The current rate.
+ * @return The fastest of rates that is slower, or rate if there is none.
+ */
+func slowerRate(rate float64) float64 {
+	for i := len(rates) - 1; i >= 0; i-- {
+		if rates[i] < rate {
+			return rates[i]
+		}
+	}
+	return rate
+}
+
+/**
+ * @brief Paints the brush onto the cell under the cursor while the left
+ *        mouse button is held.
+ *
+ * Land and cells already holding the brush are left alone.
+ */
+func (g *Game) paint() {
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		return
+	}
+	x, y, ok := g.cellAt(ebiten.CursorPosition())
+	if !ok {
+		return
+	}
+	f := g.runner.acquire()
+	current := f.grid.At(x, y).Type
+	g.runner.release()
+	if current != g.brush {
+		g.runner.paint(x, y, g.brush)
+	}
+}
+
+/**
+ * @brief Sets the layout dimensions for the game screen.
+ *
+ * The screen is the size of the grid scaled to fit the configured screen
+ * size (see Wator.Config.WindowSize), so non-square grids are not
+ * stretched, and ebiten scales it to whatever size the window is.
+ *
+ * @param outsideWidth The width of the game screen.
+ * @param outsideHeight The height of the game screen.
+ * @return The dimensions of the game screen as two integers,
+ *         representing the width and height, respectively.
+ */
+func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return g.cfg.WindowSize()
+}
+
+/**
+ * @brief Opens a window and runs the simulation until it is closed.
+ *
+ * The simulation is stepped on its own goroutine at the given rate while
+ * the window is drawn at the rate of the display, so a slow step does not
+ * hold up drawing and a fast simulation is not held to the frame rate.
+ *
+ * @param sim The simulation to run.
+ * @param rate The number of steps to take a second, or 0 to run as fast as
+ *        the simulation can.
+ * @return nil when the window is closed, or an error if the window could
+ *         not be run.
+ */
+func RunGame(sim *Wator.Simulation, rate float64) error {
+	cfg := sim.Config()
+	ebiten.SetWindowSize(cfg.WindowSize())
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	ebiten.SetWindowTitle(windowTitle(cfg.Seed))
+
+	game := NewGame(sim, rate)
+	game.runner.start()
+	defer game.runner.stop()
+	return ebiten.RunGame(game)
+}
+
+/**
+ * @brief Returns the title of the window.
+ *
+ * @param seed The seed of the run being shown, so it can be repeated.
+ * @return The title.
+ */
+func windowTitle(seed int64) string {
+	return fmt.Sprintf("Wator Simulation (seed %d)", seed)
+}
@@ -0,0 +1,134 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Viewer
+
+import (
+	"fmt"
+	"testing"
+
+	"wator/wator"
+)
+
+func TestFillPixelsColoursEveryCell(t *testing.T) {
+	cfg := Wator.DefaultConfig()
+	cfg.GridWidth, cfg.GridHeight = 3, 2
+	cfg.InitialFishCount, cfg.InitialSharkCount = 0, 0
+	sim, err := Wator.NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Paint(0, 1, Wator.Fish); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Paint(1, 2, Wator.Shark); err != nil {
+		t.Fatal(err)
+	}
+
+	pixels := make([]byte, 4*3*2)
+	game := NewGame(sim, DefaultRate)
+	f := game.runner.acquire()
+	game.fillPixels(f, pixels)
+	game.runner.release()
+	// A newborn fish is at two fifths of its brightness and a newborn shark
+	// is fully fed
+	want := []byte{
+		0, 0, 0, 255, 0, 102, 0, 255, 0, 0, 0, 255,
+		0, 0, 0, 255, 0, 0, 0, 255, 255, 0, 0, 255,
+	}
+	if string(pixels) != string(want) {
+		t.Errorf("pixels = %v, want %v", pixels, want)
+	}
+}
+
+func TestCounterColours(t *testing.T) {
+	cfg := Wator.DefaultConfig()
+	rules := Wator.DefaultRules()
+	tests := []struct {
+		cell Wator.Entity
+		want uint8
+	}{
+		{Wator.Entity{Type: Wator.Fish, BreedCounter: cfg.FishBreedTime}, 255},
+		{Wator.Entity{Type: Wator.Fish, BreedCounter: 3 * cfg.FishBreedTime}, 255},
+		{Wator.Entity{Type: Wator.Shark, StarveCounter: cfg.SharkStarveTime}, 255},
+		{Wator.Entity{Type: Wator.Shark, StarveCounter: 0}, 63},
+	}
+	for _, tt := range tests {
+		colour := cellColour(cfg, rules, tt.cell)
+		if got := max(colour.R, colour.G); got != tt.want {
+			t.Errorf("%+v is drawn at brightness %d, want %d", tt.cell, got, tt.want)
+		}
+	}
+}
+
+func TestSpeciesColoursIgnoreCounters(t *testing.T) {
+	rules := Wator.DefaultRules()
+	if got := speciesColour(rules, Wator.Fish); got.G != 255 {
+		t.Errorf("fish are drawn in %v in the HUD, want full green", got)
+	}
+	if got := speciesColour(rules, Wator.Shark); got.R != 255 {
+		t.Errorf("sharks are drawn in %v in the HUD, want full red", got)
+	}
+}
+
+func TestGridTilesCoverTheGrid(t *testing.T) {
+	if tiles := newGridTiles(30, 20); len(tiles) != 1 || tiles[0].pixels != nil {
+		t.Errorf("a small grid is split into %d tiles", len(tiles))
+	}
+
+	rows, cols := 2*maxTileSize+3, maxTileSize+1
+	tiles := newGridTiles(rows, cols)
+	if len(tiles) != 6 {
+		t.Fatalf("a %dx%d grid is split into %d tiles, want 6", cols, rows, len(tiles))
+	}
+	pixels := make([]byte, 4*rows*cols)
+	for i := range pixels {
+		pixels[i] = byte(i / 4 % 251)
+	}
+	covered := make([]int, rows*cols)
+	for _, tile := range tiles {
+		if tile.rows > maxTileSize || tile.cols > maxTileSize {
+			t.Errorf("tile at (%d, %d) is %dx%d", tile.row, tile.col, tile.cols, tile.rows)
+		}
+		tile.copyFrom(pixels, cols)
+		for r := 0; r < tile.rows; r++ {
+			for c := 0; c < tile.cols; c++ {
+				cell := (tile.row+r)*cols + tile.col + c
+				covered[cell]++
+				if got := tile.pixels[4*(r*tile.cols+c)]; got != pixels[4*cell] {
+					t.Fatalf("tile at (%d, %d) holds %d for cell %d, want %d", tile.row, tile.col, got, cell, pixels[4*cell])
+				}
+			}
+		}
+	}
+	for cell, n := range covered {
+		if n != 1 {
+			t.Fatalf("cell %d is in %d tiles", cell, n)
+		}
+	}
+}
+
+// BenchmarkFillPixels measures only the colouring of every cell into the
+// pixel buffer of a grid of square cells. Uploading the buffer to the GPU
+// and drawing it are not measured, as they need a running window.
+func BenchmarkFillPixels(b *testing.B) {
+	for _, size := range []int{50, 200, 1000} {
+		b.Run(fmt.Sprintf("grid=%d", size), func(b *testing.B) {
+			cfg := Wator.ScaledConfig(size)
+			cfg.Seed = 1
+			sim, err := Wator.NewSimulation(cfg, 1)
+			if err != nil {
+				b.Fatal(err)
+			}
+			sim.StepN(10)
+			game := NewGame(sim, DefaultRate)
+			f := game.runner.acquire()
+			defer game.runner.release()
+			pixels := make([]byte, 4*size*size)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				game.fillPixels(f, pixels)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EventKind describes what happened to an entity during a step
+type EventKind int
+
+const (
+	Moved EventKind = iota
+	Stayed
+	Born
+	Eaten
+	Starved
+)
+
+/**
+ * @brief Returns the name of the event kind.
+ *
+ * @return A lower case name such as "moved" or "eaten".
+ */
+func (k EventKind) String() string {
+	switch k {
+	case Moved:
+		return "moved"
+	case Stayed:
+		return "stayed"
+	case Born:
+		return "born"
+	case Eaten:
+		return "eaten"
+	case Starved:
+		return "starved"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event records one thing that happened to one entity during a step.
+// From and To are equal for every kind except Moved.
+type Event struct {
+	Kind EventKind
+	Type CellType
+	From [2]int
+	To   [2]int
+}
+
+// Accounting counts the events of a step. Every shark alive at the start
+// of a step is counted exactly once as moved, stayed or starved. A fish
+// alive at the start of a step is counted as moved or stayed when it acts,
+// and additionally as eaten if a shark catches it, before or after it acts.
+// Only the cell types Fish and Shark are counted, which in a food web are
+// its first two species; the events of other species are still listed by
+// TraceSimulation. Fish only starve, and sharks are only eaten, in food webs
+// and under rules with extra species.
+type Accounting struct {
+	FishMoved     int
+	FishStayed    int
+	FishBorn      int
+	FishEaten     int
+	FishStarved   int
+	SharksMoved   int
+	SharksStayed  int
+	SharksBorn    int
+	SharksEaten   int
+	SharksStarved int
+}
+
+// StepReport is the outcome of a single call to UpdateSimulation. Events
+// is only filled in by TraceSimulation. SharkEnergy is the sum of the
+// starvation counters of every shark alive at the end of the step.
+type StepReport struct {
+	Accounting
+	SharkEnergy int
+	Events      []Event
+
+	trace bool
+}
+
+/**
+ * @brief Records an event, updating the counts and, if tracing, the event list.
+ *
+ * @param kind What happened to the entity.
+ * @param cellType The type of the entity it happened to.
+ * @param from The position of the entity before the event.
+ * @param to The position of the entity after the event.
+ */
+func (r *StepReport) record(kind EventKind, cellType CellType, from, to [2]int) {
+	a := &r.Accounting
+	switch {
+	case cellType == Fish && kind == Moved:
+		a.FishMoved++
+	case cellType == Fish && kind == Stayed:
+		a.FishStayed++
+	case cellType == Fish && kind == Born:
+		a.FishBorn++
+	case cellType == Fish && kind == Eaten:
+		a.FishEaten++
+	case cellType == Fish && kind == Starved:
+		a.FishStarved++
+	case cellType == Shark && kind == Moved:
+		a.SharksMoved++
+	case cellType == Shark && kind == Stayed:
+		a.SharksStayed++
+	case cellType == Shark && kind == Born:
+		a.SharksBorn++
+	case cellType == Shark && kind == Eaten:
+		a.SharksEaten++
+	case cellType == Shark && kind == Starved:
+		a.SharksStarved++
+	}
+
+	if r.trace {
+		r.Events = append(r.Events, Event{Kind: kind, Type: cellType, From: from, To: to})
+	}
+}
+
+/**
+ * @brief Adds the counts and events of another report onto this one.
+ *
+ * @param other The report to merge in.
+ */
+func (r *StepReport) merge(other *StepReport) {
+	a, b := &r.Accounting, &other.Accounting
+	a.FishMoved += b.FishMoved
+	a.FishStayed += b.FishStayed
+	a.FishBorn += b.FishBorn
+	a.FishEaten += b.FishEaten
+	a.FishStarved += b.FishStarved
+	a.SharksMoved += b.SharksMoved
+	a.SharksStayed += b.SharksStayed
+	a.SharksBorn += b.SharksBorn
+	a.SharksEaten += b.SharksEaten
+	a.SharksStarved += b.SharksStarved
+	r.SharkEnergy += other.SharkEnergy
+	r.Events = append(r.Events, other.Events...)
+}
+
+/**
+ * @brief Checks that the counts explain the change in population exactly.
+ *
+ * The fish population must change by the fish born minus the fish eaten
+ * and starved, the shark population by the sharks born minus the sharks
+ * starved and eaten, and every shark alive before the step must have
+ * moved, stayed or starved, unless it was eaten before its turn.
+ *
+ * @param fishBefore The number of fish before the step.
+ * @param sharksBefore The number of sharks before the step.
+ * @param fishAfter The number of fish after the step.
+ * @param sharksAfter The number of sharks after the step.
+ * @return nil if the populations balance, otherwise an error describing
+ *         each discrepancy.
+ */
+func (a Accounting) Check(fishBefore, sharksBefore, fishAfter, sharksAfter int) error {
+	var errs []error
+
+	if want := fishBefore + a.FishBorn - a.FishEaten - a.FishStarved; fishAfter != want {
+		errs = append(errs, fmt.Errorf("fish: %d before + %d born - %d eaten - %d starved = %d, but %d remain",
+			fishBefore, a.FishBorn, a.FishEaten, a.FishStarved, want, fishAfter))
+	}
+	if want := sharksBefore + a.SharksBorn - a.SharksStarved - a.SharksEaten; sharksAfter != want {
+		errs = append(errs, fmt.Errorf("sharks: %d before + %d born - %d starved - %d eaten = %d, but %d remain",
+			sharksBefore, a.SharksBorn, a.SharksStarved, a.SharksEaten, want, sharksAfter))
+	}
+	// Sharks eaten before their turn never act
+	if acted := a.SharksMoved + a.SharksStayed + a.SharksStarved; acted > sharksBefore || acted < sharksBefore-a.SharksEaten {
+		errs = append(errs, fmt.Errorf("sharks: %d moved, stayed or starved, but %d existed and %d were eaten",
+			acted, sharksBefore, a.SharksEaten))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,493 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Names of the sheets written by BenchmarkReport.WriteXLSX
+const (
+	resultsSheet  = "Benchmark Results"
+	runsSheet     = "Runs"
+	metadataSheet = "Metadata"
+)
+
+// BenchmarkOptions controls how BenchmarkSimulation measures each thread count
+type BenchmarkOptions struct {
+	Steps        int   // simulation steps per run
+	Warmups      int   // unmeasured runs before the measured ones
+	Repetitions  int   // measured runs per thread count
+	ThreadCounts []int // thread counts to measure
+}
+
+// BenchmarkResult summarises the measured runs of one thread count. Times
+// are in seconds. Speedup and efficiency compare the mean time against the
+// mean time of a single thread, and the throughput counts only the water
+// cells, which are all the simulation works on.
+type BenchmarkResult struct {
+	Threads        int
+	Times          []float64
+	Mean           float64
+	Median         float64
+	StdDev         float64
+	Min            float64
+	Speedup        float64
+	Efficiency     float64
+	StepsPerSecond float64
+	CellsPerSecond float64
+}
+
+// benchmarkRun times one run of a benchmark; tests replace it to control
+// the times measured
+var benchmarkRun = timeRun
+
+// BenchmarkReport is everything needed to interpret a benchmark later: the
+// parameters, the machine it ran on and the results of each thread count.
+type BenchmarkReport struct {
+	Config     Config
+	Options    BenchmarkOptions
+	Started    time.Time
+	GoVersion  string
+	GOOS       string
+	GOARCH     string
+	NumCPU     int
+	GOMAXPROCS int
+	CPUModel   string
+	Results    []BenchmarkResult
+}
+
+/**
+ * @brief Returns the benchmark options used when none are given.
+ *
+ * @return 100 steps, one warmup and five measured runs on 1, 2, 4 and 8 threads.
+ */
+func DefaultBenchmarkOptions() BenchmarkOptions {
+	return BenchmarkOptions{
+		Steps:        100,
+		Warmups:      1,
+		Repetitions:  5,
+		ThreadCounts: []int{1, 2, 4, 8},
+	}
+}
+
+/**
+ * @brief Checks that the options describe a benchmark that can be run.
+ *
+ * @return nil if the options are valid; otherwise an error describing each
+ *         invalid option.
+ */
+func (o BenchmarkOptions) Validate() error {
+	var errs []error
+
+	if o.Steps < 1 {
+		errs = append(errs, fmt.Errorf("steps must be at least 1, got %d", o.Steps))
+	}
+	if o.Warmups < 0 {
+		errs = append(errs, fmt.Errorf("warmups must not be negative, got %d", o.Warmups))
+	}
+	if o.Repetitions < 1 {
+		errs = append(errs, fmt.Errorf("repetitions must be at least 1, got %d", o.Repetitions))
+	}
+	if len(o.ThreadCounts) == 0 {
+		errs = append(errs, errors.New("no thread counts given"))
+	}
+	for _, n := range o.ThreadCounts {
+		if n < 1 {
+			errs = append(errs, fmt.Errorf("thread counts must be at least 1, got %d", n))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid benchmark options: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+/**
+ * @brief Benchmarks the performance of a simulation using different thread counts.
+ *
+ * This function performs the following steps:
+ * 1. Adds a single thread to the thread counts if it is missing, as every
+ *    speedup is measured against it.
+ * 2. For each thread count, runs the configured number of warmup runs and
+ *    then the measured runs, each starting from a new simulation and taking
+ *    the given number of steps.
+ * 3. Calculates the mean, median, standard deviation and minimum of the
+ *    measured times, the speedup and parallel efficiency against one
+ *    thread, and the throughput in steps and water cells per second.
+ *
+ * Every run starts from the same grid, built from the configured seed, and
+ * since the result of a step does not depend on the thread count, every
+ * run performs exactly the same work.
+ *
+ * @param cfg The simulation parameters used for every run.
+ * @param opts How many steps, warmups and repetitions to run and on which
+ *             thread counts.
+ * @return The report of the benchmark, or an error if the configuration or
+ *         options are invalid.
+ */
+func BenchmarkSimulation(cfg Config, opts BenchmarkOptions) (BenchmarkReport, error) {
+	if err := cfg.Validate(); err != nil {
+		return BenchmarkReport{}, err
+	}
+	if err := opts.Validate(); err != nil {
+		return BenchmarkReport{}, err
+	}
+
+	threadCounts := slices.Clone(opts.ThreadCounts)
+	if !slices.Contains(threadCounts, 1) {
+		threadCounts = append([]int{1}, threadCounts...)
+	}
+	opts.ThreadCounts = threadCounts
+
+	report := BenchmarkReport{
+		Config:     cfg,
+		Options:    opts,
+		Started:    time.Now(),
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		CPUModel:   cpuModel(),
+	}
+
+	for _, numThreads := range threadCounts {
+		for i := 0; i < opts.Warmups; i++ {
+			if _, err := benchmarkRun(cfg, numThreads, opts.Steps); err != nil {
+				return BenchmarkReport{}, err
+			}
+		}
+
+		result := BenchmarkResult{Threads: numThreads}
+		for i := 0; i < opts.Repetitions; i++ {
+			duration, err := benchmarkRun(cfg, numThreads, opts.Steps)
+			if err != nil {
+				return BenchmarkReport{}, err
+			}
+			result.Times = append(result.Times, duration)
+		}
+		summarise(&result, opts.Steps, cfg.WaterCells())
+		report.Results = append(report.Results, result)
+	}
+
+	// Speedup and efficiency against the single thread run
+	baseline := report.Results[slices.Index(threadCounts, 1)].Mean
+	for i := range report.Results {
+		result := &report.Results[i]
+		result.Speedup = baseline / result.Mean
+		result.Efficiency = result.Speedup / float64(result.Threads)
+	}
+
+	return report, nil
+}
+
+/**
+ * @brief Times a single run of the simulation.
+ *
+ * The grid is built before the clock starts, and the world is stepped
+ * directly rather than through the Simulation, so only the steps are timed
+ * and not the statistics a Simulation records after each one.
+ *
+ * @param cfg The simulation parameters.
+ * @param numThreads The number of threads to run with.
+ * @param steps The number of steps to take.
+ * @return The time taken in seconds, or an error if the simulation could
+ *         not be created.
+ */
+func timeRun(cfg Config, numThreads, steps int) (float64, error) {
+	sim, err := NewSimulation(cfg, numThreads)
+	if err != nil {
+		return 0, err
+	}
+
+	startTime := time.Now()
+	for step := 0; step < steps; step++ {
+		UpdateSimulation(cfg, sim.world, numThreads, step)
+	}
+	return time.Since(startTime).Seconds(), nil
+}
+
+/**
+ * @brief Fills in the summary statistics of a result from its times.
+ *
+ * @param result The result whose Times have been measured.
+ * @param steps The number of steps in each run.
+ * @param cells The number of water cells in the grid, leaving out land.
+ */
+func summarise(result *BenchmarkResult, steps, cells int) {
+	times := slices.Clone(result.Times)
+	slices.Sort(times)
+	n := len(times)
+
+	sum := 0.0
+	for _, t := range times {
+		sum += t
+	}
+	result.Mean = sum / float64(n)
+	result.Min = times[0]
+	if n%2 == 1 {
+		result.Median = times[n/2]
+	} else {
+		result.Median = (times[n/2-1] + times[n/2]) / 2
+	}
+
+	// Sample standard deviation, which is zero for a single run
+	if n > 1 {
+		squares := 0.0
+		for _, t := range times {
+			squares += (t - result.Mean) * (t - result.Mean)
+		}
+		result.StdDev = math.Sqrt(squares / float64(n-1))
+	}
+
+	result.StepsPerSecond = float64(steps) / result.Median
+	result.CellsPerSecond = float64(steps) * float64(cells) / result.Median
+}
+
+/**
+ * @brief Returns the model name of the processor, if it can be found.
+ *
+ * The name is read from /proc/cpuinfo, so it is only available on Linux.
+ *
+ * @return The processor model, or "unknown".
+ */
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return "unknown"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if found && strings.TrimSpace(key) == "model name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return "unknown"
+}
+
+/**
+ * @brief Saves the report to a XLSX file.
+ *
+ * The file has three sheets: the summary of each thread count, the time of
+ * every measured run, and the metadata describing the parameters and the
+ * machine the benchmark ran on.
+ *
+ * @param outputFile The path to the XLSX file where the results will be saved.
+ * @return nil if the file was saved, otherwise the error that stopped it.
+ */
+func (r BenchmarkReport) WriteXLSX(outputFile string) error {
+	// Create a new Excel file
+	f := excelize.NewFile()
+	defer f.Close()
+
+	index, err := f.NewSheet(resultsSheet)
+	if err != nil {
+		return fmt.Errorf("creating sheet: %w", err)
+	}
+	if _, err := f.NewSheet(runsSheet); err != nil {
+		return fmt.Errorf("creating sheet: %w", err)
+	}
+	if _, err := f.NewSheet(metadataSheet); err != nil {
+		return fmt.Errorf("creating sheet: %w", err)
+	}
+
+	// Summary of each thread count
+	writeRow(f, resultsSheet, 1, "Threads", "Mean (seconds)", "Median (seconds)", "Std Dev (seconds)",
+		"Min (seconds)", "Speedup", "Efficiency", "Steps/second", "Water cells/second")
+	for i, result := range r.Results {
+		writeRow(f, resultsSheet, i+2, result.Threads, result.Mean, result.Median, result.StdDev,
+			result.Min, result.Speedup, result.Efficiency, result.StepsPerSecond, result.CellsPerSecond)
+	}
+
+	// Every measured run
+	writeRow(f, runsSheet, 1, "Threads", "Repetition", "Time (seconds)")
+	row := 2
+	for _, result := range r.Results {
+		for rep, t := range result.Times {
+			writeRow(f, runsSheet, row, result.Threads, rep+1, t)
+			row++
+		}
+	}
+
+	// Parameters and machine
+	metadata := [][2]any{
+		{"Started", r.Started.Format(time.RFC3339)},
+		{"Go version", r.GoVersion},
+		{"OS", r.GOOS},
+		{"Architecture", r.GOARCH},
+		{"CPU model", r.CPUModel},
+		{"Logical CPUs", r.NumCPU},
+		{"GOMAXPROCS", r.GOMAXPROCS},
+		{"Seed", r.Config.Seed},
+		{"Grid width", r.Config.GridWidth},
+		{"Grid height", r.Config.GridHeight},
+		{"Boundary", r.Config.Boundary.String()},
+		{"Neighbourhood", r.Config.Neighbourhood.String()},
+		{"Radius", r.Config.Radius},
+		{"Initial fish", r.Config.InitialFishCount},
+		{"Initial sharks", r.Config.InitialSharkCount},
+		{"Fish breed time", r.Config.FishBreedTime},
+		{"Shark breed time", r.Config.SharkBreedTime},
+		{"Shark starve time", r.Config.SharkStarveTime},
+		{"Shark energy model", r.Config.SharkEnergyModel},
+		{"Shark initial energy", r.Config.SharkInitialEnergy},
+		{"Shark energy per fish", r.Config.SharkEnergyPerFish},
+		{"Shark max energy", r.Config.SharkMaxEnergy},
+		{"Shark move cost", r.Config.SharkMoveCost},
+		{"Food web", foodWebNames(r.Config.FoodWeb)},
+		{"Environment", environmentNames(r.Config.Environment)},
+		{"Map", mapDescription(r.Config.Map)},
+		{"Water cells", r.Config.WaterCells()},
+		{"Placement", r.Config.Placement.Kind.String()},
+		{"Placement parameters", placementParameters(r.Config.Placement)},
+		{"Steps per run", r.Options.Steps},
+		{"Warmup runs", r.Options.Warmups},
+		{"Measured runs", r.Options.Repetitions},
+	}
+	for i, entry := range metadata {
+		writeRow(f, metadataSheet, i+1, entry[0], entry[1])
+	}
+
+	// Set the active sheet and drop the empty default one
+	f.SetActiveSheet(index)
+	if err := f.DeleteSheet("Sheet1"); err != nil {
+		return fmt.Errorf("removing default sheet: %w", err)
+	}
+
+	// Save the Excel file
+	if err := f.SaveAs(outputFile); err != nil {
+		return fmt.Errorf("saving %s: %w", outputFile, err)
+	}
+	return nil
+}
+
+/**
+ * @brief Writes values into consecutive columns of a row, starting at column A.
+ *
+ * @param f The workbook to write to.
+ * @param sheet The name of the sheet.
+ * @param row The row number, counting from one.
+ * @param values The values to write.
+ */
+func writeRow(f *excelize.File, sheet string, row int, values ...any) {
+	for col, value := range values {
+		cell, _ := excelize.CoordinatesToCellName(col+1, row)
+		f.SetCellValue(sheet, cell, value)
+	}
+}
+
+/**
+ * @brief Benchmarks the simulation and saves the results to a XLSX file.
+ *
+ * This is BenchmarkSimulation followed by BenchmarkReport.WriteXLSX.
+ *
+ * @param cfg The simulation parameters used for every run.
+ * @param opts How many steps, warmups and repetitions to run and on which
+ *             thread counts.
+ * @param outputFile The path to the XLSX file where the results will be saved.
+ * @return The report of the benchmark, or the error that stopped it.
+ */
+func BenchmarkSimulationToXLSX(cfg Config, opts BenchmarkOptions, outputFile string) (BenchmarkReport, error) {
+	report, err := BenchmarkSimulation(cfg, opts)
+	if err != nil {
+		return BenchmarkReport{}, err
+	}
+	if err := report.WriteXLSX(outputFile); err != nil {
+		return BenchmarkReport{}, err
+	}
+	return report, nil
+}
+
+/**
+ * @brief Lists the species of a food web for the metadata sheet.
+ *
+ * @param web The species of the web.
+ * @return The names separated by commas, or "none" without a web.
+ */
+func foodWebNames(web []SpeciesConfig) string {
+	if len(web) == 0 {
+		return "none"
+	}
+	names := make([]string, len(web))
+	for i, s := range web {
+		names[i] = s.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+/**
+ * @brief Lists the maps of an environment for the metadata sheet.
+ *
+ * @param env The environment, or nil.
+ * @return The kinds of map separated by commas, or "none" without any.
+ */
+func environmentNames(env *Environment) string {
+	var names []string
+	if env != nil && env.Nutrients != nil {
+		names = append(names, fmt.Sprintf("nutrients (regrowth %g)", env.NutrientRegrowth))
+	}
+	if env != nil && env.Temperature != nil {
+		names = append(names, "temperature")
+	}
+	if env != nil && env.CurrentX != nil {
+		names = append(names, "currents")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+/**
+ * @brief Describes the world map of a run for the metadata sheet.
+ *
+ * @param m The map, or nil.
+ * @return The size of the map and the number of land cells in it, or
+ *         "none".
+ */
+func mapDescription(m *WorldMap) string {
+	if m == nil {
+		return "none"
+	}
+	land := 0
+	for _, cellType := range m.Cells {
+		if cellType == Land {
+			land++
+		}
+	}
+	return fmt.Sprintf("%dx%d, %d land cells", m.Rows, m.Cols, land)
+}
+
+/**
+ * @brief Lists the parameters of a placement for the metadata sheet.
+ *
+ * @param p The placement.
+ * @return The parameters the placement's kind uses, or "none".
+ */
+func placementParameters(p Placement) string {
+	switch p.Kind {
+	case Clustered:
+		return fmt.Sprintf("%d clusters, spread %g", p.Clusters, p.Spread)
+	case Stripes:
+		return fmt.Sprintf("stripe width %d", p.StripeWidth)
+	case Image:
+		if p.Density != nil {
+			return fmt.Sprintf("%dx%d density map", p.Density.Rows, p.Density.Cols)
+		}
+	}
+	return "none"
+}
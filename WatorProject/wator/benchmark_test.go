@@ -0,0 +1,101 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestSummarise(t *testing.T) {
+	result := BenchmarkResult{Times: []float64{3, 1, 2, 4}}
+	summarise(&result, 10, 100)
+	if result.Mean != 2.5 || result.Median != 2.5 || result.Min != 1 {
+		t.Errorf("even runs: mean %g, median %g, min %g, want 2.5, 2.5 and 1", result.Mean, result.Median, result.Min)
+	}
+	if want := math.Sqrt(5.0 / 3); math.Abs(result.StdDev-want) > 1e-12 {
+		t.Errorf("stddev %g, want the sample deviation %g", result.StdDev, want)
+	}
+	if result.StepsPerSecond != 4 || result.CellsPerSecond != 400 {
+		t.Errorf("throughput %g steps/s and %g cells/s, want 4 and 400", result.StepsPerSecond, result.CellsPerSecond)
+	}
+	if !slices.Equal(result.Times, []float64{3, 1, 2, 4}) {
+		t.Errorf("times were reordered to %v", result.Times)
+	}
+
+	result = BenchmarkResult{Times: []float64{5, 1, 3}}
+	summarise(&result, 1, 1)
+	if result.Median != 3 || result.Mean != 3 || result.StdDev != 2 {
+		t.Errorf("odd runs: median %g, mean %g, stddev %g, want 3, 3 and 2", result.Median, result.Mean, result.StdDev)
+	}
+
+	result = BenchmarkResult{Times: []float64{2}}
+	summarise(&result, 1, 1)
+	if result.StdDev != 0 || result.Median != 2 {
+		t.Errorf("single run: median %g, stddev %g", result.Median, result.StdDev)
+	}
+}
+
+func TestBenchmarkSimulation(t *testing.T) {
+	cfg := testConfig(10)
+	cfg.Seed = 7
+	cfg.InitialFishCount, cfg.InitialSharkCount = 20, 5
+	cfg.Map = &WorldMap{Rows: 10, Cols: 10, Cells: make([]CellType, 100)}
+	for i := 0; i < 20; i++ {
+		cfg.Map.Cells[i] = Land
+	}
+
+	// Each thread count takes the same times scaled down by the count, with
+	// a slow first run so the mean and median differ
+	var seeds []int64
+	benchmarkRun = func(c Config, numThreads, steps int) (float64, error) {
+		seeds = append(seeds, c.Seed)
+		scale := 1 / float64(numThreads)
+		if len(seeds)%3 == 1 {
+			return 7 * scale, nil
+		}
+		return scale, nil
+	}
+	defer func() { benchmarkRun = timeRun }()
+
+	opts := BenchmarkOptions{Steps: 5, Warmups: 0, Repetitions: 3, ThreadCounts: []int{4, 2}}
+	report, err := BenchmarkSimulation(cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var threads []int
+	for _, result := range report.Results {
+		threads = append(threads, result.Threads)
+	}
+	if !slices.Equal(threads, []int{1, 4, 2}) {
+		t.Fatalf("thread counts %v, want a single thread added first", threads)
+	}
+	for _, seed := range seeds {
+		if seed != 7 {
+			t.Fatalf("runs used seeds %v, want 7 for every thread count", seeds)
+		}
+	}
+
+	baseline := report.Results[0].Mean
+	for _, result := range report.Results {
+		if result.Mean != 3/float64(result.Threads) || result.Median != 1/float64(result.Threads) {
+			t.Errorf("%d threads: mean %g, median %g", result.Threads, result.Mean, result.Median)
+		}
+		if math.Abs(result.Speedup-baseline/result.Mean) > 1e-12 || math.Abs(result.Speedup-float64(result.Threads)) > 1e-12 {
+			t.Errorf("%d threads: speedup %g, want %d against the single thread mean", result.Threads, result.Speedup, result.Threads)
+		}
+		if math.Abs(result.Efficiency-1) > 1e-12 {
+			t.Errorf("%d threads: efficiency %g, want 1", result.Threads, result.Efficiency)
+		}
+		if want := 5 * 80 / result.Median; math.Abs(result.CellsPerSecond-want) > 1e-9 {
+			t.Errorf("%d threads: %g cells/s, want %g counting only the 80 water cells", result.Threads, result.CellsPerSecond, want)
+		}
+	}
+
+	// The real timer runs too, on a grid with land
+	benchmarkRun = timeRun
+	opts = BenchmarkOptions{Steps: 2, Warmups: 1, Repetitions: 1, ThreadCounts: []int{2}}
+	if report, err = BenchmarkSimulation(cfg, opts); err != nil || len(report.Results) != 2 {
+		t.Fatalf("real runs: %d results, error %v", len(report.Results), err)
+	}
+}
@@ -0,0 +1,116 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import "fmt"
+
+// Boundary selects what lies beyond the edges of the grid
+type Boundary int
+
+const (
+	// Torus wraps each edge round to the opposite edge, so every cell has
+	// the same number of neighbours. This is the classic Wator ocean.
+	Torus Boundary = iota
+	// Walls closes the ocean: cells beyond the edge do not exist, so edge
+	// cells have fewer neighbours and entities cannot cross the edge.
+	Walls
+	// Reflective bounces a step off the edge back into the grid, so the
+	// neighbour beyond the edge is replaced by the one on the opposite side
+	// of the cell and edge cells are more likely to move away from the edge.
+	Reflective
+)
+
+/**
+ * @brief Returns the name of the boundary mode.
+ *
+ * @return "torus", "walls" or "reflective".
+ */
+func (b Boundary) String() string {
+	switch b {
+	case Torus:
+		return "torus"
+	case Walls:
+		return "walls"
+	case Reflective:
+		return "reflective"
+	}
+	return fmt.Sprintf("Boundary(%d)", int(b))
+}
+
+/**
+ * @brief Parses the name of a boundary mode.
+ *
+ * @param name One of the names returned by Boundary.String.
+ * @return The boundary mode, or an error if the name is not known.
+ */
+func ParseBoundary(name string) (Boundary, error) {
+	for _, b := range []Boundary{Torus, Walls, Reflective} {
+		if name == b.String() {
+			return b, nil
+		}
+	}
+	return Torus, fmt.Errorf("unknown boundary %q (want torus, walls or reflective)", name)
+}
+
+/**
+ * @brief Encodes the boundary mode by name, so configs saved as JSON stay
+ *        readable.
+ *
+ * @return The name of the mode.
+ */
+func (b Boundary) MarshalText() ([]byte, error) {
+	if !b.valid() {
+		return nil, fmt.Errorf("unknown boundary %d", int(b))
+	}
+	return []byte(b.String()), nil
+}
+
+/**
+ * @brief Decodes a boundary mode from its name.
+ *
+ * @param text The name of the mode.
+ * @return nil on success, or an error if the name is not known.
+ */
+func (b *Boundary) UnmarshalText(text []byte) error {
+	parsed, err := ParseBoundary(string(text))
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
+
+/**
+ * @brief Reports whether the boundary is one of the defined modes.
+ *
+ * @return true for Torus, Walls and Reflective.
+ */
+func (b Boundary) valid() bool {
+	return b >= Torus && b <= Reflective
+}
+
+/**
+ * @brief Maps a coordinate that may lie beyond the grid back onto it.
+ *
+ * @param c The row or column to map.
+ * @param n The number of rows or columns along that axis.
+ * @return The coordinate on the grid, and false if the cell does not exist.
+ */
+func (b Boundary) resolve(c, n int) (int, bool) {
+	if c >= 0 && c < n {
+		return c, true
+	}
+
+	switch b {
+	case Walls:
+		return c, false
+	case Reflective:
+		// Step back across the edge by as far as the move went beyond it
+		if c < 0 {
+			c = -c
+		} else {
+			c = 2*(n-1) - c
+		}
+		return c, c >= 0 && c < n
+	}
+	return (c%n + n) % n, true
+}
@@ -0,0 +1,332 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Default parameter values used by DefaultConfig
+const (
+	DefaultScreenWidth       = 500
+	DefaultScreenHeight      = 500
+	DefaultGridWidth         = 50
+	DefaultGridHeight        = 50
+	DefaultInitialFishCount  = 200
+	DefaultInitialSharkCount = 50
+	DefaultFishBreedTime     = 5
+	DefaultSharkBreedTime    = 8
+	DefaultSharkStarveTime   = 5
+	DefaultRadius            = 1
+	DefaultSharkEnergy       = 5
+	DefaultEnergyPerFish     = 2
+	DefaultSharkMaxEnergy    = 10
+	DefaultSharkMoveCost     = 1
+)
+
+type Config struct {
+	ScreenWidth       int `json:"screenWidth"`
+	ScreenHeight      int `json:"screenHeight"`
+	GridWidth         int `json:"gridWidth"`
+	GridHeight        int `json:"gridHeight"`
+	InitialFishCount  int `json:"initialFishCount"`
+	InitialSharkCount int `json:"initialSharkCount"`
+	FishBreedTime     int `json:"fishBreedTime"`
+	SharkBreedTime    int `json:"sharkBreedTime"`
+	SharkStarveTime   int `json:"sharkStarveTime"`
+	// Boundary is what happens at the edges of the grid; the zero value
+	// is the wraparound Torus.
+	Boundary Boundary `json:"boundary"`
+	// Neighbourhood is the shape of the cells an entity can see and move
+	// to, and Radius how far it reaches.
+	Neighbourhood NeighbourhoodKind `json:"neighbourhood"`
+	Radius        int               `json:"radius"`
+	// SharkEnergyModel replaces the starvation counter with energy. A shark
+	// starts with SharkInitialEnergy, spends SharkMoveCost each time it
+	// moves but nothing when it stays put, gains SharkEnergyPerFish for each
+	// fish it eats up to SharkMaxEnergy, and shares its energy with its
+	// young when it breeds. SharkStarveTime is not used while it is on.
+	SharkEnergyModel   bool `json:"sharkEnergyModel"`
+	SharkInitialEnergy int  `json:"sharkInitialEnergy"`
+	SharkEnergyPerFish int  `json:"sharkEnergyPerFish"`
+	SharkMaxEnergy     int  `json:"sharkMaxEnergy"`
+	SharkMoveCost      int  `json:"sharkMoveCost"`
+	// Seed makes a run reproducible: the same seed and parameters always
+	// produce the same sequence of grids, whatever the thread count.
+	Seed int64 `json:"seed"`
+	// Source creates the random number generators; nil uses the built-in
+	// SplitMix64 generator. It is not saved in snapshots.
+	Source SourceFactory `json:"-"`
+	// FoodWeb, if not empty, replaces the fish and sharks with the species
+	// it lists (see NewFoodWebRules), each with its own parameters.
+	FoodWeb []SpeciesConfig `json:"foodWeb,omitempty"`
+	// Environment holds maps of nutrients, temperature and currents; nil
+	// leaves the ocean the same everywhere.
+	Environment *Environment `json:"environment,omitempty"`
+	// Map, if set, puts land and the first fish and sharks in the grid
+	// before the initial counts are placed in the water left.
+	Map *WorldMap `json:"map,omitempty"`
+	// Placement is how the initial counts are spread over the grid.
+	Placement Placement `json:"placement"`
+	// Rules are the species living in the grid; nil uses the FoodWeb, or
+	// DefaultRules, the fish and sharks, if there is none. They are not
+	// saved in snapshots.
+	Rules *Rules `json:"-"`
+}
+
+/**
+ * @brief Returns the default simulation configuration.
+ *
+ * The values match the parameters the simulation was originally written
+ * with: a 50x50 toroidal grid of von Neumann neighbourhoods drawn in a
+ * 500x500 window, 200 fish and 50 sharks placed uniformly at random. The
+ * shark energy model is off, but its parameters are filled in so it only
+ * needs switching on, as are those of the other kinds of placement.
+ * The seed is zero, so callers wanting a different run each time must set it.
+ *
+ * @return A Config populated with the default parameters.
+ */
+func DefaultConfig() Config {
+	return Config{
+		ScreenWidth:        DefaultScreenWidth,
+		ScreenHeight:       DefaultScreenHeight,
+		GridWidth:          DefaultGridWidth,
+		GridHeight:         DefaultGridHeight,
+		InitialFishCount:   DefaultInitialFishCount,
+		InitialSharkCount:  DefaultInitialSharkCount,
+		FishBreedTime:      DefaultFishBreedTime,
+		SharkBreedTime:     DefaultSharkBreedTime,
+		SharkStarveTime:    DefaultSharkStarveTime,
+		Radius:             DefaultRadius,
+		SharkInitialEnergy: DefaultSharkEnergy,
+		SharkEnergyPerFish: DefaultEnergyPerFish,
+		SharkMaxEnergy:     DefaultSharkMaxEnergy,
+		SharkMoveCost:      DefaultSharkMoveCost,
+		Placement: Placement{
+			Clusters:    DefaultClusters,
+			Spread:      DefaultClusterSpread,
+			StripeWidth: DefaultStripeWidth,
+		},
+	}
+}
+
+/**
+ * @brief Returns the default configuration on a square grid of another size.
+ *
+ * The initial counts are scaled with the number of cells, so the grid is
+ * as densely populated as the default one and runs on grids of different
+ * sizes, such as those of the benchmarks, can be compared.
+ *
+ * @param size The number of cells along each side of the grid.
+ * @return The scaled configuration.
+ */
+func ScaledConfig(size int) Config {
+	cfg := DefaultConfig()
+	cfg.GridWidth, cfg.GridHeight = size, size
+	cfg.InitialFishCount = size * size * DefaultInitialFishCount / (DefaultGridWidth * DefaultGridHeight)
+	cfg.InitialSharkCount = size * size * DefaultInitialSharkCount / (DefaultGridWidth * DefaultGridHeight)
+	return cfg
+}
+
+/**
+ * @brief Checks that the configuration describes a runnable simulation.
+ *
+ * Every problem found is reported, so a caller fixing a bad configuration
+ * sees all of the offending parameters at once rather than one per run.
+ *
+ * @return nil if the configuration is valid; otherwise an error describing
+ *         each invalid parameter.
+ */
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.ScreenWidth <= 0 || c.ScreenHeight <= 0 {
+		errs = append(errs, fmt.Errorf("screen size must be positive, got %dx%d", c.ScreenWidth, c.ScreenHeight))
+	}
+	if c.GridWidth <= 0 || c.GridHeight <= 0 {
+		errs = append(errs, fmt.Errorf("grid size must be positive, got %dx%d", c.GridWidth, c.GridHeight))
+	}
+	if c.Rules == nil && len(c.FoodWeb) > 0 {
+		if _, err := NewFoodWebRules(c.FoodWeb); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	rules, population := c.rules(), 0
+	for _, t := range rules.Types() {
+		species := rules.Species(t)
+		count := species.InitialCount(c)
+		if count < 0 {
+			errs = append(errs, fmt.Errorf("initial %s count must not be negative, got %d", species.Name(), count))
+		}
+		population += count
+	}
+	if c.Map != nil {
+		errs = append(errs, c.Map.validate(c)...)
+		_, mapped := c.Map.count()
+		population += mapped
+	}
+	population += c.Placement.started()
+	if c.GridWidth > 0 && c.GridHeight > 0 && population > c.WaterCells() {
+		errs = append(errs, fmt.Errorf("%d entities do not fit in the %d water cells of a %dx%d grid",
+			population, c.WaterCells(), c.GridWidth, c.GridHeight))
+	}
+	// The counters are kept in int32 columns of the grid, so a larger time
+	// would wrap round to a negative counter
+	for _, counter := range []struct {
+		name  string
+		value int
+	}{
+		{"fish breed time", c.FishBreedTime},
+		{"shark breed time", c.SharkBreedTime},
+		{"shark starve time", c.SharkStarveTime},
+	} {
+		if counter.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %d", counter.name, counter.value))
+		} else if counter.value > math.MaxInt32 {
+			errs = append(errs, fmt.Errorf("%s must be at most %d, got %d", counter.name, math.MaxInt32, counter.value))
+		}
+	}
+	if c.SharkEnergyModel {
+		errs = append(errs, c.validateEnergy()...)
+	}
+	if c.Environment != nil {
+		errs = append(errs, c.Environment.validate()...)
+	}
+	errs = append(errs, c.Placement.validate(c)...)
+	if !c.Boundary.valid() {
+		errs = append(errs, fmt.Errorf("unknown boundary %d", int(c.Boundary)))
+	}
+	if !c.Neighbourhood.valid() {
+		errs = append(errs, fmt.Errorf("unknown neighbourhood %d", int(c.Neighbourhood)))
+	}
+	if c.Radius < 1 {
+		errs = append(errs, fmt.Errorf("neighbourhood radius must be at least 1, got %d", c.Radius))
+	}
+	if c.Neighbourhood == Hexagonal && c.Boundary == Torus && c.GridHeight%2 != 0 {
+		// Odd rows are shifted, so wrapping needs the first and last rows to differ in parity
+		errs = append(errs, fmt.Errorf("a hexagonal torus needs an even grid height, got %d", c.GridHeight))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid wator config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+/**
+ * @brief Checks the parameters of the shark energy model.
+ *
+ * @return An error for each invalid parameter.
+ */
+func (c Config) validateEnergy() []error {
+	var errs []error
+	if c.SharkInitialEnergy <= 0 {
+		errs = append(errs, fmt.Errorf("shark initial energy must be positive, got %d", c.SharkInitialEnergy))
+	}
+	if c.SharkEnergyPerFish <= 0 {
+		errs = append(errs, fmt.Errorf("shark energy per fish must be positive, got %d", c.SharkEnergyPerFish))
+	}
+	if c.SharkMaxEnergy < c.SharkInitialEnergy {
+		errs = append(errs, fmt.Errorf("shark max energy must be at least the initial energy %d, got %d",
+			c.SharkInitialEnergy, c.SharkMaxEnergy))
+	}
+	if c.SharkMaxEnergy > math.MaxInt32 {
+		errs = append(errs, fmt.Errorf("shark max energy must be at most %d, got %d", math.MaxInt32, c.SharkMaxEnergy))
+	}
+	if c.SharkMoveCost <= 0 {
+		// A free move would let a shark that never eats live for ever
+		errs = append(errs, fmt.Errorf("shark move cost must be positive, got %d", c.SharkMoveCost))
+	}
+	return errs
+}
+
+/**
+ * @brief Returns the rules the configuration runs with.
+ *
+ * Rules for a food web are built afresh on every call, so callers that
+ * need them repeatedly should keep them.
+ *
+ * @return Rules if it is set, otherwise the rules of the FoodWeb, or the
+ *         built-in fish and shark rules if there is no valid web.
+ */
+func (c Config) rules() *Rules {
+	if c.Rules != nil {
+		return c.Rules
+	}
+	if len(c.FoodWeb) > 0 {
+		// An invalid web is reported by Validate
+		if rules, err := NewFoodWebRules(c.FoodWeb); err == nil {
+			return rules
+		}
+	}
+	return builtinRules
+}
+
+/**
+ * @brief Returns the number of cells in the grid.
+ *
+ * @return The grid width multiplied by the grid height.
+ */
+func (c Config) Cells() int {
+	return c.GridWidth * c.GridHeight
+}
+
+/**
+ * @brief Returns the number of cells of the grid that are not land.
+ *
+ * @return The number of cells less the land cells of the Map, if any.
+ */
+func (c Config) WaterCells() int {
+	if c.Map == nil {
+		return c.Cells()
+	}
+	land, _ := c.Map.count()
+	return c.Cells() - land
+}
+
+/**
+ * @brief Returns the size of the whole grid measured in cells.
+ *
+ * Square cells make this the number of columns and rows; hexagonal cells
+ * are packed closer vertically and odd rows stick out by half a cell.
+ *
+ * @return The width and height of the grid in units of the cell width.
+ */
+func (c Config) gridExtent() (width, height float64) {
+	if c.Neighbourhood == Hexagonal {
+		return hexExtent(c.GridHeight, c.GridWidth)
+	}
+	return float64(c.GridWidth), float64(c.GridHeight)
+}
+
+/**
+ * @brief Returns the size in pixels of a single grid cell on screen.
+ *
+ * The whole grid is scaled to fit inside the screen while keeping cells
+ * in proportion, so the scale is below one when the grid has more cells
+ * along either side than the screen has pixels.
+ *
+ * @return The width of a cell in pixels, which is also its height unless
+ *         the cells are hexagonal.
+ */
+func (c Config) CellSize() float64 {
+	width, height := c.gridExtent()
+	return min(float64(c.ScreenWidth)/width, float64(c.ScreenHeight)/height)
+}
+
+/**
+ * @brief Returns the size of the window needed to show the whole grid.
+ *
+ * This is the grid scaled by CellSize, so one side matches the configured
+ * screen size and the other is no larger than it.
+ *
+ * @return The width and height of the window in pixels.
+ */
+func (c Config) WindowSize() (width, height int) {
+	scale := c.CellSize()
+	gridWidth, gridHeight := c.gridExtent()
+	width = max(int(math.Round(gridWidth*scale)), 1)
+	height = max(int(math.Round(gridHeight*scale)), 1)
+	return width, height
+}
@@ -0,0 +1,290 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultNutrientRegrowth is the nutrient a cell regains each step
+	DefaultNutrientRegrowth = 0.1
+	// referenceTemperature is the temperature, in °C, at which the
+	// configured breed times apply
+	referenceTemperature = 15
+	// MaxImageTemperature is the temperature, in °C, usually given to a
+	// white pixel of a temperature map, a black one being 0 °C
+	MaxImageTemperature = 30
+	// currentWeightScale turns the weight given to a move by the current
+	// into an integer, so moves can be chosen with Intn
+	currentWeightScale = 16
+)
+
+// Layer is a map holding one value per cell, in row-major order. A layer
+// need not be the size of the grid: it is stretched or shrunk over the grid,
+// each cell taking the value of the nearest point of the map.
+type Layer struct {
+	Rows   int       `json:"rows"`
+	Cols   int       `json:"cols"`
+	Values []float32 `json:"values"`
+}
+
+// Environment holds optional maps of the ocean that make some places better
+// to live in than others. A nil layer leaves the ocean the same everywhere
+// in that respect. An Environment must not be changed once a simulation is
+// using it.
+type Environment struct {
+	// Nutrients is the most nutrient each cell holds. Every cell starts
+	// full and regains NutrientRegrowth each step up to its capacity, and
+	// species that eat nothing in the grid, such as fish, only count
+	// towards breeding on turns they find a unit of nutrient to graze.
+	Nutrients        *Layer  `json:"nutrients,omitempty"`
+	NutrientRegrowth float64 `json:"nutrientRegrowth,omitempty"`
+	// Temperature is in °C. Breeding takes the configured breed time at
+	// 15 °C and half as long for every 10 °C warmer.
+	Temperature *Layer `json:"temperature,omitempty"`
+	// CurrentX and CurrentY are the row and column parts of the current,
+	// which makes moves with it more likely than moves against it. A
+	// current of length one never carries an entity straight against it.
+	CurrentX *Layer `json:"currentX,omitempty"`
+	CurrentY *Layer `json:"currentY,omitempty"`
+}
+
+/**
+ * @brief Reports whether a layer can be stretched over a grid.
+ *
+ * @param name What the layer describes, for error messages.
+ * @return nil if the layer has a positive size and a value for every point,
+ *         all of them finite, otherwise an error.
+ */
+func (l *Layer) validate(name string) error {
+	if l.Rows <= 0 || l.Cols <= 0 || !gridSizeInRange(l.Rows, l.Cols) {
+		return fmt.Errorf("%s map size %dx%d is out of range", name, l.Cols, l.Rows)
+	}
+	if len(l.Values) != l.Rows*l.Cols {
+		return fmt.Errorf("%s map holds %d values, want %d for %dx%d", name, len(l.Values), l.Rows*l.Cols, l.Cols, l.Rows)
+	}
+	for _, v := range l.Values {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return fmt.Errorf("%s map holds %v", name, v)
+		}
+	}
+	return nil
+}
+
+/**
+ * @brief Stretches a layer over a grid.
+ *
+ * @param rows The number of rows in the grid.
+ * @param cols The number of columns in the grid.
+ * @return The value of every cell of the grid, in row-major order.
+ */
+func (l *Layer) resample(rows, cols int) []float32 {
+	values := make([]float32, rows*cols)
+	for x := 0; x < rows; x++ {
+		row := (x*l.Rows + l.Rows/2) / rows
+		for y := 0; y < cols; y++ {
+			values[x*cols+y] = l.Values[row*l.Cols+(y*l.Cols+l.Cols/2)/cols]
+		}
+	}
+	return values
+}
+
+/**
+ * @brief Checks the layers and parameters of an environment.
+ *
+ * @return Every problem found, or nil if there are none.
+ */
+func (e *Environment) validate() []error {
+	var errs []error
+	layers := []struct {
+		name  string
+		layer *Layer
+	}{{"nutrient", e.Nutrients}, {"temperature", e.Temperature}, {"current", e.CurrentX}, {"current", e.CurrentY}}
+	for _, l := range layers {
+		if l.layer != nil {
+			if err := l.layer.validate(l.name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if e.Nutrients != nil {
+		for _, v := range e.Nutrients.Values {
+			if v < 0 {
+				errs = append(errs, fmt.Errorf("nutrient map holds a negative capacity %v", v))
+				break
+			}
+		}
+	}
+	if e.NutrientRegrowth < 0 || math.IsNaN(e.NutrientRegrowth) || math.IsInf(e.NutrientRegrowth, 0) {
+		errs = append(errs, fmt.Errorf("nutrient regrowth must be a non-negative number, got %v", e.NutrientRegrowth))
+	}
+	if (e.CurrentX == nil) != (e.CurrentY == nil) {
+		errs = append(errs, errors.New("a current map needs both its row and column parts"))
+	}
+	return errs
+}
+
+/**
+ * @brief Loads a map of one value per cell from a CSV file or an image.
+ *
+ * Files ending in ".csv" hold one row of the map per line, as comma
+ * separated numbers which are used as they are. Any other file is decoded
+ * as a PNG, JPEG or GIF image whose pixels are mapped from `low` for black
+ * to `high` for white by their brightness.
+ *
+ * @param path The file to read.
+ * @param low The value of a black pixel.
+ * @param high The value of a white pixel.
+ * @return The map, or an error if the file cannot be read or is not a
+ *         rectangular map.
+ */
+func LoadLayer(path string, low, high float64) (*Layer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var layer *Layer
+	if isCSV(path) {
+		layer, err = readCSVLayer(f, 1)
+	} else {
+		layer, err = readImageLayer(f, 1, func(c color.Color, part int) float32 {
+			grey := color.Gray16Model.Convert(c).(color.Gray16)
+			return float32(low + (high-low)*float64(grey.Y)/0xffff)
+		})
+	}
+	if err == nil {
+		err = layer.validate("the")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return layer, nil
+}
+
+/**
+ * @brief Loads a map of the current from a CSV file or an image.
+ *
+ * Each line of a CSV file holds two numbers per cell, the row part of the
+ * current and then its column part. In an image the green channel is the
+ * row part and the red channel the column part, each mapped from -1 at
+ * zero to 1 at full brightness, so mid grey is still water.
+ *
+ * @param path The file to read.
+ * @return The row and column parts of the current, or an error if the
+ *         file cannot be read or is not a rectangular map.
+ */
+func LoadCurrents(path string) (x, y *Layer, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var pairs *Layer
+	if isCSV(path) {
+		pairs, err = readCSVLayer(f, 2)
+	} else {
+		pairs, err = readImageLayer(f, 2, func(c color.Color, part int) float32 {
+			r, g, _, _ := c.RGBA()
+			channel := [2]uint32{g, r}[part]
+			return float32(channel)/0xffff*2 - 1
+		})
+	}
+	if err == nil {
+		err = pairs.validate("current")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	x = &Layer{Rows: pairs.Rows, Cols: pairs.Cols / 2, Values: make([]float32, len(pairs.Values)/2)}
+	y = &Layer{Rows: x.Rows, Cols: x.Cols, Values: make([]float32, len(x.Values))}
+	for i := range x.Values {
+		x.Values[i], y.Values[i] = pairs.Values[2*i], pairs.Values[2*i+1]
+	}
+	return x, y, nil
+}
+
+/**
+ * @brief Reports whether a map file is in the CSV format.
+ *
+ * @param path The name of the file.
+ * @return true if the name ends in ".csv".
+ */
+func isCSV(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+/**
+ * @brief Reads a map from comma separated numbers.
+ *
+ * @param r Where the map is read from.
+ * @param perCell How many numbers each cell has.
+ * @return The map, with perCell columns per cell, or an error if a value is
+ *         not a number or the lines are not all the same length.
+ */
+func readCSVLayer(r io.Reader, perCell int) (*Layer, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || len(records[0])%perCell != 0 {
+		return nil, fmt.Errorf("map lines must hold %d numbers per cell", perCell)
+	}
+
+	layer := &Layer{Rows: len(records), Cols: len(records[0])}
+	for line, record := range records {
+		for _, field := range record {
+			v, err := strconv.ParseFloat(field, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line+1, err)
+			}
+			layer.Values = append(layer.Values, float32(v))
+		}
+	}
+	return layer, nil
+}
+
+/**
+ * @brief Reads a map from the pixels of an image.
+ *
+ * @param r Where the image is read from.
+ * @param perPixel How many values each pixel has.
+ * @param value Returns one of the values of a pixel.
+ * @return The map, with perPixel columns per pixel, or an error if the
+ *         image cannot be decoded.
+ */
+func readImageLayer(r io.Reader, perPixel int, value func(c color.Color, part int) float32) (*Layer, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	layer := &Layer{Rows: bounds.Dy(), Cols: bounds.Dx() * perPixel, Values: make([]float32, 0, bounds.Dx()*bounds.Dy()*perPixel)}
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			c := img.At(px, py)
+			for part := 0; part < perPixel; part++ {
+				layer.Values = append(layer.Values, value(c, part))
+			}
+		}
+	}
+	return layer, nil
+}
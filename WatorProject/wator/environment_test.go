@@ -0,0 +1,290 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// uniformLayer returns a layer of the given size holding one value
+func uniformLayer(rows, cols int, value float32) *Layer {
+	values := make([]float32, rows*cols)
+	for i := range values {
+		values[i] = value
+	}
+	return &Layer{Rows: rows, Cols: cols, Values: values}
+}
+
+func TestLoadLayerFromCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nutrients.csv")
+	if err := os.WriteFile(path, []byte("0, 0.5, 1\n2, 2.5, 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := LoadLayer(path, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layer.Rows != 2 || layer.Cols != 3 || !slices.Equal(layer.Values, []float32{0, 0.5, 1, 2, 2.5, 3}) {
+		t.Errorf("loaded %+v", layer)
+	}
+
+	if err := os.WriteFile(path, []byte("1, 2\n3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLayer(path, 0, 1); err == nil {
+		t.Error("a map with lines of different lengths should not load")
+	}
+}
+
+func TestLoadLayerFromImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 1))
+	img.SetGray(0, 0, color.Gray{0})
+	img.SetGray(1, 0, color.Gray{255})
+	path := filepath.Join(t.TempDir(), "temperature.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	layer, err := LoadLayer(path, 5, MaxImageTemperature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layer.Rows != 1 || layer.Cols != 2 || !slices.Equal(layer.Values, []float32{5, MaxImageTemperature}) {
+		t.Errorf("loaded %+v, want black at 5 and white at %d", layer, MaxImageTemperature)
+	}
+}
+
+func TestLoadCurrentsFromCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "currents.csv")
+	if err := os.WriteFile(path, []byte("1, 0, 0, -1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	x, y, err := LoadCurrents(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Cols != 2 || !slices.Equal(x.Values, []float32{1, 0}) || !slices.Equal(y.Values, []float32{0, -1}) {
+		t.Errorf("loaded x %+v and y %+v", x, y)
+	}
+}
+
+func TestLayerStretchesOverGrid(t *testing.T) {
+	layer := &Layer{Rows: 2, Cols: 2, Values: []float32{1, 2, 3, 4}}
+	got := layer.resample(4, 4)
+	want := []float32{
+		1, 1, 2, 2,
+		1, 1, 2, 2,
+		3, 3, 4, 4,
+		3, 3, 4, 4,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("resample(4, 4) = %v, want %v", got, want)
+	}
+	if got := layer.resample(1, 1); !slices.Equal(got, []float32{4}) {
+		t.Errorf("resample(1, 1) = %v, want the nearest value", got)
+	}
+}
+
+func TestEnvironmentValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		env  Environment
+		want string
+	}{
+		{"short map", Environment{Nutrients: &Layer{Rows: 2, Cols: 2, Values: []float32{1}}}, "holds 1 values"},
+		{"negative capacity", Environment{Nutrients: uniformLayer(2, 2, -1)}, "negative capacity"},
+		{"negative regrowth", Environment{NutrientRegrowth: -0.5}, "nutrient regrowth"},
+		{"half a current", Environment{CurrentX: uniformLayer(1, 1, 0)}, "both its row and column parts"},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.Environment = &tt.env
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestFishOnlyBreedsWhereItGrazes(t *testing.T) {
+	for _, capacity := range []float32{0, 1} {
+		cfg := testConfig(5)
+		cfg.FishBreedTime = 1
+		cfg.Environment = &Environment{Nutrients: uniformLayer(1, 1, capacity)}
+		world := emptyWorld(5)
+		world.front.Set(2, 2, Entity{Type: Fish})
+
+		TraceSimulation(cfg, world, 1, 0)
+
+		wantFish := 1
+		if capacity > 0 {
+			wantFish = 2
+		}
+		if fish, _ := CountEntities(world.Grid()); fish != wantFish {
+			t.Errorf("capacity %v: %d fish after one step, want %d", capacity, fish, wantFish)
+		}
+		if level, ok := world.Nutrient(2, 2); !ok || level != 0 {
+			t.Errorf("capacity %v: the fish's cell holds %v nutrient, want it grazed out", capacity, level)
+		}
+	}
+}
+
+func TestNutrientRegrowsToCapacity(t *testing.T) {
+	cfg := testConfig(3)
+	cfg.Environment = &Environment{Nutrients: uniformLayer(1, 1, 1), NutrientRegrowth: 0.4}
+	world := emptyWorld(3)
+	world.prepare(cfg)
+	world.nutrients[4] = 0
+
+	for step, want := range []float32{0.4, 0.8, 1, 1} {
+		UpdateSimulation(cfg, world, 1, step)
+		if level, _ := world.Nutrient(1, 1); level < want-1e-6 || level > want+1e-6 {
+			t.Errorf("step %d: nutrient %v, want %v", step, level, want)
+		}
+	}
+}
+
+func TestWarmWaterShortensBreedTime(t *testing.T) {
+	tests := []struct {
+		temperature float32
+		base, want  int
+	}{
+		{referenceTemperature, 8, 8},
+		{referenceTemperature + 10, 8, 4},
+		{referenceTemperature - 10, 8, 16},
+		{referenceTemperature + 40, 8, 1},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(3)
+		cfg.Environment = &Environment{Temperature: uniformLayer(1, 1, tt.temperature)}
+		world := emptyWorld(3)
+		world.front.Set(1, 1, Entity{Type: Fish})
+		var report StepReport
+		turn := world.turn(cfg, 1, 1, newSource(cfg, 1), &report)
+		if got := turn.BreedTime(tt.base); got != tt.want {
+			t.Errorf("BreedTime(%d) at %v °C = %d, want %d", tt.base, tt.temperature, got, tt.want)
+		}
+	}
+}
+
+func TestCurrentBiasesMoves(t *testing.T) {
+	cfg := testConfig(5)
+	// A current of length one flowing to the right
+	cfg.Environment = &Environment{CurrentX: uniformLayer(1, 1, 0), CurrentY: uniformLayer(1, 1, 1)}
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: Fish})
+	rng := newSource(cfg, 7)
+
+	moves := map[[2]int]int{}
+	for i := 0; i < 2000; i++ {
+		var report StepReport
+		turn := world.turn(cfg, 2, 2, rng, &report)
+		to, ok := turn.Pick(emptyCells)
+		if !ok {
+			t.Fatal("no empty neighbour picked")
+		}
+		moves[to]++
+	}
+
+	left, right, up, down := moves[[2]int{2, 1}], moves[[2]int{2, 3}], moves[[2]int{1, 2}], moves[[2]int{3, 2}]
+	if left != 0 {
+		t.Errorf("moved straight against the current %d times", left)
+	}
+	if right < up+down-200 || right > up+down+200 {
+		t.Errorf("moved right %d times, up %d and down %d, want right as often as the other two together",
+			right, up, down)
+	}
+}
+
+func TestEmptyEnvironmentKeepsSeededRuns(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Seed = 12
+	plain, err := NewSimulation(cfg, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Environment = &Environment{NutrientRegrowth: DefaultNutrientRegrowth}
+	withEnvironment, err := NewSimulation(cfg, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain.StepN(30)
+	withEnvironment.StepN(30)
+	if !plain.Grid().Equal(withEnvironment.Grid()) {
+		t.Error("an environment without maps changed the run")
+	}
+}
+
+func TestSnapshotKeepsEnvironment(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.GridWidth, cfg.GridHeight = 20, 10
+	cfg.InitialFishCount, cfg.InitialSharkCount = 60, 10
+	cfg.Seed = 9
+	cfg.Environment = &Environment{
+		Nutrients:        &Layer{Rows: 1, Cols: 2, Values: []float32{0.5, 2}},
+		NutrientRegrowth: 0.25,
+		Temperature:      &Layer{Rows: 2, Cols: 1, Values: []float32{10, 24}},
+		CurrentX:         uniformLayer(1, 1, -0.5),
+		CurrentY:         uniformLayer(1, 1, 0.5),
+	}
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(7)
+
+	formats := map[string]struct {
+		write func(*bytes.Buffer, Snapshot) error
+		read  func(*bytes.Buffer) (Snapshot, error)
+	}{
+		"json": {
+			func(b *bytes.Buffer, s Snapshot) error { return WriteSnapshotJSON(b, s) },
+			func(b *bytes.Buffer) (Snapshot, error) { return ReadSnapshotJSON(b) },
+		},
+		"binary": {
+			func(b *bytes.Buffer, s Snapshot) error { return WriteSnapshotBinary(b, s) },
+			func(b *bytes.Buffer) (Snapshot, error) { return ReadSnapshotBinary(b) },
+		},
+	}
+	for name, format := range formats {
+		var buf bytes.Buffer
+		if err := format.write(&buf, sim.Snapshot()); err != nil {
+			t.Fatalf("%s: write: %v", name, err)
+		}
+		snap, err := format.read(&buf)
+		if err != nil {
+			t.Fatalf("%s: read: %v", name, err)
+		}
+		env := snap.Config.Environment
+		if env == nil || env.NutrientRegrowth != 0.25 || !slices.Equal(env.Temperature.Values, []float32{10, 24}) ||
+			env.CurrentY == nil || env.CurrentY.Values[0] != 0.5 {
+			t.Fatalf("%s: environment = %+v", name, env)
+		}
+		if !slices.Equal(snap.Nutrients, sim.Snapshot().Nutrients) {
+			t.Errorf("%s: nutrient levels differ after round trip", name)
+		}
+
+		original, _ := NewSimulationFromSnapshot(sim.Snapshot(), 1)
+		resumed, err := NewSimulationFromSnapshot(snap, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		original.StepN(5)
+		resumed.StepN(5)
+		if !original.Grid().Equal(resumed.Grid()) {
+			t.Errorf("%s: resumed run with an environment diverged from the original", name)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// SpeciesConfig describes one species of a food web. Every species of a web
+// follows the same rules, shaped by its parameters: it eats a neighbouring
+// prey if it can, otherwise moves to an empty neighbour, starves after
+// StarveTime steps without eating and breeds every BreedTime steps. A
+// stationary species never moves, so it breeds into an empty neighbour
+// instead, which is how plankton regrows over empty cells.
+type SpeciesConfig struct {
+	Name string `json:"name"`
+	// Colour is how the species is drawn, as "#rrggbb"
+	Colour       string `json:"colour,omitempty"`
+	InitialCount int    `json:"initialCount"`
+	BreedTime    int    `json:"breedTime"`
+	// StarveTime is the number of steps the species survives without
+	// eating, or zero if it never starves
+	StarveTime int      `json:"starveTime,omitempty"`
+	Eats       []string `json:"eats,omitempty"`
+	Stationary bool     `json:"stationary,omitempty"`
+}
+
+// Coloured is implemented by species that choose the colour they are drawn in
+type Coloured interface {
+	Colour() color.RGBA
+}
+
+/**
+ * @brief Returns a four level food chain for the default grid.
+ *
+ * Plankton regrows over empty cells, fish eat plankton, sharks eat fish and
+ * orcas eat sharks. Every hunter starves before it can breed, so a species
+ * only lasts as long as its prey does.
+ *
+ * @return The species of the web, which the caller may change.
+ */
+func ExampleFoodWeb() []SpeciesConfig {
+	return []SpeciesConfig{
+		{Name: "plankton", Colour: "#2e8b57", InitialCount: 600, BreedTime: 1, Stationary: true},
+		{Name: "fish", Colour: "#00ff00", InitialCount: 300, BreedTime: 4, StarveTime: 3, Eats: []string{"plankton"}},
+		{Name: "shark", Colour: "#ff0000", InitialCount: 60, BreedTime: 10, StarveTime: 8, Eats: []string{"fish"}},
+		{Name: "orca", Colour: "#4169e1", InitialCount: 20, BreedTime: 43, StarveTime: 40, Eats: []string{"shark"}},
+	}
+}
+
+/**
+ * @brief Loads the species of a food web from a JSON file.
+ *
+ * The file holds an array of species in the layout of SpeciesConfig, e.g.
+ * [{"name": "plankton", "initialCount": 600, "breedTime": 3, "stationary": true}, ...].
+ *
+ * @param path The file to read.
+ * @return The species, or an error if the file cannot be read or does not
+ *         describe a valid food web.
+ */
+func LoadFoodWeb(path string) ([]SpeciesConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var web []SpeciesConfig
+	if err := json.Unmarshal(data, &web); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(web) == 0 {
+		return nil, fmt.Errorf("%s: the food web has no species", path)
+	}
+	if _, err := NewFoodWebRules(web); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return web, nil
+}
+
+/**
+ * @brief Builds the rules of a food web.
+ *
+ * Species are registered in the order they are listed, so the first two
+ * are given the cell types Fish and Shark whatever they are called.
+ *
+ * @param web The species of the web.
+ * @return The rules, or an error describing every problem with the web.
+ */
+func NewFoodWebRules(web []SpeciesConfig) (*Rules, error) {
+	var errs []error
+	names := make([]string, 0, len(web))
+	for _, s := range web {
+		names = append(names, s.Name)
+	}
+
+	rules := NewRules()
+	for i, s := range web {
+		species := &webSpecies{SpeciesConfig: s}
+		var err error
+		if species.colour, err = parseColour(s.Colour); err != nil {
+			errs = append(errs, fmt.Errorf("species %q: %w", s.Name, err))
+		}
+		if s.Name == "" {
+			errs = append(errs, fmt.Errorf("species %d has no name", i))
+		}
+		if s.BreedTime <= 0 {
+			errs = append(errs, fmt.Errorf("species %q: breed time must be positive, got %d", s.Name, s.BreedTime))
+		}
+		if s.StarveTime < 0 {
+			errs = append(errs, fmt.Errorf("species %q: starve time must not be negative, got %d", s.Name, s.StarveTime))
+		}
+		if s.BreedTime > math.MaxInt32 || s.StarveTime > math.MaxInt32 {
+			// Both become counters in the int32 columns of the grid
+			errs = append(errs, fmt.Errorf("species %q: breed and starve times must be at most %d", s.Name, math.MaxInt32))
+		}
+		for _, prey := range s.Eats {
+			if !slices.Contains(names, prey) {
+				errs = append(errs, fmt.Errorf("species %q eats %q, which is not in the food web", s.Name, prey))
+			}
+		}
+		if _, err := rules.Register(species); err != nil && s.Name != "" {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid food web: %w", errors.Join(errs...))
+	}
+	return rules, nil
+}
+
+/**
+ * @brief Parses a colour written as "#rrggbb".
+ *
+ * @param text The colour, or "" for grey.
+ * @return The colour, or an error if it is not written as "#rrggbb".
+ */
+func parseColour(text string) (color.RGBA, error) {
+	if text == "" {
+		return color.RGBA{160, 160, 160, 255}, nil
+	}
+	if len(text) != 7 || text[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("colour %q is not of the form #rrggbb", text)
+	}
+	rgb, err := strconv.ParseUint(text[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("colour %q is not of the form #rrggbb", text)
+	}
+	r, g, b := uint8(rgb>>16), uint8(rgb>>8), uint8(rgb)
+	return color.RGBA{r, g, b, 255}, nil
+}
+
+// webSpecies is a species of a food web, following the rules described by
+// SpeciesConfig
+type webSpecies struct {
+	SpeciesConfig
+	colour color.RGBA
+}
+
+/**
+ * @brief Returns the name of the species.
+ *
+ * @return The configured name.
+ */
+func (s *webSpecies) Name() string {
+	return s.SpeciesConfig.Name
+}
+
+/**
+ * @brief Reports whether the species eats another.
+ *
+ * @param prey The other species.
+ * @return true if the other species is named in Eats.
+ */
+func (s *webSpecies) Eats(prey Species) bool {
+	return slices.Contains(s.SpeciesConfig.Eats, prey.Name())
+}
+
+/**
+ * @brief Returns the number of the species placed in a new grid.
+ *
+ * @param cfg The simulation parameters.
+ * @return The configured initial count.
+ */
+func (s *webSpecies) InitialCount(cfg Config) int {
+	return s.SpeciesConfig.InitialCount
+}
+
+/**
+ * @brief Returns a newly placed or newborn entity of the species.
+ *
+ * @param cfg The simulation parameters.
+ * @return An entity with a full starvation counter.
+ */
+func (s *webSpecies) Newborn(cfg Config) Entity {
+	return Entity{StarveCounter: s.StarveTime}
+}
+
+/**
+ * @brief Returns the colour the species is drawn in.
+ *
+ * @return The configured colour, or grey if none was given.
+ */
+func (s *webSpecies) Colour() color.RGBA {
+	return s.colour
+}
+
+/**
+ * @brief Gives an entity of the species its turn.
+ *
+ * The entity eats a random neighbouring prey if there is one, otherwise a
+ * mobile species moves to a random empty neighbour. A stationary species
+ * eats without moving. An entity that runs out of steps without eating
+ * dies. Once its breed counter reaches the breed time, a mobile entity
+ * that moves leaves a newborn behind and a stationary one puts a newborn
+ * in a random empty neighbour; an entity that cannot do so keeps counting
+ * until it can.
+ *
+ * Under an Environment a species that eats nothing only counts towards
+ * breeding on turns it grazes nutrient from its cell, breed times follow
+ * the temperature and moves and births drift with the current.
+ *
+ * @param t The turn of the entity.
+ */
+func (s *webSpecies) Act(t *Turn) {
+	e := t.Entity()
+	prey := t.Prey()
+	if prey != (CellSet{}) || t.Graze() {
+		e.BreedCounter++
+	}
+	if s.StarveTime > 0 {
+		e.StarveCounter--
+	}
+
+	to := t.Pos()
+	if at, ok := t.Pick(prey); ok {
+		t.Eat(at)
+		e.StarveCounter = s.StarveTime
+		if !s.Stationary {
+			to = at
+		}
+	} else if !s.Stationary {
+		if empty, ok := t.Pick(emptyCells); ok {
+			to = empty
+		}
+	}
+
+	if s.StarveTime > 0 && e.StarveCounter <= 0 {
+		t.Die()
+		return
+	}
+	if e.BreedCounter < t.BreedTime(s.BreedTime) {
+		t.Move(to, e)
+		return
+	}
+
+	// Breed, leaving the newborn behind or beside a stationary parent
+	birthplace := t.Pos()
+	if s.Stationary {
+		var ok bool
+		if birthplace, ok = t.Pick(emptyCells); !ok {
+			t.Stay(e)
+			return
+		}
+	} else if to == t.Pos() {
+		t.Stay(e)
+		return
+	}
+	e.BreedCounter = 0
+	t.Move(to, e)
+	t.Spawn(birthplace, s.Newborn(t.Config))
+}
@@ -0,0 +1,215 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewFoodWebRulesRejectsBadWebs(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(web []SpeciesConfig) []SpeciesConfig
+		want string
+	}{
+		{"unknown prey", func(web []SpeciesConfig) []SpeciesConfig {
+			web[3].Eats = []string{"seal"}
+			return web
+		}, `"orca" eats "seal"`},
+		{"bad colour", func(web []SpeciesConfig) []SpeciesConfig {
+			web[1].Colour = "green"
+			return web
+		}, `colour "green"`},
+		{"duplicate name", func(web []SpeciesConfig) []SpeciesConfig {
+			return append(web, web[1])
+		}, `"fish" is already registered`},
+		{"no breed time", func(web []SpeciesConfig) []SpeciesConfig {
+			web[0].BreedTime = 0
+			return web
+		}, "breed time must be positive"},
+		{"negative starve time", func(web []SpeciesConfig) []SpeciesConfig {
+			web[2].StarveTime = -1
+			return web
+		}, "starve time must not be negative"},
+	}
+	for _, tt := range tests {
+		_, err := NewFoodWebRules(tt.edit(ExampleFoodWeb()))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to mention %s", tt.name, err, tt.want)
+		}
+	}
+
+	rules, err := NewFoodWebRules(ExampleFoodWeb())
+	if err != nil {
+		t.Fatal(err)
+	}
+	orca, _ := rules.Lookup("orca")
+	shark, _ := rules.Lookup("shark")
+	if diets := rules.diets(); !diets[orca].Has(shark) || diets[shark].Has(orca) {
+		t.Error("orcas should eat sharks and not the other way round")
+	}
+}
+
+func TestLoadFoodWeb(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web.json")
+	data := `[{"name": "kelp", "colour": "#008000", "initialCount": 10, "breedTime": 2, "stationary": true},
+	          {"name": "urchin", "initialCount": 5, "breedTime": 6, "starveTime": 4, "eats": ["kelp"]}]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	web, err := LoadFoodWeb(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(web) != 2 || web[1].Name != "urchin" || !slices.Equal(web[1].Eats, []string{"kelp"}) || !web[0].Stationary {
+		t.Errorf("loaded %+v", web)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"name": "urchin", "breedTime": 6, "eats": ["kelp"]}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFoodWeb(path); err == nil {
+		t.Error("a web whose species eats a missing one should not load")
+	}
+}
+
+func TestStationarySpeciesRegrowsIntoEmptyCells(t *testing.T) {
+	cfg := testConfig(5)
+	cfg.FoodWeb = []SpeciesConfig{{Name: "plankton", InitialCount: 0, BreedTime: 1, Stationary: true}}
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: Fish})
+
+	TraceSimulation(cfg, world, 1, 0)
+
+	if got := world.Grid().At(2, 2).Type; got != Fish {
+		t.Errorf("the parent moved to a cell of type %d", got)
+	}
+	if plankton, _ := CountEntities(world.Grid()); plankton != 2 {
+		t.Errorf("%d plankton after one step, want 2", plankton)
+	}
+}
+
+func TestHunterStarvesWithoutPrey(t *testing.T) {
+	cfg := testConfig(5)
+	cfg.FoodWeb = ExampleFoodWeb()
+	world := emptyWorld(5)
+	// The fish of the web are its second species, so they live in Shark cells
+	world.front.Set(2, 2, Entity{Type: Shark, StarveCounter: 2})
+
+	TraceSimulation(cfg, world, 1, 0)
+	if _, sharks := CountEntities(world.Grid()); sharks != 1 {
+		t.Fatalf("%d fish after one step, want 1", sharks)
+	}
+	TraceSimulation(cfg, world, 1, 1)
+	if _, sharks := CountEntities(world.Grid()); sharks != 0 {
+		t.Errorf("%d fish after two steps without plankton, want 0", sharks)
+	}
+}
+
+func TestFoodWebConservesPopulation(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.FoodWeb = ExampleFoodWeb()
+	cfg.Seed = 4
+	sim, err := NewSimulation(cfg, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for step := 0; step < 100; step++ {
+		fishBefore, sharksBefore := CountEntities(sim.world.Grid())
+		report := sim.Trace()
+		fishAfter, sharksAfter := CountEntities(sim.world.Grid())
+		if err := report.Check(fishBefore, sharksBefore, fishAfter, sharksAfter); err != nil {
+			t.Fatalf("step %d: %v", step, err)
+		}
+	}
+
+	populations := sim.Populations()
+	names := make([]string, 0, len(populations))
+	for _, p := range populations {
+		names = append(names, p.Name)
+	}
+	if !slices.Equal(names, []string{"plankton", "fish", "shark", "orca"}) {
+		t.Errorf("populations are of %v, want the species of the web", names)
+	}
+	total := 0
+	for _, p := range populations {
+		total += p.Count
+	}
+	if stats := sim.Stats(); total != int(stats[len(stats)-1].Occupancy*float64(sim.cells())+0.5) {
+		t.Errorf("populations add up to %d, which does not match the occupancy", total)
+	}
+}
+
+func TestFoodWebStatsCSVHasSpeciesColumns(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.FoodWeb = ExampleFoodWeb()
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(3)
+
+	var buf bytes.Buffer
+	if err := sim.Stats().WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	header, _, _ := strings.Cut(buf.String(), "\n")
+	if !strings.HasSuffix(header, ",plankton,fish,shark,orca") {
+		t.Errorf("CSV header = %q, want a column per species", header)
+	}
+}
+
+func TestSnapshotKeepsFoodWeb(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.FoodWeb = ExampleFoodWeb()
+	cfg.Seed = 6
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(5)
+
+	formats := map[string]struct {
+		write func(*bytes.Buffer, Snapshot) error
+		read  func(*bytes.Buffer) (Snapshot, error)
+	}{
+		"json": {
+			func(b *bytes.Buffer, s Snapshot) error { return WriteSnapshotJSON(b, s) },
+			func(b *bytes.Buffer) (Snapshot, error) { return ReadSnapshotJSON(b) },
+		},
+		"binary": {
+			func(b *bytes.Buffer, s Snapshot) error { return WriteSnapshotBinary(b, s) },
+			func(b *bytes.Buffer) (Snapshot, error) { return ReadSnapshotBinary(b) },
+		},
+	}
+	for name, format := range formats {
+		var buf bytes.Buffer
+		if err := format.write(&buf, sim.Snapshot()); err != nil {
+			t.Fatalf("%s: write: %v", name, err)
+		}
+		snap, err := format.read(&buf)
+		if err != nil {
+			t.Fatalf("%s: read: %v", name, err)
+		}
+		if len(snap.Config.FoodWeb) != 4 || snap.Config.FoodWeb[3].Name != "orca" ||
+			!slices.Equal(snap.Config.FoodWeb[3].Eats, []string{"shark"}) {
+			t.Fatalf("%s: food web = %+v", name, snap.Config.FoodWeb)
+		}
+
+		resumed, err := NewSimulationFromSnapshot(snap, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		original, _ := NewSimulationFromSnapshot(sim.Snapshot(), 1)
+		original.StepN(5)
+		resumed.StepN(5)
+		if !original.world.Grid().Equal(resumed.world.Grid()) {
+			t.Errorf("%s: resumed food web run diverged from the original", name)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+// Grid is a rectangular world of Rows by Cols cells, stored as one flat
+// array per entity field rather than as individual entities. The cell in
+// row x and column y is at index x*Cols+y of every array. Empty cells
+// always have zero counters, so two grids holding the same entities have
+// identical arrays.
+type Grid struct {
+	Rows   int
+	Cols   int
+	Types  []CellType
+	Breed  []int32
+	Starve []int32
+	Energy []int32
+	Age    []int32
+}
+
+/**
+ * @brief Creates an empty grid with the given number of rows and columns.
+ *
+ * @param rows The number of rows.
+ * @param cols The number of columns.
+ * @return The empty grid.
+ */
+func NewGrid(rows, cols int) Grid {
+	cells := rows * cols
+	return Grid{
+		Rows:   rows,
+		Cols:   cols,
+		Types:  make([]CellType, cells),
+		Breed:  make([]int32, cells),
+		Starve: make([]int32, cells),
+		Energy: make([]int32, cells),
+		Age:    make([]int32, cells),
+	}
+}
+
+/**
+ * @brief Returns the index of a cell in the grid's arrays.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return The index of the cell.
+ */
+func (g Grid) Index(x, y int) int {
+	return x*g.Cols + y
+}
+
+/**
+ * @brief Returns a copy of the entity in a cell.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return The entity in the cell, or an Entity of type Empty if there is none.
+ */
+func (g Grid) At(x, y int) Entity {
+	i := g.Index(x, y)
+	return Entity{
+		Type:          g.Types[i],
+		BreedCounter:  int(g.Breed[i]),
+		StarveCounter: int(g.Starve[i]),
+		Energy:        int(g.Energy[i]),
+		Age:           int(g.Age[i]),
+	}
+}
+
+/**
+ * @brief Puts an entity into a cell, replacing whatever was there.
+ *
+ * Setting an entity of type Empty clears the cell, counters included.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @param e The entity to store.
+ */
+func (g Grid) Set(x, y int, e Entity) {
+	i := g.Index(x, y)
+	if e.Type == Empty {
+		g.clear(i)
+		return
+	}
+	g.put(i, e.Type, int32(e.BreedCounter), int32(e.StarveCounter), int32(e.Energy), int32(e.Age))
+}
+
+/**
+ * @brief Stores an entity at an index.
+ *
+ * @param i The index of the cell.
+ * @param cellType The type of the entity.
+ * @param breed The entity's breed counter.
+ * @param starve The entity's starvation counter.
+ * @param energy The entity's energy.
+ * @param age The number of steps the entity has survived.
+ */
+func (g Grid) put(i int, cellType CellType, breed, starve, energy, age int32) {
+	g.Types[i] = cellType
+	g.Breed[i] = breed
+	g.Starve[i] = starve
+	g.Energy[i] = energy
+	g.Age[i] = age
+}
+
+/**
+ * @brief Empties the cell at an index.
+ *
+ * @param i The index of the cell.
+ */
+func (g Grid) clear(i int) {
+	g.put(i, Empty, 0, 0, 0, 0)
+}
+
+/**
+ * @brief Returns a copy of the grid that shares no storage with it.
+ *
+ * @return The copy.
+ */
+func (g Grid) Clone() Grid {
+	copied := NewGrid(g.Rows, g.Cols)
+	CopyGrid(copied, g)
+	return copied
+}
+
+/**
+ * @brief Reports whether two grids are the same size and hold the same
+ *        entities in every cell.
+ *
+ * @param other The grid to compare with.
+ * @return true if the grids are equal.
+ */
+func (g Grid) Equal(other Grid) bool {
+	if g.Rows != other.Rows || g.Cols != other.Cols {
+		return false
+	}
+	for i := range g.Types {
+		if g.Types[i] != other.Types[i] || g.Breed[i] != other.Breed[i] ||
+			g.Starve[i] != other.Starve[i] || g.Energy[i] != other.Energy[i] || g.Age[i] != other.Age[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+ * @brief Copies the contents of one grid to another.
+ *
+ * Both grids must be the same size. Only the arrays are copied, so no
+ * memory is allocated.
+ *
+ * @param dest The destination grid where the values will be copied to.
+ * @param src The source grid from which values will be copied.
+ */
+func CopyGrid(dest, src Grid) {
+	copy(dest.Types, src.Types)
+	copy(dest.Breed, src.Breed)
+	copy(dest.Starve, src.Starve)
+	copy(dest.Energy, src.Energy)
+	copy(dest.Age, src.Age)
+}
+
+/**
+ * @brief Adds up the energy held by every shark in the grid.
+ *
+ * Under the classic rules a shark's starvation counter is the number of
+ * steps it can still survive without eating, and under the energy model
+ * its Energy plays that part. Only one of the two is ever used, the other
+ * staying zero, so both are added.
+ *
+ * @param grid The grid to total.
+ * @return The sum of the StarveCounter and Energy of every shark.
+ */
+func TotalSharkEnergy(grid Grid) int {
+	total := 0
+	for i, cellType := range grid.Types {
+		if cellType == Shark {
+			total += int(grid.Starve[i]) + int(grid.Energy[i])
+		}
+	}
+	return total
+}
+
+/**
+ * @brief Counts the fish and sharks currently in the grid.
+ *
+ * @param grid The grid to count entities in.
+ * @return The number of fish and the number of sharks, in that order.
+ */
+func CountEntities(grid Grid) (fish, sharks int) {
+	for _, cellType := range grid.Types {
+		if cellType == Fish {
+			fish++
+		} else if cellType == Shark {
+			sharks++
+		}
+	}
+	return fish, sharks
+}
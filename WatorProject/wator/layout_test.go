@@ -0,0 +1,190 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"fmt"
+	"testing"
+)
+
+// pointerGrid is the grid layout used before Grid was flattened: a slice of
+// rows of individually allocated entities. It is kept here, together with
+// the update that ran on it, as the baseline for BenchmarkGridLayout and to
+// check that the flat layout follows exactly the same rules.
+type pointerGrid [][]*Entity
+
+// toPointerGrid converts a flat grid into the old layout
+func toPointerGrid(grid Grid) pointerGrid {
+	old := make(pointerGrid, grid.Rows)
+	for x := range old {
+		old[x] = make([]*Entity, grid.Cols)
+		for y := range old[x] {
+			if e := grid.At(x, y); e.Type != Empty {
+				old[x][y] = &e
+			}
+		}
+	}
+	return old
+}
+
+// matchesPointerGrid reports whether a flat grid and a pointer grid hold
+// the same entities in every cell, leaving out their ages, which the old
+// layout did not keep
+func matchesPointerGrid(grid Grid, old pointerGrid) bool {
+	for x, row := range old {
+		for y, cell := range row {
+			e := Entity{Type: Empty}
+			if cell != nil {
+				e = *cell
+			}
+			got := grid.At(x, y)
+			got.Age = 0
+			if got != e {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pointerNeighbours returns the four wrapped neighbours of a cell
+func pointerNeighbours(rows, cols, x, y int) [][2]int {
+	return [][2]int{
+		{x, (y - 1 + cols) % cols},
+		{x, (y + 1) % cols},
+		{(x - 1 + rows) % rows, y},
+		{(x + 1) % rows, y},
+	}
+}
+
+// pointerUpdate is the old update: the grid is changed in place, with a
+// fresh set of marks each step recording which cells have already acted
+func pointerUpdate(cfg Config, grid pointerGrid, numThreads, step int) {
+	rows, cols := len(grid), len(grid[0])
+	moved := make([][]bool, rows)
+	for i := range moved {
+		moved[i] = make([]bool, cols)
+	}
+
+	runBands(partitionBands(rows, 1), numThreads, func(band, startRow, endRow int) {
+		rng := newSource(cfg, StreamSeed(cfg.Seed, step, band))
+		for x := startRow; x < endRow; x++ {
+			for y, cell := range grid[x] {
+				if cell == nil || moved[x][y] {
+					continue
+				}
+
+				var empty, fish [][2]int
+				for _, n := range pointerNeighbours(rows, cols, x, y) {
+					if c := grid[n[0]][n[1]]; c == nil {
+						empty = append(empty, n)
+					} else if c.Type == Fish {
+						fish = append(fish, n)
+					}
+				}
+
+				cell.BreedCounter++
+				if cell.Type == Fish {
+					if len(empty) == 0 {
+						moved[x][y] = true
+						continue
+					}
+					to := empty[rng.Intn(len(empty))]
+					grid[x][y] = nil
+					grid[to[0]][to[1]] = cell
+					moved[to[0]][to[1]] = true
+					if cell.BreedCounter >= cfg.FishBreedTime {
+						cell.BreedCounter = 0
+						grid[x][y] = &Entity{Type: Fish}
+						moved[x][y] = true
+					}
+					continue
+				}
+
+				cell.StarveCounter--
+				to := [2]int{x, y}
+				if len(fish) > 0 {
+					to = fish[rng.Intn(len(fish))]
+					cell.StarveCounter = cfg.SharkStarveTime
+				} else if len(empty) > 0 {
+					to = empty[rng.Intn(len(empty))]
+				}
+				grid[x][y] = nil
+				if cell.StarveCounter <= 0 {
+					continue
+				}
+				grid[to[0]][to[1]] = cell
+				moved[to[0]][to[1]] = true
+				if to != [2]int{x, y} && cell.BreedCounter >= cfg.SharkBreedTime {
+					cell.BreedCounter = 0
+					grid[x][y] = &Entity{Type: Shark, StarveCounter: cfg.SharkStarveTime}
+					moved[x][y] = true
+				}
+			}
+		}
+	})
+}
+
+func TestFlatGridMatchesPointerGrid(t *testing.T) {
+	cfg := ScaledConfig(60)
+	cfg.Seed = 1
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := toPointerGrid(sim.Grid())
+
+	for step := 0; step < 100; step++ {
+		sim.Step()
+		pointerUpdate(cfg, old, 1, step)
+		if !matchesPointerGrid(sim.world.Grid(), old) {
+			t.Fatalf("step %d: flat grid differs from the pointer grid", step)
+		}
+	}
+}
+
+func TestStepDoesNotAllocate(t *testing.T) {
+	sim, err := NewSimulation(ScaledConfig(200), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(2)
+
+	// Statistics grow with every step, so only the update itself is measured
+	if allocs := testing.AllocsPerRun(20, func() {
+		UpdateSimulation(sim.cfg, sim.world, 1, sim.step)
+	}); allocs != 0 {
+		t.Errorf("a single-threaded step made %v allocations, want 0", allocs)
+	}
+}
+
+func BenchmarkGridLayout(b *testing.B) {
+	for _, size := range []int{200, 1000} {
+		cfg := ScaledConfig(size)
+		cfg.Seed = 1
+		initial, err := InitialiseGrid(cfg)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, threads := range []int{1, 4} {
+			b.Run(fmt.Sprintf("layout=pointer/grid=%d/threads=%d", size, threads), func(b *testing.B) {
+				grid := toPointerGrid(initial)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					pointerUpdate(cfg, grid, threads, i)
+				}
+				b.ReportMetric(float64(size*size)*float64(b.N)/b.Elapsed().Seconds(), "cells/s")
+			})
+			b.Run(fmt.Sprintf("layout=flat/grid=%d/threads=%d", size, threads), func(b *testing.B) {
+				world := NewWorld(initial.Clone())
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					UpdateSimulation(cfg, world, threads, i)
+				}
+				b.ReportMetric(float64(size*size)*float64(b.N)/b.Elapsed().Seconds(), "cells/s")
+			})
+		}
+	}
+}
@@ -0,0 +1,306 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Neighbourhood describes which cells an entity can see and move to, as
+// offsets from its own cell. Offsets may point beyond the grid; the
+// configured Boundary decides where they lead.
+type Neighbourhood interface {
+	// Size returns the number of neighbours of every cell.
+	Size() int
+	// Offset returns the row and column offset of neighbour i of a cell in
+	// row x. The offsets may depend on whether x is odd or even, as they do
+	// in the hexagonal layout whose odd rows are shifted, but not otherwise.
+	Offset(x, i int) (dx, dy int)
+	// Reach returns the largest row offset, which decides how far apart
+	// rows updated at the same time must be.
+	Reach() int
+}
+
+// NeighbourhoodKind selects one of the built-in neighbourhoods
+type NeighbourhoodKind int
+
+const (
+	// VonNeumann cells are within Radius steps up, down, left and right,
+	// the four direct neighbours when Radius is one. This is the classic
+	// Wator neighbourhood.
+	VonNeumann NeighbourhoodKind = iota
+	// Moore cells are within Radius cells in every direction, diagonals
+	// included, the eight surrounding cells when Radius is one.
+	Moore
+	// Hexagonal treats the grid as rows of hexagons with every odd row
+	// shifted half a cell to the right, so a cell has six neighbours when
+	// Radius is one.
+	Hexagonal
+)
+
+/**
+ * @brief Returns the name of the neighbourhood kind.
+ *
+ * @return "von-neumann", "moore" or "hex".
+ */
+func (k NeighbourhoodKind) String() string {
+	switch k {
+	case VonNeumann:
+		return "von-neumann"
+	case Moore:
+		return "moore"
+	case Hexagonal:
+		return "hex"
+	}
+	return fmt.Sprintf("NeighbourhoodKind(%d)", int(k))
+}
+
+/**
+ * @brief Parses the name of a neighbourhood kind.
+ *
+ * @param name One of the names returned by NeighbourhoodKind.String.
+ * @return The neighbourhood kind, or an error if the name is not known.
+ */
+func ParseNeighbourhood(name string) (NeighbourhoodKind, error) {
+	for _, k := range []NeighbourhoodKind{VonNeumann, Moore, Hexagonal} {
+		if name == k.String() {
+			return k, nil
+		}
+	}
+	return VonNeumann, fmt.Errorf("unknown neighbourhood %q (want von-neumann, moore or hex)", name)
+}
+
+/**
+ * @brief Encodes the neighbourhood kind by name.
+ *
+ * @return The name of the kind.
+ */
+func (k NeighbourhoodKind) MarshalText() ([]byte, error) {
+	if !k.valid() {
+		return nil, fmt.Errorf("unknown neighbourhood %d", int(k))
+	}
+	return []byte(k.String()), nil
+}
+
+/**
+ * @brief Decodes a neighbourhood kind from its name.
+ *
+ * @param text The name of the kind.
+ * @return nil on success, or an error if the name is not known.
+ */
+func (k *NeighbourhoodKind) UnmarshalText(text []byte) error {
+	parsed, err := ParseNeighbourhood(string(text))
+	if err != nil {
+		return err
+	}
+	*k = parsed
+	return nil
+}
+
+/**
+ * @brief Reports whether the kind is one of the built-in neighbourhoods.
+ *
+ * @return true for VonNeumann, Moore and Hexagonal.
+ */
+func (k NeighbourhoodKind) valid() bool {
+	return k >= VonNeumann && k <= Hexagonal
+}
+
+/**
+ * @brief Creates the neighbourhood of the given kind and radius.
+ *
+ * @param kind The shape of the neighbourhood.
+ * @param radius How many steps away a neighbour can be, at least one.
+ * @return The neighbourhood, or an error if the kind or radius is invalid.
+ */
+func NewNeighbourhood(kind NeighbourhoodKind, radius int) (Neighbourhood, error) {
+	if radius < 1 {
+		return nil, fmt.Errorf("neighbourhood radius must be at least 1, got %d", radius)
+	}
+
+	switch kind {
+	case VonNeumann:
+		return newOffsetNeighbourhood(radius, func(dx, dy int) int {
+			return abs(dx) + abs(dy)
+		}), nil
+	case Moore:
+		return newOffsetNeighbourhood(radius, func(dx, dy int) int {
+			return max(abs(dx), abs(dy))
+		}), nil
+	case Hexagonal:
+		return newHexNeighbourhood(radius), nil
+	}
+	return nil, fmt.Errorf("unknown neighbourhood %d", int(kind))
+}
+
+// offsetNeighbourhood is a Neighbourhood given by a table of offsets for
+// cells in even rows and another for cells in odd rows
+type offsetNeighbourhood struct {
+	even  [][2]int
+	odd   [][2]int
+	reach int
+}
+
+/**
+ * @brief Builds a neighbourhood of every offset within a distance of the cell.
+ *
+ * The same offsets are used for odd and even rows.
+ *
+ * @param radius The largest distance of a neighbour.
+ * @param distance The metric giving the distance of an offset.
+ * @return The neighbourhood.
+ */
+func newOffsetNeighbourhood(radius int, distance func(dx, dy int) int) *offsetNeighbourhood {
+	var offsets [][2]int
+	for dx := -radius; dx <= radius; dx++ {
+		for dy := -radius; dy <= radius; dy++ {
+			if d := distance(dx, dy); d > 0 && d <= radius {
+				offsets = append(offsets, [2]int{dx, dy})
+			}
+		}
+	}
+	sortOffsets(offsets, func(o [2]int) int { return distance(o[0], o[1]) })
+	return &offsetNeighbourhood{even: offsets, odd: offsets, reach: radius}
+}
+
+/**
+ * @brief Builds the hexagonal neighbourhood of a radius.
+ *
+ * Cells are converted to cube coordinates, in which the distance between
+ * two hexagons is the largest difference along any axis. Odd rows are
+ * shifted right, so the offsets of a cell depend on the parity of its row.
+ *
+ * @param radius The largest distance of a neighbour.
+ * @return The neighbourhood.
+ */
+func newHexNeighbourhood(radius int) *offsetNeighbourhood {
+	offsetsFrom := func(row int) [][2]int {
+		q0, r0 := hexCube(row, 0)
+		distance := func(o [2]int) int {
+			q, r := hexCube(row+o[0], o[1])
+			return max(abs(q-q0), abs(r-r0), abs((q+r)-(q0+r0)))
+		}
+
+		var offsets [][2]int
+		for dx := -radius; dx <= radius; dx++ {
+			for dy := -radius - 1; dy <= radius+1; dy++ {
+				if d := distance([2]int{dx, dy}); d > 0 && d <= radius {
+					offsets = append(offsets, [2]int{dx, dy})
+				}
+			}
+		}
+		sortOffsets(offsets, distance)
+		return offsets
+	}
+	return &offsetNeighbourhood{even: offsetsFrom(0), odd: offsetsFrom(1), reach: radius}
+}
+
+/**
+ * @brief Converts a cell of the hexagonal layout to cube coordinates.
+ *
+ * @param x The row of the cell, which may be negative.
+ * @param y The column of the cell.
+ * @return The q and r cube coordinates; the third is -q-r.
+ */
+func hexCube(x, y int) (q, r int) {
+	return y - (x-(x&1))/2, x
+}
+
+/**
+ * @brief Orders offsets nearest first, then those straight left, right, up
+ *        and down, then by position.
+ *
+ * At radius one this puts the von Neumann neighbours in the order the
+ * simulation has always used (left, right, up, down), so seeded runs are
+ * unchanged.
+ *
+ * @param offsets The offsets to sort in place.
+ * @param distance The distance of an offset from the cell.
+ */
+func sortOffsets(offsets [][2]int, distance func([2]int) int) {
+	rank := func(o [2]int) int {
+		switch {
+		case o[0] == 0 && o[1] < 0:
+			return 0
+		case o[0] == 0:
+			return 1
+		case o[1] == 0 && o[0] < 0:
+			return 2
+		case o[1] == 0:
+			return 3
+		}
+		return 4
+	}
+	slices.SortStableFunc(offsets, func(a, b [2]int) int {
+		if d := distance(a) - distance(b); d != 0 {
+			return d
+		}
+		return rank(a) - rank(b)
+	})
+}
+
+/**
+ * @brief Returns the number of neighbours of every cell.
+ *
+ * @return The number of offsets.
+ */
+func (n *offsetNeighbourhood) Size() int {
+	return len(n.even)
+}
+
+/**
+ * @brief Returns the offset of one neighbour of a cell.
+ *
+ * @param x The row of the cell.
+ * @param i The index of the neighbour, below Size.
+ * @return The row and column offset of the neighbour.
+ */
+func (n *offsetNeighbourhood) Offset(x, i int) (dx, dy int) {
+	o := n.even[i]
+	if x&1 == 1 {
+		o = n.odd[i]
+	}
+	return o[0], o[1]
+}
+
+/**
+ * @brief Returns the largest row offset of any neighbour.
+ *
+ * @return The radius of the neighbourhood.
+ */
+func (n *offsetNeighbourhood) Reach() int {
+	return n.reach
+}
+
+/**
+ * @brief Returns the absolute value of an integer.
+ *
+ * @param v The value.
+ * @return v without its sign.
+ */
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+/**
+ * @brief Returns the size of a hexagonal grid in units of the cell width.
+ *
+ * Hexagons stand on a point, so each row is the cell width times √3/2
+ * below the last and odd rows stick out half a cell to the right.
+ *
+ * @param rows The number of rows.
+ * @param cols The number of columns.
+ * @return The width and height of the whole grid.
+ */
+func hexExtent(rows, cols int) (width, height float64) {
+	width = float64(cols)
+	if rows > 1 {
+		width += 0.5
+	}
+	height = float64(rows-1)*math.Sqrt(3)/2 + 2/math.Sqrt(3)
+	return width, height
+}
@@ -0,0 +1,449 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+const (
+	// DefaultClusters is the number of blobs each species forms under
+	// Clustered placement
+	DefaultClusters = 4
+	// DefaultClusterSpread is the standard deviation, in cells, of a blob
+	DefaultClusterSpread = 4.0
+	// DefaultStripeWidth is the number of rows in each band under Stripes
+	// placement
+	DefaultStripeWidth = 5
+	// placementWeightScale turns the weight of a cell into an integer, the
+	// heaviest cell getting this much, so cells can be chosen with Intn
+	placementWeightScale = 1 << 16
+	// clusterFloor is the weight of a cell far from every blob, so that a
+	// population too large for its blobs spills over into the rest of the
+	// water instead of failing to fit
+	clusterFloor = 1e-9
+)
+
+// PlacementKind selects how the initial entities are spread over the grid
+type PlacementKind int
+
+const (
+	// Uniform puts each entity in a free cell chosen at random, every free
+	// cell being equally likely, so each species starts at the same density
+	// everywhere. This is the classic Wator placement.
+	Uniform PlacementKind = iota
+	// Clustered gathers each species into Gaussian blobs around centres
+	// chosen at random, the further from a centre the fewer entities.
+	Clustered
+	// Stripes splits the grid into bands of rows and gives each species
+	// every n-th band, n being the number of species, so fish and sharks
+	// start side by side in alternate bands.
+	Stripes
+	// Image spreads every species by a density map, bright cells being
+	// more likely to be filled than dark ones and black cells never.
+	Image
+	// UniformDensity fills each free cell on its own, with the chance of
+	// a species' initial count over the free cells, so each species starts
+	// at the same density everywhere but its population varies from run to
+	// run around the count, rather than matching it exactly as under
+	// Uniform.
+	UniformDensity
+	// FromSnapshot starts from the entities of a saved grid, keeping their
+	// counters and ages, and scatters any initial counts over the rest of
+	// the water as Uniform does.
+	FromSnapshot
+)
+
+// Placement describes how InitialiseGrid spreads the initial entities. Its
+// zero value is Uniform placement, which needs no parameters.
+type Placement struct {
+	Kind PlacementKind `json:"kind"`
+	// Clusters is the number of blobs of each species and Spread the
+	// standard deviation of a blob in cells, under Clustered placement.
+	Clusters int     `json:"clusters,omitempty"`
+	Spread   float64 `json:"spread,omitempty"`
+	// StripeWidth is the number of rows in a band under Stripes placement.
+	StripeWidth int `json:"stripeWidth,omitempty"`
+	// Density is the map used by Image placement, stretched over the grid
+	// like the maps of an Environment. Only the relative values matter.
+	Density *Layer `json:"density,omitempty"`
+	// Start is the grid FromSnapshot placement starts from, of the same
+	// size as the grid. Its land must be land on the world map too.
+	Start *Grid `json:"start,omitempty"`
+}
+
+/**
+ * @brief Returns the name of the placement kind.
+ *
+ * @return "uniform", "clustered", "stripes", "image", "density" or
+ *         "snapshot".
+ */
+func (k PlacementKind) String() string {
+	switch k {
+	case Uniform:
+		return "uniform"
+	case Clustered:
+		return "clustered"
+	case Stripes:
+		return "stripes"
+	case Image:
+		return "image"
+	case UniformDensity:
+		return "density"
+	case FromSnapshot:
+		return "snapshot"
+	}
+	return fmt.Sprintf("PlacementKind(%d)", int(k))
+}
+
+/**
+ * @brief Parses the name of a placement kind.
+ *
+ * @param name One of the names returned by PlacementKind.String.
+ * @return The placement kind, or an error if the name is not known.
+ */
+func ParsePlacement(name string) (PlacementKind, error) {
+	for k := Uniform; k.valid(); k++ {
+		if name == k.String() {
+			return k, nil
+		}
+	}
+	return Uniform, fmt.Errorf("unknown placement %q (want uniform, clustered, stripes, image, density or snapshot)", name)
+}
+
+/**
+ * @brief Encodes the placement kind by name.
+ *
+ * @return The name of the kind.
+ */
+func (k PlacementKind) MarshalText() ([]byte, error) {
+	if !k.valid() {
+		return nil, fmt.Errorf("unknown placement %d", int(k))
+	}
+	return []byte(k.String()), nil
+}
+
+/**
+ * @brief Decodes a placement kind from its name.
+ *
+ * @param text The name of the kind.
+ * @return nil on success, or an error if the name is not known.
+ */
+func (k *PlacementKind) UnmarshalText(text []byte) error {
+	parsed, err := ParsePlacement(string(text))
+	if err != nil {
+		return err
+	}
+	*k = parsed
+	return nil
+}
+
+/**
+ * @brief Reports whether the kind is one of the built-in placements.
+ *
+ * @return true for Uniform, Clustered, Stripes, Image, UniformDensity and
+ *         FromSnapshot.
+ */
+func (k PlacementKind) valid() bool {
+	return k >= Uniform && k <= FromSnapshot
+}
+
+/**
+ * @brief Checks the parameters used by the selected kind of placement.
+ *
+ * Parameters of the other kinds are not checked, so they can be left at
+ * their defaults or zero.
+ *
+ * @param c The configuration the placement belongs to.
+ * @return An error for each invalid parameter.
+ */
+func (p Placement) validate(c Config) []error {
+	var errs []error
+	switch p.Kind {
+	case Uniform, UniformDensity:
+	case Clustered:
+		if p.Clusters < 1 {
+			errs = append(errs, fmt.Errorf("clustered placement needs at least one cluster, got %d", p.Clusters))
+		}
+		if !(p.Spread > 0) || math.IsInf(p.Spread, 0) {
+			errs = append(errs, fmt.Errorf("cluster spread must be a positive number, got %v", p.Spread))
+		}
+	case Stripes:
+		if p.StripeWidth < 1 {
+			errs = append(errs, fmt.Errorf("stripe width must be at least 1, got %d", p.StripeWidth))
+		}
+	case Image:
+		if p.Density == nil {
+			errs = append(errs, errors.New("image placement needs a density map"))
+			break
+		}
+		if err := p.Density.validate("density"); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		for _, v := range p.Density.Values {
+			if v < 0 {
+				errs = append(errs, fmt.Errorf("density map holds a negative density %v", v))
+				break
+			}
+		}
+	case FromSnapshot:
+		errs = append(errs, p.validateStart(c)...)
+	default:
+		errs = append(errs, fmt.Errorf("unknown placement %d", int(p.Kind)))
+	}
+	return errs
+}
+
+/**
+ * @brief Checks the grid FromSnapshot placement starts from.
+ *
+ * @param c The configuration the placement belongs to.
+ * @return An error for each problem found, stopping at the first bad cell.
+ */
+func (p Placement) validateStart(c Config) []error {
+	start := p.Start
+	if start == nil {
+		return []error{errors.New("snapshot placement needs a grid to start from")}
+	}
+	if start.Rows != c.GridHeight || start.Cols != c.GridWidth {
+		return []error{fmt.Errorf("start grid is %dx%d, but the grid is %dx%d", start.Cols, start.Rows, c.GridWidth, c.GridHeight)}
+	}
+	cells := start.Rows * start.Cols
+	if len(start.Types) != cells || len(start.Breed) != cells || len(start.Starve) != cells ||
+		len(start.Energy) != cells || len(start.Age) != cells {
+		return []error{fmt.Errorf("start grid arrays do not hold %d cells", cells)}
+	}
+
+	rules := c.rules()
+	for i, cellType := range start.Types {
+		x, y := i/start.Cols, i%start.Cols
+		mapped := Empty
+		if c.Map != nil {
+			mapped = c.Map.cell(x, y)
+		}
+		onLand := mapped == Land
+		switch {
+		case cellType == Empty:
+		case cellType == Land && !onLand:
+			return []error{fmt.Errorf("start grid has land at (%d, %d), where the world map has none", x, y)}
+		case cellType == Land:
+		case rules.Species(cellType) == nil:
+			return []error{fmt.Errorf("start grid cell (%d, %d) has unknown type %d", x, y, cellType)}
+		case onLand:
+			return []error{fmt.Errorf("start grid has an entity on the land at (%d, %d)", x, y)}
+		case mapped != Empty:
+			return []error{fmt.Errorf("start grid has an entity at (%d, %d), where the world map already places one", x, y)}
+		case start.Age[i] < 0:
+			return []error{fmt.Errorf("start grid cell (%d, %d) has negative age %d", x, y, start.Age[i])}
+		}
+	}
+	return nil
+}
+
+/**
+ * @brief Counts the entities FromSnapshot placement starts with.
+ *
+ * @return The number of entities in the start grid, or zero under any
+ *         other kind of placement.
+ */
+func (p Placement) started() int {
+	if p.Kind != FromSnapshot || p.Start == nil {
+		return 0
+	}
+	count := 0
+	for _, cellType := range p.Start.Types {
+		if cellType != Empty && cellType != Land {
+			count++
+		}
+	}
+	return count
+}
+
+/**
+ * @brief Puts the entities of the start grid into a grid, as they were.
+ *
+ * @param grid The grid being initialised, which must be the size of the
+ *        start grid. Only the entities of the world map may be in it yet,
+ *        and validation keeps the start grid off their cells.
+ */
+func (p Placement) placeStart(grid Grid) {
+	start := p.Start
+	for i, cellType := range start.Types {
+		if cellType != Empty && cellType != Land {
+			grid.put(i, cellType, start.Breed[i], start.Starve[i], start.Energy[i], start.Age[i])
+		}
+	}
+}
+
+/**
+ * @brief Sets a configuration to start from the layout of a saved grid.
+ *
+ * The grid size follows the saved grid, its land becomes the world map
+ * and its entities are placed as they were, counters and ages included,
+ * by FromSnapshot placement. The initial counts are placed on top of them,
+ * so set them to zero to start from the saved entities alone.
+ *
+ * @param grid The saved grid, such as that of a snapshot. It is copied.
+ */
+func (c *Config) StartFrom(grid Grid) {
+	start := grid.Clone()
+	c.GridWidth, c.GridHeight = grid.Cols, grid.Rows
+	c.Map = nil
+	if slices.Contains(grid.Types, Land) {
+		c.Map = &WorldMap{Rows: grid.Rows, Cols: grid.Cols, Cells: make([]CellType, len(grid.Types))}
+		for i, cellType := range grid.Types {
+			if cellType == Land {
+				c.Map.Cells[i] = Land
+			}
+		}
+	}
+	c.Placement.Kind, c.Placement.Start = FromSnapshot, &start
+}
+
+/**
+ * @brief Works out how likely each cell is to receive an entity.
+ *
+ * @param cfg The simulation parameters.
+ * @param rng The random number generator, used for the centres of blobs.
+ * @param entityType The type of entity being placed.
+ * @return The weight of every cell of the grid in row-major order, zero
+ *         for cells the entity may not be placed in.
+ */
+func (p Placement) weights(cfg Config, rng RandSource, entityType CellType) []float64 {
+	rows, cols := cfg.GridHeight, cfg.GridWidth
+	weights := make([]float64, rows*cols)
+	switch p.Kind {
+	case Clustered:
+		for i := range weights {
+			weights[i] = clusterFloor
+		}
+		for c := 0; c < p.Clusters; c++ {
+			cx, cy := rng.Intn(rows), rng.Intn(cols)
+			for x := 0; x < rows; x++ {
+				dx := placementDistance(cfg, x-cx, rows)
+				for y := 0; y < cols; y++ {
+					dy := placementDistance(cfg, y-cy, cols)
+					weights[x*cols+y] += math.Exp(-float64(dx*dx+dy*dy) / (2 * p.Spread * p.Spread))
+				}
+			}
+		}
+	case Stripes:
+		types := cfg.rules().Types()
+		band := max(0, slices.Index(types, entityType))
+		for x := 0; x < rows; x++ {
+			if (x/p.StripeWidth)%len(types) != band {
+				continue
+			}
+			for y := 0; y < cols; y++ {
+				weights[x*cols+y] = 1
+			}
+		}
+	case Image:
+		for i, v := range p.Density.resample(rows, cols) {
+			weights[i] = float64(v)
+		}
+	default:
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	return weights
+}
+
+/**
+ * @brief Returns the distance between two rows or columns, the short way
+ *        round on a torus.
+ *
+ * @param cfg The simulation parameters.
+ * @param d The difference between the rows or columns.
+ * @param size The number of rows or columns in the grid.
+ * @return The distance, which is never negative.
+ */
+func placementDistance(cfg Config, d, size int) int {
+	d = max(d, -d)
+	if cfg.Boundary == Torus {
+		d = min(d, size-d)
+	}
+	return d
+}
+
+// weightedCells draws cells at random, each with a chance proportional to
+// its weight, never drawing the same cell twice. The weights are kept in a
+// Fenwick tree, so a draw takes time proportional to the logarithm of the
+// number of cells.
+type weightedCells struct {
+	cells   []int
+	weights []int64
+	tree    []int64
+	total   int64
+}
+
+/**
+ * @brief Prepares to draw from the free cells of a grid.
+ *
+ * @param grid The grid, whose empty cells are the ones that can be drawn.
+ * @param weights The weight of every cell of the grid.
+ * @return The cells to draw from, holding only empty cells of positive
+ *         weight.
+ */
+func newWeightedCells(grid Grid, weights []float64) *weightedCells {
+	heaviest := 0.0
+	for i, w := range weights {
+		if grid.Types[i] == Empty {
+			heaviest = max(heaviest, w)
+		}
+	}
+	wc := &weightedCells{}
+	if !(heaviest > 0) {
+		return wc
+	}
+	for i, w := range weights {
+		if grid.Types[i] != Empty || !(w > 0) {
+			continue
+		}
+		wc.cells = append(wc.cells, i)
+		// Light cells keep a weight of one, so they can still be drawn
+		wc.weights = append(wc.weights, max(1, int64(math.Round(w/heaviest*placementWeightScale))))
+	}
+
+	wc.tree = make([]int64, len(wc.cells)+1)
+	for i, w := range wc.weights {
+		wc.total += w
+		wc.tree[i+1] += w
+		if parent := i + 1 + (i+1)&-(i+1); parent < len(wc.tree) {
+			wc.tree[parent] += wc.tree[i+1]
+		}
+	}
+	return wc
+}
+
+/**
+ * @brief Draws a cell and removes it, so it cannot be drawn again.
+ *
+ * It must not be called once every cell has been drawn.
+ *
+ * @param rng The random number generator.
+ * @return The index of the cell in the grid.
+ */
+func (wc *weightedCells) draw(rng RandSource) int {
+	target := int64(rng.Intn(int(wc.total)))
+	pos := 0
+	for step := 1 << (bits.Len(uint(len(wc.cells))) - 1); step > 0; step >>= 1 {
+		if next := pos + step; next < len(wc.tree) && wc.tree[next] <= target {
+			pos = next
+			target -= wc.tree[next]
+		}
+	}
+
+	w := wc.weights[pos]
+	wc.weights[pos] = 0
+	wc.total -= w
+	for i := pos + 1; i < len(wc.tree); i += i & -i {
+		wc.tree[i] -= w
+	}
+	return wc.cells[pos]
+}
@@ -0,0 +1,381 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlaceEntitiesReportsOverfullGrid(t *testing.T) {
+	cfg := testConfig(3)
+	for _, kind := range []PlacementKind{Uniform, Clustered, Stripes} {
+		cfg.Placement.Kind = kind
+		grid := NewGrid(3, 3)
+		err := PlaceEntities(cfg, grid, newSource(cfg, 1), Fish, 10)
+		if err == nil || !strings.Contains(err.Error(), "cannot place 10 fish") {
+			t.Errorf("%s: placing 10 fish in 9 cells gave %v", kind, err)
+		}
+		if fish, _ := CountEntities(grid); fish != 0 {
+			t.Errorf("%s: a failed placement left %d fish in the grid", kind, fish)
+		}
+	}
+
+	cfg.Placement.Kind = Clustered
+	grid := NewGrid(3, 3)
+	if err := PlaceEntities(cfg, grid, newSource(cfg, 1), Fish, 9); err != nil {
+		t.Fatal(err)
+	}
+	if fish, _ := CountEntities(grid); fish != 9 {
+		t.Errorf("clustered placement filled %d of 9 cells, want the blobs to spill over into every cell", fish)
+	}
+}
+
+func TestStripesGiveEachSpeciesItsBands(t *testing.T) {
+	cfg := testConfig(20)
+	cfg.Placement = Placement{Kind: Stripes, StripeWidth: 5}
+	cfg.InitialFishCount, cfg.InitialSharkCount = 120, 80
+
+	grid, err := InitialiseGrid(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 20; x++ {
+		want := Fish
+		if (x/5)%2 == 1 {
+			want = Shark
+		}
+		for y := 0; y < 20; y++ {
+			if got := grid.At(x, y).Type; got != Empty && got != want {
+				t.Fatalf("cell (%d, %d) holds type %d, want only type %d in its band", x, y, got, want)
+			}
+		}
+	}
+	if fish, sharks := CountEntities(grid); fish != 120 || sharks != 80 {
+		t.Errorf("placed %d fish and %d sharks, want 120 and 80", fish, sharks)
+	}
+
+	cfg.InitialFishCount, cfg.InitialSharkCount = 201, 0
+	if _, err := InitialiseGrid(cfg); err == nil || !strings.Contains(err.Error(), "under stripes placement") {
+		t.Errorf("more fish than their bands hold gave %v", err)
+	}
+}
+
+func TestClusteredPlacementGathersEntities(t *testing.T) {
+	densest := func(grid Grid) int {
+		// The most fish in any 15x15 window of the torus
+		best := 0
+		for x0 := 0; x0 < grid.Rows; x0++ {
+			for y0 := 0; y0 < grid.Cols; y0++ {
+				n := 0
+				for x := x0; x < x0+15; x++ {
+					for y := y0; y < y0+15; y++ {
+						if grid.At(x%grid.Rows, y%grid.Cols).Type == Fish {
+							n++
+						}
+					}
+				}
+				best = max(best, n)
+			}
+		}
+		return best
+	}
+
+	cfg := testConfig(60)
+	cfg.InitialFishCount = 100
+	cfg.Placement = Placement{Kind: Clustered, Clusters: 1, Spread: 3}
+	clustered, err := InitialiseGrid(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Placement.Kind = Uniform
+	uniform, err := InitialiseGrid(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := densest(clustered); n < 90 {
+		t.Errorf("only %d of 100 clustered fish lie within one 15x15 window", n)
+	}
+	if n := densest(uniform); n > 30 {
+		t.Errorf("%d of 100 uniformly placed fish lie within one 15x15 window", n)
+	}
+}
+
+func TestImagePlacementFollowsDensityMap(t *testing.T) {
+	cfg := testConfig(10)
+	cfg.InitialFishCount = 50
+	cfg.Placement = Placement{Kind: Image, Density: &Layer{Rows: 1, Cols: 2, Values: []float32{0, 1}}}
+
+	grid, err := InitialiseGrid(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fish, _ := CountEntities(grid); fish != 50 {
+		t.Fatalf("placed %d fish, want 50", fish)
+	}
+	for x := 0; x < 10; x++ {
+		for y := 0; y < 5; y++ {
+			if grid.At(x, y).Type != Empty {
+				t.Fatalf("a fish was placed in the black half of the map at (%d, %d)", x, y)
+			}
+		}
+	}
+
+	cfg.InitialFishCount = 51
+	if _, err := InitialiseGrid(cfg); err == nil {
+		t.Error("more fish than the bright half holds should not be placed")
+	}
+}
+
+func TestPlacementValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		placement Placement
+		want      string
+	}{
+		{"no clusters", Placement{Kind: Clustered, Spread: 2}, "at least one cluster"},
+		{"no spread", Placement{Kind: Clustered, Clusters: 2}, "cluster spread"},
+		{"no stripe width", Placement{Kind: Stripes}, "stripe width"},
+		{"no density map", Placement{Kind: Image}, "needs a density map"},
+		{"negative density", Placement{Kind: Image, Density: uniformLayer(1, 1, -1)}, "negative density"},
+		{"no start grid", Placement{Kind: FromSnapshot}, "needs a grid to start from"},
+		{"start grid of another size", Placement{Kind: FromSnapshot, Start: &Grid{Rows: 3, Cols: 3}}, "start grid is 3x3"},
+		{"unknown kind", Placement{Kind: FromSnapshot + 1}, "unknown placement"},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.Placement = tt.placement
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Parameters of other kinds are not checked
+	cfg := DefaultConfig()
+	cfg.Placement = Placement{Kind: Stripes, StripeWidth: 1, Clusters: -1}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("stripes with a bad cluster count: %v", err)
+	}
+}
+
+func TestPlacementKindNames(t *testing.T) {
+	for _, kind := range []PlacementKind{Uniform, Clustered, Stripes, Image, UniformDensity, FromSnapshot} {
+		parsed, err := ParsePlacement(kind.String())
+		if err != nil || parsed != kind {
+			t.Errorf("ParsePlacement(%q) = %v, %v", kind.String(), parsed, err)
+		}
+	}
+	if _, err := ParsePlacement("spiral"); err == nil {
+		t.Error("ParsePlacement accepted an unknown name")
+	}
+
+	var p Placement
+	if err := json.Unmarshal([]byte(`{"kind": "clustered", "clusters": 3, "spread": 1.5}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Kind != Clustered || p.Clusters != 3 || p.Spread != 1.5 {
+		t.Errorf("decoded %+v", p)
+	}
+}
+
+func TestSnapshotKeepsPlacement(t *testing.T) {
+	start := NewGrid(16, 16)
+	start.Set(3, 4, Entity{Type: Shark, BreedCounter: 2, StarveCounter: 1, Age: 7})
+	start.Set(9, 0, Entity{Type: Fish, BreedCounter: 1, Age: 3})
+	placements := []Placement{
+		{Kind: Image, Clusters: 2, Spread: 2.5, StripeWidth: 3,
+			Density: &Layer{Rows: 2, Cols: 1, Values: []float32{0.25, 1}}},
+		{Kind: FromSnapshot, Start: &start},
+	}
+	for _, placement := range placements {
+		cfg := DefaultConfig()
+		cfg.GridWidth, cfg.GridHeight = 16, 16
+		cfg.InitialFishCount, cfg.InitialSharkCount = 40, 10
+		cfg.Seed = 5
+		cfg.Placement = placement
+		sim, err := NewSimulation(cfg, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, format := range map[string]struct {
+			write func(*bytes.Buffer, Snapshot) error
+			read  func(*bytes.Buffer) (Snapshot, error)
+		}{
+			"json": {
+				func(b *bytes.Buffer, s Snapshot) error { return WriteSnapshotJSON(b, s) },
+				func(b *bytes.Buffer) (Snapshot, error) { return ReadSnapshotJSON(b) },
+			},
+			"binary": {
+				func(b *bytes.Buffer, s Snapshot) error { return WriteSnapshotBinary(b, s) },
+				func(b *bytes.Buffer) (Snapshot, error) { return ReadSnapshotBinary(b) },
+			},
+		} {
+			var buf bytes.Buffer
+			if err := format.write(&buf, sim.Snapshot()); err != nil {
+				t.Fatalf("%s %s: write: %v", placement.Kind, name, err)
+			}
+			snap, err := format.read(&buf)
+			if err != nil {
+				t.Fatalf("%s %s: read: %v", placement.Kind, name, err)
+			}
+			if !reflect.DeepEqual(snap.Config.Placement, cfg.Placement) {
+				t.Errorf("%s %s: placement = %+v, want %+v", placement.Kind, name, snap.Config.Placement, cfg.Placement)
+			}
+		}
+	}
+}
+
+func TestStartFromSnapshotKeepsCounters(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.GridWidth, cfg.GridHeight = 12, 12
+	cfg.InitialFishCount, cfg.InitialSharkCount = 40, 8
+	cfg.Seed = 8
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(4)
+	snap := sim.Snapshot()
+	snap.Grid.Set(0, 0, Entity{Type: Land})
+
+	fresh := DefaultConfig()
+	fresh.InitialFishCount, fresh.InitialSharkCount = 0, 0
+	fresh.StartFrom(snap.Grid)
+	if fresh.GridWidth != 12 || fresh.GridHeight != 12 || fresh.Placement.Kind != FromSnapshot {
+		t.Fatalf("StartFrom gave a %dx%d grid under %s placement", fresh.GridWidth, fresh.GridHeight, fresh.Placement.Kind)
+	}
+	grid, err := InitialiseGrid(fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !grid.Equal(snap.Grid) {
+		t.Fatal("the grid does not start as the snapshot left it")
+	}
+	if fresh.WaterCells() != 143 {
+		t.Errorf("water cells = %d, want the snapshot's land left out", fresh.WaterCells())
+	}
+
+	// Initial counts are scattered around the saved entities
+	fresh.InitialFishCount = 5
+	grid, err = InitialiseGrid(fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fish, _ := CountEntities(grid)
+	if savedFish, _ := CountEntities(snap.Grid); fish != savedFish+5 {
+		t.Errorf("%d fish, want the %d saved and 5 more", fish, savedFish)
+	}
+
+	// The placement can be given in a JSON configuration
+	data, err := json.Marshal(fresh.Placement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Placement
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Kind != FromSnapshot || !decoded.Start.Equal(*fresh.Placement.Start) {
+		t.Errorf("placement decoded from %s differs", data)
+	}
+}
+
+func TestStartGridMustFitTheMap(t *testing.T) {
+	cfg := testConfig(4)
+	start := NewGrid(4, 4)
+	start.Set(1, 1, Entity{Type: Land})
+	cfg.Placement = Placement{Kind: FromSnapshot, Start: &start}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "land at (1, 1)") {
+		t.Errorf("land off the map: error = %v", err)
+	}
+
+	start.Set(1, 1, Entity{Type: Fish})
+	cfg.Map = &WorldMap{Rows: 4, Cols: 4, Cells: make([]CellType, 16)}
+	cfg.Map.Cells[5] = Land
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "on the land") {
+		t.Errorf("fish on land: error = %v", err)
+	}
+
+	start.Set(1, 1, Entity{Type: 9})
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "unknown type") {
+		t.Errorf("unknown species: error = %v", err)
+	}
+
+	start.Set(1, 1, Entity{})
+	for i := 0; i < 16; i++ {
+		start.Set(i/4, i%4, Entity{Type: Fish})
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "do not fit") {
+		t.Errorf("too many entities: error = %v", err)
+	}
+}
+
+func TestStartGridKeepsOffMapEntities(t *testing.T) {
+	cfg := testConfig(4)
+	cfg.InitialFishCount, cfg.InitialSharkCount = 0, 0
+	cfg.Map = &WorldMap{Rows: 4, Cols: 4, Cells: make([]CellType, 16)}
+	cfg.Map.Cells[0] = Fish
+	cfg.Map.Cells[10] = Shark
+	start := NewGrid(4, 4)
+	start.Set(0, 1, Entity{Type: Fish, BreedCounter: 2, Age: 7})
+	start.Set(3, 3, Entity{Type: Shark, StarveCounter: 1})
+	cfg.Placement = Placement{Kind: FromSnapshot, Start: &start}
+
+	grid, err := InitialiseGrid(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fish, sharks := CountEntities(grid); fish != 2 || sharks != 2 {
+		t.Errorf("map and start grid placed %d fish and %d sharks, want 2 and 2", fish, sharks)
+	}
+	if got := grid.At(0, 1); got.BreedCounter != 2 || got.Age != 7 {
+		t.Errorf("start fish placed as %+v", got)
+	}
+
+	// Every cell is now taken, so the map entities only fit if counted once
+	for i := 1; i < 16; i++ {
+		if i != 10 {
+			start.Set(i/4, i%4, Entity{Type: Fish})
+		}
+	}
+	start.Set(0, 0, Entity{})
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("full grid without overlap: %v", err)
+	}
+
+	start.Set(2, 2, Entity{Type: Fish})
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "already places one") {
+		t.Errorf("start fish on a map shark: error = %v", err)
+	}
+}
+
+func TestUniformDensityVariesAroundTheCounts(t *testing.T) {
+	cfg := testConfig(40)
+	cfg.InitialFishCount, cfg.InitialSharkCount = 400, 100
+	cfg.Placement.Kind = UniformDensity
+	counts := map[[2]int]bool{}
+	for seed := int64(1); seed <= 5; seed++ {
+		cfg.Seed = seed
+		grid, err := InitialiseGrid(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fish, sharks := CountEntities(grid)
+		if fish < 300 || fish > 500 || sharks < 50 || sharks > 150 {
+			t.Errorf("seed %d: %d fish and %d sharks, far from 400 and 100", seed, fish, sharks)
+		}
+		counts[[2]int{fish, sharks}] = true
+	}
+	if len(counts) == 1 {
+		t.Error("every seed gave the same populations")
+	}
+
+	cfg.InitialFishCount = 1601
+	if _, err := InitialiseGrid(cfg); err == nil {
+		t.Error("more fish than the grid holds should not be placed")
+	}
+}
@@ -0,0 +1,131 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import "math/rand"
+
+// RandSource is the random number generator used by the simulation. Any
+// generator with these methods can be plugged in through Config.Source;
+// *rand.Rand from math/rand satisfies it.
+type RandSource interface {
+	Intn(n int) int
+	Seed(seed int64)
+}
+
+// SourceFactory creates an unseeded RandSource. The simulation seeds each
+// source itself before using it.
+type SourceFactory func() RandSource
+
+// Step number used to derive the seed of the stream that places the
+// initial entities, so it never collides with the stream of a real step
+const placementStep = -1
+
+/**
+ * @brief Derives the seed of an independent random stream.
+ *
+ * Each band of each step draws from its own stream, so the numbers a band
+ * sees depend only on the run seed, the step and the band, never on which
+ * goroutine runs the band or when. The inputs are combined with the
+ * SplitMix64 finaliser so neighbouring steps and bands get unrelated seeds.
+ *
+ * @param seed The seed of the whole run.
+ * @param step The step number the stream is used for.
+ * @param stream The index of the stream within the step, e.g. the band.
+ * @return The seed of the stream.
+ */
+func StreamSeed(seed int64, step, stream int) int64 {
+	h := mix64(uint64(seed))
+	h = mix64(h ^ uint64(int64(step)))
+	h = mix64(h ^ uint64(int64(stream)))
+	return int64(h)
+}
+
+/**
+ * @brief Returns a new source of the kind selected by the configuration.
+ *
+ * @param cfg The simulation parameters.
+ * @param seed The seed to give the new source.
+ * @return A seeded RandSource.
+ */
+func newSource(cfg Config, seed int64) RandSource {
+	var src RandSource
+	if cfg.Source != nil {
+		src = cfg.Source()
+	} else {
+		src = &splitMix{}
+	}
+	src.Seed(seed)
+	return src
+}
+
+/**
+ * @brief A SourceFactory that uses the generator from math/rand.
+ *
+ * It is much slower to seed than the default generator, which matters
+ * because every band is reseeded every step, but is available for
+ * comparison.
+ *
+ * @return An unseeded *rand.Rand.
+ */
+func MathRandSource() RandSource {
+	return rand.New(rand.NewSource(0))
+}
+
+// splitMix is the default RandSource: a SplitMix64 generator, which is
+// cheap to seed and has no shared state
+type splitMix struct {
+	state uint64
+}
+
+/**
+ * @brief Seeds the generator.
+ *
+ * @param seed The new seed.
+ */
+func (s *splitMix) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+/**
+ * @brief Returns the next 64 random bits.
+ *
+ * @return A uniformly distributed uint64.
+ */
+func (s *splitMix) next() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	return mix64(s.state)
+}
+
+/**
+ * @brief Returns a uniformly distributed integer in [0, n).
+ *
+ * Values from the biased top of the 64-bit range are rejected so that every
+ * result is equally likely. It panics if n is not positive, like rand.Intn.
+ *
+ * @param n The exclusive upper bound.
+ * @return A random integer between 0 and n-1.
+ */
+func (s *splitMix) Intn(n int) int {
+	if n <= 0 {
+		panic("invalid argument to Intn")
+	}
+	bound := uint64(n)
+	limit := -bound % bound // 2^64 mod n values are rejected
+	for {
+		v := s.next()
+		if v >= limit {
+			return int(v % bound)
+		}
+	}
+}
+
+/**
+ * @brief The SplitMix64 finaliser, which scrambles the bits of a value.
+ *
+ * @param z The value to scramble.
+ * @return The scrambled value.
+ */
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
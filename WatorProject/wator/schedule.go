@@ -0,0 +1,116 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Upper bound on the number of bands the grid is split into for parallel
+// updates, which keeps per-band overhead small on large grids while still
+// allowing plenty of parallelism
+const maxBands = 64
+
+/**
+ * @brief Splits the rows of the grid into bands for a phased parallel update.
+ *
+ * The number of bands depends only on the number of rows, never on the
+ * number of threads, so every thread count updates the grid in exactly the
+ * same bands. The band count is always even so that, on a toroidal grid,
+ * the first and last bands (which touch across the wraparound) belong to
+ * different phases. Grids too small to split safely are returned as a
+ * single band.
+ *
+ * An entity reads and writes at most `reach` rows either side of its own,
+ * so two bands updated at the same time must be separated by a band at
+ * least 2*reach rows high to never touch the same row.
+ *
+ * @param rows The number of rows in the grid.
+ * @param reach The largest row offset of the neighbourhood.
+ * @return A slice of [start, end) row ranges covering every row once.
+ */
+func partitionBands(rows, reach int) [][2]int {
+	count := min(rows/(2*reach), maxBands)
+	count -= count % 2
+	if count < 2 {
+		return [][2]int{{0, rows}}
+	}
+
+	bands := make([][2]int, count)
+	start := 0
+	for i := range bands {
+		// Spread the remainder over the first bands so heights differ by at most one
+		end := start + rows/count
+		if i < rows%count {
+			end++
+		}
+		bands[i] = [2]int{start, end}
+		start = end
+	}
+	return bands
+}
+
+/**
+ * @brief Runs `work` over every band using a two-phase schedule.
+ *
+ * Even-numbered bands are processed first, in parallel, followed by the
+ * odd-numbered bands. Bands running in the same phase are separated by a
+ * band, idle during that phase, that is at least twice the reach of the
+ * neighbourhood high, so no two goroutines ever read or write the same
+ * cell concurrently. Each band
+ * is processed sequentially by a single goroutine, and up to `numThreads`
+ * goroutines share the bands of each phase. A single thread visits the
+ * bands in the same phase order, so the result of an update does not
+ * depend on how many threads performed it.
+ *
+ * @param bands The row bands produced by partitionBands.
+ * @param numThreads The maximum number of goroutines to use per phase.
+ * @param work The function called with the index and row range of each band.
+ */
+func runBands(bands [][2]int, numThreads int, work func(band, startRow, endRow int)) {
+	for phase := 0; phase < 2; phase++ {
+		phaseBands := (len(bands) - phase + 1) / 2
+		workers := min(numThreads, phaseBands)
+
+		if workers <= 1 {
+			// Same order as the parallel schedule, just on this goroutine
+			for i := phase; i < len(bands); i += 2 {
+				work(i, bands[i][0], bands[i][1])
+			}
+			continue
+		}
+
+		runPhase(bands, phase, workers, work)
+	}
+}
+
+/**
+ * @brief Runs `work` over the bands of one phase on several goroutines.
+ *
+ * Each goroutine repeatedly claims the next unprocessed band of the phase
+ * until none are left. This is kept apart from runBands so the state shared
+ * by the goroutines is only allocated when more than one thread is used.
+ *
+ * @param bands The row bands produced by partitionBands.
+ * @param phase The phase to run: 0 for the even bands, 1 for the odd bands.
+ * @param workers The number of goroutines to start.
+ * @param work The function called with the index and row range of each band.
+ */
+func runPhase(bands [][2]int, phase, workers int, work func(band, startRow, endRow int)) {
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)-1)*2 + phase
+				if i >= len(bands) {
+					return
+				}
+				work(i, bands[i][0], bands[i][1])
+			}
+		}()
+	}
+	wg.Wait()
+}
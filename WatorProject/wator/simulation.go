@@ -0,0 +1,487 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// Simulation is a running Wator world that can be stepped from any caller:
+// a window, a test, a benchmark or a server. It is not safe for concurrent
+// use; callers sharing one between goroutines must synchronise access.
+type Simulation struct {
+	cfg        Config
+	world      *World
+	numThreads int
+	step       int
+	fish       int
+	sharks     int
+	lastReport StepReport
+	stats      Statistics
+	// keepStats is the most steps of statistics kept, or 0 to keep them all
+	keepStats int
+}
+
+/**
+ * @brief Counts the population of every species under rules other than
+ *        the classic fish and sharks.
+ *
+ * @param rules The rules of the simulation.
+ * @param grid The grid to count.
+ * @return The population of each species in the order they were
+ *         registered, or nil under the built-in rules, whose populations
+ *         are the fish and shark counts.
+ */
+func speciesPopulations(rules *Rules, grid Grid) []SpeciesPopulation {
+	if rules == builtinRules {
+		return nil
+	}
+	var counts [numCellTypes]int
+	for _, cellType := range grid.Types {
+		counts[cellType]++
+	}
+
+	populations := make([]SpeciesPopulation, 0, len(rules.species)-1)
+	for _, t := range rules.Types() {
+		populations = append(populations, SpeciesPopulation{Name: rules.Species(t).Name(), Count: counts[t]})
+	}
+	return populations
+}
+
+/**
+ * @brief Creates a simulation with a freshly populated grid.
+ *
+ * @param cfg The simulation parameters, including the seed.
+ * @param numThreads The number of threads used for each step.
+ * @return The new simulation, or an error if the configuration is invalid.
+ */
+func NewSimulation(cfg Config, numThreads int) (*Simulation, error) {
+	if numThreads < 1 {
+		return nil, fmt.Errorf("thread count must be at least 1, got %d", numThreads)
+	}
+
+	s := &Simulation{numThreads: numThreads}
+	if err := s.reset(cfg); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+/**
+ * @brief Replaces the world with a new grid built from the configuration.
+ *
+ * @param cfg The simulation parameters to start from.
+ * @return nil on success, or an error if the configuration is invalid.
+ */
+func (s *Simulation) reset(cfg Config) error {
+	grid, err := InitialiseGrid(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.cfg = cfg
+	s.world = NewWorld(grid)
+	s.world.prepare(cfg)
+	s.step = 0
+	s.fish, s.sharks = CountEntities(grid)
+	s.lastReport = StepReport{}
+	s.stats = Statistics{newStepStats(0, s.fish, s.sharks, s.cells(), StepReport{}, TotalSharkEnergy(grid),
+		cfg.SharkEnergyModel, speciesPopulations(s.world.rules, grid))}
+	return nil
+}
+
+/**
+ * @brief Starts the simulation again from step zero with a new seed.
+ *
+ * The grid is repopulated using the same parameters, so resetting twice
+ * with the same seed gives the same world.
+ *
+ * @param seed The seed for the new run.
+ * @return nil on success, or an error if the grid could not be built.
+ */
+func (s *Simulation) Reset(seed int64) error {
+	cfg := s.cfg
+	cfg.Seed = seed
+	return s.reset(cfg)
+}
+
+/**
+ * @brief Advances the simulation by one step.
+ *
+ * @return The counts of entities moved, born, eaten and starved in the step.
+ */
+func (s *Simulation) Step() StepReport {
+	report := UpdateSimulation(s.cfg, s.world, s.numThreads, s.step)
+	s.apply(report)
+	return report
+}
+
+/**
+ * @brief Advances the simulation by one step, recording every event.
+ *
+ * @return The counts and events of the step (see TraceSimulation).
+ */
+func (s *Simulation) Trace() StepReport {
+	report := TraceSimulation(s.cfg, s.world, s.numThreads, s.step)
+	s.apply(report)
+	return report
+}
+
+/**
+ * @brief Advances the simulation by `n` steps.
+ *
+ * @param n The number of steps to take.
+ * @return The counts of all the steps added together.
+ */
+func (s *Simulation) StepN(n int) Accounting {
+	var total StepReport
+	for i := 0; i < n; i++ {
+		report := s.Step()
+		total.merge(&report)
+	}
+	return total.Accounting
+}
+
+/**
+ * @brief Updates the step number, population counts and statistics after a step.
+ *
+ * @param report The report of the step just taken.
+ */
+func (s *Simulation) apply(report StepReport) {
+	s.step++
+	s.fish += report.FishBorn - report.FishEaten - report.FishStarved
+	s.sharks += report.SharksBorn - report.SharksStarved - report.SharksEaten
+	s.lastReport = report
+	s.stats = append(s.stats, newStepStats(s.step, s.fish, s.sharks, s.cells(), report, report.SharkEnergy,
+		s.cfg.SharkEnergyModel, speciesPopulations(s.world.rules, s.world.Grid())))
+	// The oldest entries are dropped in batches, so the series never holds
+	// more than twice the limit and is copied only once every keepStats steps
+	if s.keepStats > 0 && len(s.stats) >= 2*s.keepStats {
+		s.stats = append(s.stats[:0], s.kept()...)
+	}
+}
+
+/**
+ * @brief Limits the statistics kept to those of the most recent steps.
+ *
+ * Without a limit a simulation keeps an entry for every step, which grows
+ * without bound over a long run; a window that only graphs the last few
+ * hundred steps can keep just those. The limit lasts across resets.
+ *
+ * @param n The most entries to keep, or 0 to keep every step.
+ */
+func (s *Simulation) KeepStats(n int) {
+	s.keepStats = max(n, 0)
+	s.stats = slices.Clone(s.kept())
+}
+
+/**
+ * @brief Returns the entries of the statistics within the limit.
+ *
+ * @return The last keepStats entries, or all of them without a limit.
+ */
+func (s *Simulation) kept() Statistics {
+	if s.keepStats == 0 {
+		return s.stats
+	}
+	return s.stats[max(len(s.stats)-s.keepStats, 0):]
+}
+
+/**
+ * @brief Returns the number of cells entities can live in.
+ *
+ * @return The number of water cells, which is every cell without a map.
+ */
+func (s *Simulation) cells() int {
+	return s.cfg.WaterCells()
+}
+
+/**
+ * @brief Returns the parameters the simulation is running with.
+ *
+ * @return A copy of the configuration, including the current seed.
+ */
+func (s *Simulation) Config() Config {
+	return s.cfg
+}
+
+/**
+ * @brief Returns the number of steps taken since the last reset.
+ *
+ * @return The step count.
+ */
+func (s *Simulation) StepCount() int {
+	return s.step
+}
+
+/**
+ * @brief Returns the number of threads used for each step.
+ *
+ * @return The thread count.
+ */
+func (s *Simulation) Threads() int {
+	return s.numThreads
+}
+
+/**
+ * @brief Changes the number of threads used for each step.
+ *
+ * The thread count never changes the outcome of a step, only its speed.
+ *
+ * @param numThreads The new thread count; values below one are treated as one.
+ */
+func (s *Simulation) SetThreads(numThreads int) {
+	s.numThreads = max(numThreads, 1)
+}
+
+/**
+ * @brief Returns the current number of fish and sharks.
+ *
+ * In a food web these are the first two species; see Populations.
+ *
+ * @return The number of fish and the number of sharks, in that order.
+ */
+func (s *Simulation) Population() (fish, sharks int) {
+	return s.fish, s.sharks
+}
+
+/**
+ * @brief Returns the current population of every species.
+ *
+ * @return The name and count of each species, in the order they were
+ *         registered.
+ */
+func (s *Simulation) Populations() []SpeciesPopulation {
+	if latest := s.stats[len(s.stats)-1].Populations; latest != nil {
+		return slices.Clone(latest)
+	}
+	return []SpeciesPopulation{{Name: "fish", Count: s.fish}, {Name: "shark", Count: s.sharks}}
+}
+
+/**
+ * @brief Returns the species the simulation runs with.
+ *
+ * The rules must not be changed.
+ *
+ * @return The rules, which are DefaultRules unless the configuration sets
+ *         a food web or rules of its own.
+ */
+func (s *Simulation) Rules() *Rules {
+	return s.world.rules
+}
+
+/**
+ * @brief Returns the report of the most recent step.
+ *
+ * @return The last StepReport, or an empty report if no step has been taken.
+ */
+func (s *Simulation) LastReport() StepReport {
+	return s.lastReport
+}
+
+/**
+ * @brief Returns the statistics of every step since the last reset.
+ *
+ * The first entry describes the initial grid and each later entry the grid
+ * after one step, so entry i is the state after i steps. With a limit set
+ * by KeepStats only the most recent steps are returned.
+ *
+ * @return A copy of the time series.
+ */
+func (s *Simulation) Stats() Statistics {
+	return slices.Clone(s.kept())
+}
+
+/**
+ * @brief Returns the statistics of the most recent steps.
+ *
+ * Only the entries asked for are copied, so a window can read them every
+ * frame however long the run has been going.
+ *
+ * @param n The most entries to return.
+ * @return A copy of the last n entries of Stats, or of all of them if
+ *         there are fewer.
+ */
+func (s *Simulation) RecentStats(n int) Statistics {
+	stats := s.kept()
+	return slices.Clone(stats[max(len(stats)-max(n, 0), 0):])
+}
+
+/**
+ * @brief Returns the size of the grid.
+ *
+ * @return The number of rows and the number of columns, in that order.
+ */
+func (s *Simulation) Size() (rows, cols int) {
+	grid := s.world.Grid()
+	return grid.Rows, grid.Cols
+}
+
+/**
+ * @brief Returns a copy of the entity in a cell.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return The entity in the cell, or an Entity of type Empty if there is none.
+ */
+func (s *Simulation) Cell(x, y int) Entity {
+	return s.world.Grid().At(x, y)
+}
+
+/**
+ * @brief Puts a newborn entity in a cell, or empties it, between steps.
+ *
+ * The entity starts with the counters given by its species' Newborn
+ * method, replacing whatever was in the cell. The population counts and
+ * the statistics of the current step are updated to describe the grid as
+ * it now is.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @param cellType The species to put in the cell, or Empty to clear it.
+ * @return nil on success, or an error if the cell is outside the grid or
+ *         is land, or the type is neither Empty nor a species.
+ */
+func (s *Simulation) Paint(x, y int, cellType CellType) error {
+	grid := s.world.Grid()
+	if x < 0 || x >= grid.Rows || y < 0 || y >= grid.Cols {
+		return fmt.Errorf("cell (%d, %d) is outside the %dx%d grid", x, y, grid.Cols, grid.Rows)
+	}
+	i := grid.Index(x, y)
+	if grid.Types[i] == Land {
+		return fmt.Errorf("cell (%d, %d) is land", x, y)
+	}
+	if cellType == Empty {
+		grid.clear(i)
+	} else {
+		species := s.world.rules.Species(cellType)
+		if species == nil {
+			return fmt.Errorf("type %d is not a species of the simulation", cellType)
+		}
+		e := species.Newborn(s.cfg)
+		grid.put(i, cellType, int32(e.BreedCounter), int32(e.StarveCounter), int32(e.Energy), 0)
+	}
+
+	s.fish, s.sharks = CountEntities(grid)
+	s.stats[len(s.stats)-1] = newStepStats(s.step, s.fish, s.sharks, s.cells(), s.lastReport, TotalSharkEnergy(grid),
+		s.cfg.SharkEnergyModel, speciesPopulations(s.world.rules, grid))
+	return nil
+}
+
+/**
+ * @brief Returns the nutrient left in a cell.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return The nutrient, and false if the configuration has no nutrient map.
+ */
+func (s *Simulation) Nutrient(x, y int) (float32, bool) {
+	return s.world.Nutrient(x, y)
+}
+
+/**
+ * @brief Returns the nutrient left in every cell without copying it.
+ *
+ * Like View, the levels share storage with the simulation, so they are
+ * only valid until the next step or reset and must not be changed.
+ *
+ * @return The nutrient of each cell in the order of the grid, or nil if
+ *         the configuration has no nutrient map.
+ */
+func (s *Simulation) Nutrients() []float32 {
+	return s.world.nutrients
+}
+
+/**
+ * @brief Returns a snapshot of the whole grid.
+ *
+ * The grid is copied, so the snapshot is unaffected by later steps and
+ * changing it does not affect the simulation.
+ *
+ * @return A copy of the grid.
+ */
+func (s *Simulation) Grid() Grid {
+	return s.world.Grid().Clone()
+}
+
+/**
+ * @brief Returns the grid without copying it, for callers that read every
+ *        cell often, such as a renderer.
+ *
+ * The grid shares storage with the simulation, so it is only valid until
+ * the next step, reset or paint and must not be changed; use Grid to keep
+ * a copy.
+ *
+ * @return The current grid.
+ */
+func (s *Simulation) View() Grid {
+	return s.world.Grid()
+}
+
+/**
+ * @brief Runs a simulation without a window, printing population counts.
+ *
+ * The simulation is advanced until it has taken the given number of steps.
+ * The seed is written to `out` first so the run can be repeated, then a
+ * line with the step number, fish count and shark count for the current
+ * grid and after every `every` steps, followed by the total time taken.
+ * The full statistics remain available from the simulation afterwards.
+ *
+ * @param sim The simulation to run.
+ * @param steps The step count to run the simulation up to.
+ * @param every How many steps to run between printed lines.
+ * @param out Where the population counts are written.
+ */
+func RunHeadless(sim *Simulation, steps, every int, out io.Writer) {
+	every = max(every, 1)
+
+	fmt.Fprintf(out, "seed %d\n", sim.Config().Seed)
+	fmt.Fprintf(out, "%8s", "step")
+	for _, p := range sim.Populations() {
+		fmt.Fprintf(out, " %8s", headlessColumn(p.Name))
+	}
+	fmt.Fprintln(out)
+	printPopulations(sim, out)
+
+	startTime := time.Now()
+	taken := 0
+	for sim.StepCount() < steps {
+		sim.Step()
+		taken++
+		if step := sim.StepCount(); step%every == 0 || step == steps {
+			printPopulations(sim, out)
+		}
+	}
+
+	fmt.Fprintf(out, "%d steps in %v\n", taken, time.Since(startTime))
+}
+
+/**
+ * @brief Returns the heading of a population column of RunHeadless.
+ *
+ * @param name The name of the species.
+ * @return The name, made plural for the built-in shark so the classic
+ *         output keeps its "fish" and "sharks" columns.
+ */
+func headlessColumn(name string) string {
+	if name == "shark" {
+		return "sharks"
+	}
+	return name
+}
+
+/**
+ * @brief Writes the step number and population of every species on one line.
+ *
+ * @param sim The simulation to describe.
+ * @param out Where the line is written.
+ */
+func printPopulations(sim *Simulation, out io.Writer) {
+	fmt.Fprintf(out, "%8d", sim.StepCount())
+	for _, p := range sim.Populations() {
+		fmt.Fprintf(out, " %8d", p.Count)
+	}
+	fmt.Fprintln(out)
+}
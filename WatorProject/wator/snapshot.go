@@ -0,0 +1,974 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Identifiers and version of the snapshot formats. The version is bumped
+// whenever the saved state changes, and readers reject versions they do
+// not know rather than guessing. Version 1 stored a single grid size for
+// square grids; version 2 stores the width and height separately,
+// version 3 adds the boundary mode, which is Torus in older snapshots,
+// version 4 adds the neighbourhood, which is von Neumann of radius one in
+// older snapshots, version 5 adds the shark energy model, which is off in
+// older snapshots, version 6 adds the food web, which older snapshots
+// do not have, version 7 adds the environment and the nutrient left in
+// each cell, version 8 adds the world map, version 9 adds the
+// placement, which is Uniform in older snapshots, version 10 adds the
+// age of each entity, which is zero in older snapshots, and version 11
+// adds the start grid of FromSnapshot placement.
+const (
+	SnapshotVersion    = 11
+	oldestSnapshot     = 1
+	snapshotFormat     = "wator-snapshot"
+	snapshotMagic      = "WATR"
+	maxSnapshotEntries = 1 << 25
+	maxSnapshotString  = 1 << 10
+	// minEntityBytes is the fewest bytes an entity takes in a binary
+	// snapshot: a byte each for the cells skipped, the type and the two
+	// counters
+	minEntityBytes = 4
+)
+
+// Snapshot is the complete state of a simulation at the end of a step. The
+// random streams are derived from the seed in Config and the step number,
+// so restoring a snapshot and stepping on reproduces the original run.
+type Snapshot struct {
+	Version int
+	Step    int
+	Config  Config
+	Grid    Grid
+	// Nutrients is the nutrient left in each cell, in row-major order, or
+	// nil if the configuration has no nutrient map
+	Nutrients []float32
+}
+
+// snapshotJSON is the layout of the JSON snapshot format. Only occupied
+// cells are listed.
+type snapshotJSON struct {
+	Format    string           `json:"format"`
+	Version   int              `json:"version"`
+	Step      int              `json:"step"`
+	Config    Config           `json:"config"`
+	Rows      int              `json:"rows"`
+	Cols      int              `json:"cols"`
+	Entities  []snapshotEntity `json:"entities"`
+	Nutrients []float32        `json:"nutrients,omitempty"`
+}
+
+type snapshotEntity struct {
+	X             int      `json:"x"`
+	Y             int      `json:"y"`
+	Type          CellType `json:"type"`
+	BreedCounter  int      `json:"breedCounter"`
+	StarveCounter int      `json:"starveCounter"`
+	Energy        int      `json:"energy,omitempty"`
+	Age           int      `json:"age,omitempty"`
+}
+
+/**
+ * @brief Captures the current state of the simulation.
+ *
+ * @return A snapshot holding a copy of the grid.
+ */
+func (s *Simulation) Snapshot() Snapshot {
+	return Snapshot{
+		Version: SnapshotVersion,
+		Step:    s.step,
+		Config:  s.cfg,
+		Grid:    s.Grid(),
+		// Cloned, as the world keeps grazing and regrowing its own copy
+		Nutrients: slices.Clone(s.world.nutrients),
+	}
+}
+
+/**
+ * @brief Replaces the state of the simulation with a snapshot.
+ *
+ * The statistics restart from the snapshot's step. The random source and
+ * rules in the simulation's current configuration are kept, as they cannot
+ * be saved, unless the snapshot's configuration sets its own or, for the
+ * rules, has a food web.
+ *
+ * @param snap The snapshot to restore.
+ * @return nil on success, or an error if the snapshot is not valid.
+ */
+func (s *Simulation) Restore(snap Snapshot) error {
+	cfg := snap.Config
+	if cfg.Source == nil {
+		cfg.Source = s.cfg.Source
+	}
+	if cfg.Rules == nil && len(cfg.FoodWeb) == 0 {
+		cfg.Rules = s.cfg.Rules
+	}
+	snap.Config = cfg
+	if err := snap.Validate(); err != nil {
+		return err
+	}
+
+	s.cfg = cfg
+	s.world = NewWorld(snap.Grid.Clone())
+	s.world.prepare(cfg)
+	if snap.Nutrients != nil {
+		copy(s.world.nutrients, snap.Nutrients)
+	}
+	s.step = snap.Step
+	s.fish, s.sharks = CountEntities(snap.Grid)
+	s.lastReport = StepReport{}
+	s.stats = Statistics{newStepStats(s.step, s.fish, s.sharks, s.cells(), StepReport{}, TotalSharkEnergy(snap.Grid),
+		cfg.SharkEnergyModel, speciesPopulations(s.world.rules, snap.Grid))}
+	return nil
+}
+
+/**
+ * @brief Creates a simulation that continues from a snapshot.
+ *
+ * @param snap The snapshot to start from.
+ * @param numThreads The number of threads used for each step.
+ * @return The new simulation, or an error if the snapshot is not valid.
+ */
+func NewSimulationFromSnapshot(snap Snapshot, numThreads int) (*Simulation, error) {
+	if numThreads < 1 {
+		return nil, fmt.Errorf("thread count must be at least 1, got %d", numThreads)
+	}
+
+	s := &Simulation{numThreads: numThreads}
+	if err := s.Restore(snap); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+/**
+ * @brief Checks that a snapshot can be restored.
+ *
+ * Every entity must belong to a species of the rules in the snapshot's
+ * configuration.
+ *
+ * @return nil if the snapshot is valid, otherwise an error describing the
+ *         first problem found.
+ */
+func (snap Snapshot) Validate() error {
+	return snap.validate(snap.Config.rules())
+}
+
+/**
+ * @brief Checks that a snapshot is well formed.
+ *
+ * Snapshots are read without knowing which rules they will be restored
+ * with, so the readers check everything but the species.
+ *
+ * @param rules The rules the cell types must belong to, or nil to accept
+ *        any type but Empty for an entity.
+ * @return nil if the snapshot is valid, otherwise an error describing the
+ *         first problem found.
+ */
+func (snap Snapshot) validate(rules *Rules) error {
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("snapshot version %d is not the current version %d", snap.Version, SnapshotVersion)
+	}
+	if snap.Step < 0 {
+		return fmt.Errorf("snapshot step must not be negative, got %d", snap.Step)
+	}
+	if err := snap.Config.Validate(); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+
+	grid := snap.Grid
+	rows, cols := snap.Config.GridHeight, snap.Config.GridWidth
+	if grid.Rows != rows || grid.Cols != cols {
+		return fmt.Errorf("snapshot grid is %dx%d, config expects %dx%d", grid.Cols, grid.Rows, cols, rows)
+	}
+	cells := rows * cols
+	if len(grid.Types) != cells || len(grid.Breed) != cells || len(grid.Starve) != cells || len(grid.Energy) != cells ||
+		len(grid.Age) != cells {
+		return fmt.Errorf("snapshot grid arrays do not hold %d cells", cells)
+	}
+	for i, cellType := range grid.Types {
+		if rules != nil && cellType != Empty && cellType != Land && rules.Species(cellType) == nil {
+			return fmt.Errorf("snapshot cell (%d, %d) has unknown type %d", i/cols, i%cols, cellType)
+		}
+	}
+
+	if snap.Nutrients == nil {
+		return nil
+	}
+	if env := snap.Config.Environment; env == nil || env.Nutrients == nil {
+		return errors.New("snapshot holds nutrient levels without a nutrient map")
+	}
+	if len(snap.Nutrients) != cells {
+		return fmt.Errorf("snapshot holds nutrient levels for %d cells, want %d", len(snap.Nutrients), cells)
+	}
+	for i, level := range snap.Nutrients {
+		if !(level >= 0) || math.IsInf(float64(level), 0) {
+			return fmt.Errorf("snapshot cell (%d, %d) has nutrient level %v", i/cols, i%cols, level)
+		}
+	}
+	return nil
+}
+
+/**
+ * @brief Writes a snapshot in the JSON format.
+ *
+ * @param w Where the snapshot is written.
+ * @param snap The snapshot to write.
+ * @return nil on success, or the error from writing.
+ */
+func WriteSnapshotJSON(w io.Writer, snap Snapshot) error {
+	doc := snapshotJSON{
+		Format:    snapshotFormat,
+		Version:   snap.Version,
+		Step:      snap.Step,
+		Config:    snap.Config,
+		Rows:      snap.Grid.Rows,
+		Cols:      snap.Grid.Cols,
+		Entities:  snapshotEntities(snap.Grid),
+		Nutrients: snap.Nutrients,
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+/**
+ * @brief Reads a snapshot written by WriteSnapshotJSON.
+ *
+ * Snapshots from older versions of the format are upgraded to the current
+ * version as they are read. The species of the entities are only checked
+ * when the snapshot is restored, against the rules it is restored with.
+ *
+ * @param r Where the snapshot is read from.
+ * @return The snapshot, or an error if it is malformed or invalid.
+ */
+func ReadSnapshotJSON(r io.Reader) (Snapshot, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("reading snapshot: %w", err)
+	}
+	var doc snapshotJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Snapshot{}, fmt.Errorf("reading snapshot: %w", err)
+	}
+	if doc.Format != snapshotFormat {
+		return Snapshot{}, fmt.Errorf("not a wator snapshot (format %q)", doc.Format)
+	}
+	if err := checkSnapshotVersion(doc.Version); err != nil {
+		return Snapshot{}, err
+	}
+	if doc.Version == 1 {
+		// Version 1 configs hold one size for both sides of the grid
+		var v1 struct {
+			Config struct {
+				GridSize int `json:"gridSize"`
+			} `json:"config"`
+		}
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return Snapshot{}, fmt.Errorf("reading snapshot: %w", err)
+		}
+		doc.Config.GridWidth = v1.Config.GridSize
+		doc.Config.GridHeight = v1.Config.GridSize
+	}
+	if doc.Version < 4 {
+		doc.Config.Neighbourhood, doc.Config.Radius = VonNeumann, DefaultRadius
+	}
+	grid, err := gridFromEntities(doc.Rows, doc.Cols, doc.Entities)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snap := Snapshot{
+		Version: SnapshotVersion,
+		Step:    doc.Step,
+		Config:  doc.Config,
+		Grid:    grid,
+		// Left for validate to check against the grid
+		Nutrients: doc.Nutrients,
+	}
+	if err := snap.validate(nil); err != nil {
+		return Snapshot{}, err
+	}
+	return snap, nil
+}
+
+/**
+ * @brief Writes a snapshot in the compact binary format.
+ *
+ * The file starts with the magic bytes "WATR" followed by variable length
+ * integers: the version, step, every config parameter (strings being
+ * written as their length followed by their bytes, floating point numbers
+ * as the integers holding their bits, the world map as its size followed
+ * by a byte per cell, and the start grid of the placement as the grid is
+ * stored), then the grid: the number of rows and columns and the number of
+ * entities. Each entity is then stored as the number of cells skipped
+ * since the previous entity (in row-major order), its type as a single
+ * byte, its breed and starve counters, its energy and its age. Land cells
+ * are stored in the same way. The nutrient left in each cell comes last,
+ * as a count that is zero without a nutrient map and the levels.
+ *
+ * @param w Where the snapshot is written.
+ * @param snap The snapshot to write.
+ * @return nil on success, or the error from writing.
+ */
+func WriteSnapshotBinary(w io.Writer, snap Snapshot) error {
+	bw := bufio.NewWriter(w)
+	var buf [binary.MaxVarintLen64]byte
+	putInt := func(v int64) {
+		bw.Write(buf[:binary.PutVarint(buf[:], v)])
+	}
+
+	bw.WriteString(snapshotMagic)
+	cfg := snap.Config
+	for _, v := range []int{
+		snap.Version, snap.Step,
+		cfg.ScreenWidth, cfg.ScreenHeight, cfg.GridWidth, cfg.GridHeight,
+		cfg.InitialFishCount, cfg.InitialSharkCount,
+		cfg.FishBreedTime, cfg.SharkBreedTime, cfg.SharkStarveTime,
+	} {
+		putInt(int64(v))
+	}
+	putInt(cfg.Seed)
+	putInt(int64(cfg.Boundary))
+	putInt(int64(cfg.Neighbourhood))
+	putInt(int64(cfg.Radius))
+	energyModel := 0
+	if cfg.SharkEnergyModel {
+		energyModel = 1
+	}
+	for _, v := range []int{
+		energyModel, cfg.SharkInitialEnergy, cfg.SharkEnergyPerFish, cfg.SharkMaxEnergy, cfg.SharkMoveCost,
+	} {
+		putInt(int64(v))
+	}
+	putString := func(s string) {
+		putInt(int64(len(s)))
+		bw.WriteString(s)
+	}
+	putInt(int64(len(cfg.FoodWeb)))
+	for _, species := range cfg.FoodWeb {
+		putString(species.Name)
+		putString(species.Colour)
+		stationary := 0
+		if species.Stationary {
+			stationary = 1
+		}
+		for _, v := range []int{species.InitialCount, species.BreedTime, species.StarveTime, stationary, len(species.Eats)} {
+			putInt(int64(v))
+		}
+		for _, prey := range species.Eats {
+			putString(prey)
+		}
+	}
+	putFloats := func(values []float32) {
+		for _, v := range values {
+			putInt(int64(math.Float32bits(v)))
+		}
+	}
+	putLayer := func(layer *Layer) {
+		if layer == nil {
+			// A map with no rows or columns is one that is not there
+			putInt(0)
+			putInt(0)
+			return
+		}
+		putInt(int64(layer.Rows))
+		putInt(int64(layer.Cols))
+		putFloats(layer.Values)
+	}
+	if env := cfg.Environment; env == nil {
+		putInt(0)
+	} else {
+		putInt(1)
+		putInt(int64(math.Float64bits(env.NutrientRegrowth)))
+		for _, layer := range []*Layer{env.Nutrients, env.Temperature, env.CurrentX, env.CurrentY} {
+			putLayer(layer)
+		}
+	}
+	if cfg.Map == nil {
+		putInt(0)
+		putInt(0)
+	} else {
+		putInt(int64(cfg.Map.Rows))
+		putInt(int64(cfg.Map.Cols))
+		for _, cellType := range cfg.Map.Cells {
+			bw.WriteByte(byte(cellType))
+		}
+	}
+	putInt(int64(cfg.Placement.Kind))
+	putInt(int64(cfg.Placement.Clusters))
+	putInt(int64(math.Float64bits(cfg.Placement.Spread)))
+	putInt(int64(cfg.Placement.StripeWidth))
+	putLayer(cfg.Placement.Density)
+	putGrid := func(grid Grid) {
+		putInt(int64(grid.Rows))
+		putInt(int64(grid.Cols))
+		occupied := 0
+		for _, cellType := range grid.Types {
+			if cellType != Empty {
+				occupied++
+			}
+		}
+		putInt(int64(occupied))
+		gap := 0
+		for i, cellType := range grid.Types {
+			if cellType == Empty {
+				gap++
+				continue
+			}
+			putInt(int64(gap))
+			bw.WriteByte(byte(cellType))
+			putInt(int64(grid.Breed[i]))
+			putInt(int64(grid.Starve[i]))
+			putInt(int64(grid.Energy[i]))
+			putInt(int64(grid.Age[i]))
+			gap = 0
+		}
+	}
+	if start := cfg.Placement.Start; start != nil {
+		putGrid(*start)
+	} else {
+		// A grid with no rows or columns is one that is not there
+		putGrid(Grid{})
+	}
+	putGrid(snap.Grid)
+	putInt(int64(len(snap.Nutrients)))
+	putFloats(snap.Nutrients)
+
+	return bw.Flush()
+}
+
+/**
+ * @brief Reads a snapshot written by WriteSnapshotBinary.
+ *
+ * As with ReadSnapshotJSON, the species of the entities are only checked
+ * when the snapshot is restored. When r reports how much is left to read,
+ * as a bytes.Reader does, the counts in the snapshot are checked against
+ * it before anything is read.
+ *
+ * @param r Where the snapshot is read from.
+ * @return The snapshot, or an error if it is malformed or invalid.
+ */
+func ReadSnapshotBinary(r io.Reader) (Snapshot, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshotMagic {
+		return Snapshot{}, errors.New("not a wator binary snapshot")
+	}
+
+	var readErr error
+	// fits reports whether n values of at least size bytes each can still
+	// be read, when the length of the input is known, so a count in the
+	// header cannot claim more data than the snapshot holds
+	sized, known := r.(interface{ Len() int })
+	fits := func(n, size int) bool {
+		return !known || n <= (sized.Len()+br.Buffered())/size
+	}
+	getInt := func() int {
+		if readErr != nil {
+			return 0
+		}
+		v, err := binary.ReadVarint(br)
+		if err != nil {
+			readErr = fmt.Errorf("reading snapshot: %w", err)
+		}
+		return int(v)
+	}
+	getString := func() string {
+		n := getInt()
+		if readErr != nil {
+			return ""
+		}
+		if n < 0 || n > maxSnapshotString {
+			readErr = fmt.Errorf("snapshot string of %d bytes is out of range", n)
+			return ""
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			readErr = fmt.Errorf("reading snapshot: %w", err)
+		}
+		return string(b)
+	}
+
+	var snap Snapshot
+	snap.Version = getInt()
+	if readErr != nil {
+		return Snapshot{}, readErr
+	}
+	if err := checkSnapshotVersion(snap.Version); err != nil {
+		return Snapshot{}, err
+	}
+
+	cfg := &snap.Config
+	fields := []*int{&snap.Step, &cfg.ScreenWidth, &cfg.ScreenHeight, &cfg.GridWidth, &cfg.GridHeight}
+	if snap.Version == 1 {
+		// Version 1 stores one size for both sides of the grid
+		fields = fields[:4]
+	}
+	fields = append(fields, &cfg.InitialFishCount, &cfg.InitialSharkCount,
+		&cfg.FishBreedTime, &cfg.SharkBreedTime, &cfg.SharkStarveTime)
+	for _, field := range fields {
+		*field = getInt()
+	}
+	if snap.Version == 1 {
+		cfg.GridHeight = cfg.GridWidth
+	}
+	cfg.Seed = int64(getInt())
+	if snap.Version >= 3 {
+		cfg.Boundary = Boundary(getInt())
+	}
+	cfg.Radius = DefaultRadius
+	if snap.Version >= 4 {
+		cfg.Neighbourhood = NeighbourhoodKind(getInt())
+		cfg.Radius = getInt()
+	}
+	if snap.Version >= 5 {
+		cfg.SharkEnergyModel = getInt() != 0
+		cfg.SharkInitialEnergy, cfg.SharkEnergyPerFish = getInt(), getInt()
+		cfg.SharkMaxEnergy, cfg.SharkMoveCost = getInt(), getInt()
+	}
+	if snap.Version >= 6 {
+		web, err := readFoodWeb(getInt, getString)
+		if err != nil && readErr == nil {
+			return Snapshot{}, err
+		}
+		cfg.FoodWeb = web
+	}
+	getFloats := func(n int) []float32 {
+		if readErr == nil && !fits(n, 1) {
+			readErr = fmt.Errorf("snapshot claims %d values, more than the data left holds", n)
+		}
+		// Grown as the values are read rather than allocated up front
+		var values []float32
+		for i := 0; i < n && readErr == nil; i++ {
+			values = append(values, math.Float32frombits(uint32(getInt())))
+		}
+		return values
+	}
+	if snap.Version >= 7 {
+		env, err := readEnvironment(getInt, getFloats)
+		if err != nil && readErr == nil {
+			return Snapshot{}, err
+		}
+		cfg.Environment = env
+	}
+	nutrientsStored := snap.Version >= 7
+	if snap.Version >= 8 {
+		m, err := readWorldMap(br, getInt)
+		if err != nil && readErr == nil {
+			readErr = err
+		}
+		cfg.Map = m
+	}
+	if snap.Version >= 9 {
+		p := &cfg.Placement
+		p.Kind, p.Clusters = PlacementKind(getInt()), getInt()
+		p.Spread, p.StripeWidth = math.Float64frombits(uint64(getInt())), getInt()
+		density, err := readLayer(getInt, getFloats)
+		if err != nil && readErr == nil {
+			return Snapshot{}, err
+		}
+		p.Density = density
+	}
+	energyStored, ageStored := snap.Version >= 5, snap.Version >= 10
+	// getEntities reads the size and entities of a grid. The entities are
+	// all read before the grid is made, so the grid is only allocated once
+	// the snapshot has been read in full.
+	getEntities := func() (rows, cols int, entities []snapshotEntity, err error) {
+		rows, cols, count := getInt(), getInt(), getInt()
+		if readErr != nil {
+			return 0, 0, nil, readErr
+		}
+		if !gridSizeInRange(rows, cols) || count < 0 || count > rows*cols {
+			return 0, 0, nil, fmt.Errorf("snapshot of %d entities in a %dx%d grid is out of range", count, rows, cols)
+		}
+		if !fits(count, minEntityBytes) {
+			return 0, 0, nil, fmt.Errorf("snapshot claims %d entities, more than the data left holds", count)
+		}
+		index := -1
+		for i := 0; i < count; i++ {
+			index += getInt() + 1
+			cellType, err := br.ReadByte()
+			if err != nil && readErr == nil {
+				readErr = fmt.Errorf("reading snapshot: %w", err)
+			}
+			e := snapshotEntity{Type: CellType(cellType), BreedCounter: getInt(), StarveCounter: getInt()}
+			if energyStored {
+				e.Energy = getInt()
+			}
+			if ageStored {
+				e.Age = getInt()
+			}
+			if readErr != nil {
+				return 0, 0, nil, readErr
+			}
+			if cols == 0 || index >= rows*cols {
+				return 0, 0, nil, fmt.Errorf("snapshot entity %d lies outside the grid", i)
+			}
+			e.X, e.Y = index/cols, index%cols
+			entities = append(entities, e)
+		}
+		return rows, cols, entities, nil
+	}
+	var startRows, startCols int
+	var startEntities []snapshotEntity
+	if snap.Version >= 11 {
+		var err error
+		if startRows, startCols, startEntities, err = getEntities(); err != nil {
+			return Snapshot{}, err
+		}
+	}
+	snap.Version = SnapshotVersion
+	rows, cols, entities, err := getEntities()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if nutrientsStored {
+		if n := getInt(); n != 0 {
+			if n != rows*cols {
+				return Snapshot{}, fmt.Errorf("snapshot holds nutrient levels for %d cells, want %d", n, rows*cols)
+			}
+			snap.Nutrients = getFloats(n)
+		}
+		if readErr != nil {
+			return Snapshot{}, readErr
+		}
+	}
+
+	if snap.Grid, err = gridFromEntities(rows, cols, entities); err != nil {
+		return Snapshot{}, err
+	}
+	if startRows != 0 || startCols != 0 {
+		start, err := gridFromEntities(startRows, startCols, startEntities)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		cfg.Placement.Start = &start
+	}
+	if err := snap.validate(nil); err != nil {
+		return Snapshot{}, err
+	}
+	return snap, nil
+}
+
+/**
+ * @brief Reads the species of a food web from a binary snapshot.
+ *
+ * @param getInt Reads the next integer.
+ * @param getString Reads the next string.
+ * @return The species, or nil if the snapshot has no food web, or an
+ *         error if a count is out of range. Errors from reading are left
+ *         for the caller to collect.
+ */
+func readFoodWeb(getInt func() int, getString func() string) ([]SpeciesConfig, error) {
+	count := getInt()
+	if count < 0 || count > maxSpecies {
+		return nil, fmt.Errorf("snapshot food web of %d species is out of range", count)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	web := make([]SpeciesConfig, count)
+	for i := range web {
+		s := &web[i]
+		s.Name, s.Colour = getString(), getString()
+		s.InitialCount, s.BreedTime, s.StarveTime = getInt(), getInt(), getInt()
+		s.Stationary = getInt() != 0
+		eats := getInt()
+		if eats < 0 || eats > count {
+			return nil, fmt.Errorf("snapshot species %q eats %d species, out of range", s.Name, eats)
+		}
+		for j := 0; j < eats; j++ {
+			s.Eats = append(s.Eats, getString())
+		}
+	}
+	return web, nil
+}
+
+/**
+ * @brief Reads the environment from a binary snapshot.
+ *
+ * @param getInt Reads the next integer.
+ * @param getFloats Reads the given number of floating point numbers.
+ * @return The environment, or nil if the snapshot has none, or an error if
+ *         a map size is out of range. Errors from reading are left for the
+ *         caller to collect.
+ */
+func readEnvironment(getInt func() int, getFloats func(n int) []float32) (*Environment, error) {
+	if getInt() == 0 {
+		return nil, nil
+	}
+
+	env := &Environment{NutrientRegrowth: math.Float64frombits(uint64(getInt()))}
+	for _, layer := range []**Layer{&env.Nutrients, &env.Temperature, &env.CurrentX, &env.CurrentY} {
+		var err error
+		if *layer, err = readLayer(getInt, getFloats); err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+/**
+ * @brief Reads a map of one value per cell from a binary snapshot.
+ *
+ * @param getInt Reads the next integer.
+ * @param getFloats Reads the given number of floating point numbers.
+ * @return The map, or nil if the snapshot has none in its place, or an
+ *         error if the map size is out of range. Errors from reading are
+ *         left for the caller to collect.
+ */
+func readLayer(getInt func() int, getFloats func(n int) []float32) (*Layer, error) {
+	rows, cols := getInt(), getInt()
+	if rows == 0 && cols == 0 {
+		return nil, nil
+	}
+	if rows <= 0 || cols <= 0 || !gridSizeInRange(rows, cols) {
+		return nil, fmt.Errorf("snapshot map size %dx%d is out of range", cols, rows)
+	}
+	return &Layer{Rows: rows, Cols: cols, Values: getFloats(rows * cols)}, nil
+}
+
+/**
+ * @brief Reads the world map from a binary snapshot.
+ *
+ * @param br Where the cells of the map are read from.
+ * @param getInt Reads the next integer.
+ * @return The map, or nil if the snapshot has none, or an error if the
+ *         map size is out of range or its cells cannot be read.
+ */
+func readWorldMap(br *bufio.Reader, getInt func() int) (*WorldMap, error) {
+	rows, cols := getInt(), getInt()
+	if rows == 0 && cols == 0 {
+		return nil, nil
+	}
+	if rows <= 0 || cols <= 0 || !gridSizeInRange(rows, cols) {
+		return nil, fmt.Errorf("snapshot world map size %dx%d is out of range", cols, rows)
+	}
+
+	// Read as far as the data goes rather than allocated up front, so a
+	// short snapshot cannot claim a huge map
+	cells, err := io.ReadAll(io.LimitReader(br, int64(rows*cols)))
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	if len(cells) < rows*cols {
+		return nil, fmt.Errorf("reading snapshot: %w", io.ErrUnexpectedEOF)
+	}
+	m := &WorldMap{Rows: rows, Cols: cols, Cells: make([]CellType, len(cells))}
+	for i, b := range cells {
+		m.Cells[i] = CellType(b)
+	}
+	return m, nil
+}
+
+/**
+ * @brief Checks that this build can read a snapshot format version.
+ *
+ * @param version The version found in the snapshot.
+ * @return nil if the version can be read, otherwise an error naming it.
+ */
+func checkSnapshotVersion(version int) error {
+	if version < oldestSnapshot || version > SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d (this build reads versions %d to %d)",
+			version, oldestSnapshot, SnapshotVersion)
+	}
+	return nil
+}
+
+/**
+ * @brief Reports whether a grid or map size is within the largest this
+ *        build accepts.
+ *
+ * The limit of maxSnapshotEntries cells, a grid of about 5800 by 5800, is
+ * well beyond any grid the simulation is run on, but stops a corrupt or
+ * hostile snapshot or map from asking for gigabytes of memory.
+ *
+ * @param rows The number of rows.
+ * @param cols The number of columns.
+ * @return true if neither is negative and the grid has at most
+ *         maxSnapshotEntries cells.
+ */
+func gridSizeInRange(rows, cols int) bool {
+	if rows < 0 || cols < 0 || rows > maxSnapshotEntries || cols > maxSnapshotEntries {
+		return false
+	}
+	return rows*cols <= maxSnapshotEntries
+}
+
+/**
+ * @brief Lists the occupied cells of a grid in the form they are saved in.
+ *
+ * @param grid The grid.
+ * @return The entities and land of the grid in row-major order.
+ */
+func snapshotEntities(grid Grid) []snapshotEntity {
+	entities := []snapshotEntity{}
+	for x := 0; x < grid.Rows; x++ {
+		for y := 0; y < grid.Cols; y++ {
+			if cell := grid.At(x, y); cell.Type != Empty {
+				entities = append(entities, snapshotEntity{
+					X: x, Y: y, Type: cell.Type,
+					BreedCounter: cell.BreedCounter, StarveCounter: cell.StarveCounter,
+					Energy: cell.Energy, Age: cell.Age,
+				})
+			}
+		}
+	}
+	return entities
+}
+
+/**
+ * @brief Builds a grid from its size and the cells listed by
+ *        snapshotEntities.
+ *
+ * @param rows The number of rows.
+ * @param cols The number of columns.
+ * @param entities The occupied cells.
+ * @return The grid, or an error if the size is out of range or a cell
+ *         cannot be placed.
+ */
+func gridFromEntities(rows, cols int, entities []snapshotEntity) (Grid, error) {
+	if !gridSizeInRange(rows, cols) {
+		return Grid{}, fmt.Errorf("snapshot grid size %dx%d is out of range", rows, cols)
+	}
+	grid := NewGrid(rows, cols)
+	for _, e := range entities {
+		if err := placeSnapshotEntity(grid, e); err != nil {
+			return Grid{}, err
+		}
+	}
+	return grid, nil
+}
+
+// gridJSON is the layout of a grid in JSON, such as the start grid of a
+// Placement. As in a snapshot, only occupied cells are listed.
+type gridJSON struct {
+	Rows  int              `json:"rows"`
+	Cols  int              `json:"cols"`
+	Cells []snapshotEntity `json:"cells"`
+}
+
+/**
+ * @brief Encodes the grid as its size and its occupied cells.
+ *
+ * @return The JSON encoding.
+ */
+func (g Grid) MarshalJSON() ([]byte, error) {
+	return json.Marshal(gridJSON{Rows: g.Rows, Cols: g.Cols, Cells: snapshotEntities(g)})
+}
+
+/**
+ * @brief Decodes a grid written by MarshalJSON.
+ *
+ * @param data The JSON encoding.
+ * @return nil on success, or an error if the size is out of range or a
+ *         cell is out of place.
+ */
+func (g *Grid) UnmarshalJSON(data []byte) error {
+	var doc gridJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	grid, err := gridFromEntities(doc.Rows, doc.Cols, doc.Cells)
+	if err != nil {
+		return err
+	}
+	*g = grid
+	return nil
+}
+
+/**
+ * @brief Puts a decoded entity into a grid, rejecting bad positions.
+ *
+ * @param grid The grid being rebuilt.
+ * @param e The decoded entity.
+ * @return nil on success, or an error if the position is outside the grid
+ *         or already occupied, or the entity cannot be stored.
+ */
+func placeSnapshotEntity(grid Grid, e snapshotEntity) error {
+	if e.X < 0 || e.X >= grid.Rows || e.Y < 0 || e.Y >= grid.Cols {
+		return fmt.Errorf("snapshot entity at (%d, %d) lies outside the grid", e.X, e.Y)
+	}
+	if e.Type == Empty {
+		return fmt.Errorf("snapshot entity at (%d, %d) has no type", e.X, e.Y)
+	}
+	if int(int32(e.BreedCounter)) != e.BreedCounter || int(int32(e.StarveCounter)) != e.StarveCounter ||
+		int(int32(e.Energy)) != e.Energy || int(int32(e.Age)) != e.Age || e.Age < 0 {
+		return fmt.Errorf("snapshot entity at (%d, %d) has counters out of range", e.X, e.Y)
+	}
+	if grid.At(e.X, e.Y).Type != Empty {
+		return fmt.Errorf("snapshot has two entities at (%d, %d)", e.X, e.Y)
+	}
+	grid.Set(e.X, e.Y, Entity{Type: e.Type, BreedCounter: e.BreedCounter, StarveCounter: e.StarveCounter,
+		Energy: e.Energy, Age: e.Age})
+	return nil
+}
+
+/**
+ * @brief Saves a snapshot to a file.
+ *
+ * Files ending in ".json" are written in the JSON format and every other
+ * file in the binary format.
+ *
+ * @param path The file to create, replacing any existing file.
+ * @param snap The snapshot to save.
+ * @return nil on success, or the error from creating or writing the file.
+ */
+func SaveSnapshot(path string, snap Snapshot) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = WriteSnapshotJSON(f, snap)
+	} else {
+		err = WriteSnapshotBinary(f, snap)
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+/**
+ * @brief Loads a snapshot from a file in either format.
+ *
+ * The format is recognised from the first bytes of the file rather than
+ * its name.
+ *
+ * @param path The file to read.
+ * @return The snapshot, or an error if the file cannot be read or is not
+ *         a valid snapshot.
+ */
+func LoadSnapshot(path string) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snap Snapshot
+	if bytes.HasPrefix(data, []byte(snapshotMagic)) {
+		snap, err = ReadSnapshotBinary(bytes.NewReader(data))
+	} else {
+		snap, err = ReadSnapshotJSON(bytes.NewReader(data))
+	}
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return snap, nil
+}
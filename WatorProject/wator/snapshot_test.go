@@ -0,0 +1,210 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.GridWidth = 60
+	cfg.GridHeight = 30
+	cfg.Boundary = Reflective
+	cfg.SharkEnergyModel = true
+	cfg.SharkMaxEnergy = 12
+	cfg.Seed = 3
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(15)
+	snap := sim.Snapshot()
+
+	formats := map[string]struct {
+		write func(*bytes.Buffer, Snapshot) error
+		read  func(*bytes.Buffer) (Snapshot, error)
+	}{
+		"json": {
+			func(b *bytes.Buffer, s Snapshot) error { return WriteSnapshotJSON(b, s) },
+			func(b *bytes.Buffer) (Snapshot, error) { return ReadSnapshotJSON(b) },
+		},
+		"binary": {
+			func(b *bytes.Buffer, s Snapshot) error { return WriteSnapshotBinary(b, s) },
+			func(b *bytes.Buffer) (Snapshot, error) { return ReadSnapshotBinary(b) },
+		},
+	}
+	for name, format := range formats {
+		var buf bytes.Buffer
+		if err := format.write(&buf, snap); err != nil {
+			t.Fatalf("%s: write: %v", name, err)
+		}
+		got, err := format.read(&buf)
+		if err != nil {
+			t.Fatalf("%s: read: %v", name, err)
+		}
+		if got.Config.Boundary != Reflective {
+			t.Errorf("%s: boundary = %v, want reflective", name, got.Config.Boundary)
+		}
+		if !got.Config.SharkEnergyModel || got.Config.SharkMaxEnergy != 12 {
+			t.Errorf("%s: energy model = %v with cap %d, want true with cap 12", name,
+				got.Config.SharkEnergyModel, got.Config.SharkMaxEnergy)
+		}
+		if got.Step != snap.Step || got.Config.Seed != snap.Config.Seed ||
+			got.Config.GridWidth != snap.Config.GridWidth || got.Config.GridHeight != snap.Config.GridHeight {
+			t.Errorf("%s: header = step %d seed %d size %dx%d, want step %d seed %d size %dx%d", name,
+				got.Step, got.Config.Seed, got.Config.GridWidth, got.Config.GridHeight,
+				snap.Step, snap.Config.Seed, snap.Config.GridWidth, snap.Config.GridHeight)
+		}
+		if !got.Grid.Equal(snap.Grid) {
+			t.Errorf("%s: grid differs after round trip", name)
+		}
+	}
+}
+
+func TestRestoredSnapshotContinuesRun(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Seed = 11
+	original, err := NewSimulation(cfg, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original.StepN(10)
+
+	path := filepath.Join(t.TempDir(), "world.wator")
+	if err := SaveSnapshot(path, original.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := NewSimulationFromSnapshot(snap, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original.StepN(25)
+	resumed.StepN(25)
+	if resumed.StepCount() != 35 {
+		t.Errorf("resumed step count = %d, want 35", resumed.StepCount())
+	}
+	if !original.world.Grid().Equal(resumed.world.Grid()) {
+		t.Fatal("resumed run diverged from the original")
+	}
+}
+
+func TestSnapshotRejectsBadInput(t *testing.T) {
+	sim, err := NewSimulation(DefaultConfig(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSnapshotJSON(&buf, sim.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	future := strings.Replace(buf.String(), fmt.Sprintf(`"version": %d`, SnapshotVersion), `"version": 99`, 1)
+	if _, err := ReadSnapshotJSON(strings.NewReader(future)); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+
+	buf.Reset()
+	if err := WriteSnapshotBinary(&buf, sim.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	truncated := buf.Bytes()[:buf.Len()/2]
+	if _, err := ReadSnapshotBinary(bytes.NewReader(truncated)); err == nil {
+		t.Error("expected an error for a truncated binary snapshot")
+	}
+	if _, err := ReadSnapshotBinary(strings.NewReader("nope")); err == nil {
+		t.Error("expected an error for data without the magic bytes")
+	}
+}
+
+// A few bytes claiming a huge grid, map or entity count are refused without
+// allocating what they claim
+func TestSnapshotRejectsOversizedCounts(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.GridWidth, cfg.GridHeight = 7, 5
+	cfg.InitialFishCount, cfg.InitialSharkCount = 2, 1
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteSnapshotBinary(&buf, sim.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// The rows, columns and entity count come just before the entities
+	counts := binary.AppendVarint(binary.AppendVarint(binary.AppendVarint(nil, 5), 7), 3)
+	header := bytes.LastIndex(data, counts)
+	if header < 0 {
+		t.Fatal("grid size not found in the snapshot")
+	}
+	tests := map[string][3]int64{
+		"entities beyond the data": {5, 7, 30},
+		"grid beyond the limit":    {1 << 20, 1 << 20, 0},
+	}
+	for name, sizes := range tests {
+		hostile := slices.Clone(data[:header])
+		for _, v := range sizes {
+			hostile = binary.AppendVarint(hostile, v)
+		}
+		if _, err := ReadSnapshotBinary(bytes.NewReader(hostile)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// A grid within the limit is still not allocated for a snapshot that
+	// stops short of its entities
+	hostile := slices.Clone(data[:header])
+	for _, v := range []int64{1 << 12, 1 << 12, 1} {
+		hostile = binary.AppendVarint(hostile, v)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := ReadSnapshotBinary(bytes.NewReader(hostile)); err == nil {
+		t.Error("truncated entities: expected an error")
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("reading a truncated snapshot allocated %d bytes", allocated)
+	}
+}
+
+func TestReadVersion1Snapshot(t *testing.T) {
+	v1 := `{
+  "format": "wator-snapshot",
+  "version": 1,
+  "step": 4,
+  "config": {"screenWidth": 500, "screenHeight": 500, "gridSize": 3,
+    "initialFishCount": 1, "initialSharkCount": 1,
+    "fishBreedTime": 5, "sharkBreedTime": 8, "sharkStarveTime": 5, "seed": 8},
+  "rows": 3,
+  "cols": 3,
+  "entities": [
+    {"x": 0, "y": 2, "type": 1, "breedCounter": 2, "starveCounter": 0},
+    {"x": 2, "y": 1, "type": 2, "breedCounter": 3, "starveCounter": 4}
+  ]
+}`
+	snap, err := ReadSnapshotJSON(strings.NewReader(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Version != SnapshotVersion || snap.Config.GridWidth != 3 || snap.Config.GridHeight != 3 {
+		t.Fatalf("upgraded snapshot has version %d and size %dx%d, want %d and 3x3",
+			snap.Version, snap.Config.GridWidth, snap.Config.GridHeight, SnapshotVersion)
+	}
+	if shark := snap.Grid.At(2, 1); shark.Type != Shark || shark.StarveCounter != 4 {
+		t.Errorf("shark at (2, 1) = %+v", shark)
+	}
+}
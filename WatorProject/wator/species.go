@@ -0,0 +1,387 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Species is the behaviour of one kind of creature. Each species registered
+// in a Rules is given its own CellType, and every step the update loop hands
+// each entity of that type to its species' Act method, so new creatures can
+// be added without changing the loop itself. Fish and sharks are the
+// built-in species FishSpecies and SharkSpecies.
+//
+// A Species is shared by every thread updating the grid, so its methods
+// must not change the Species itself.
+type Species interface {
+	// Name identifies the species in errors and statistics. Names must be
+	// unique within a Rules.
+	Name() string
+	// Eats reports whether this species feeds on another one.
+	Eats(prey Species) bool
+	// InitialCount returns how many of the species InitialiseGrid places.
+	InitialCount(cfg Config) int
+	// Newborn returns the counters an entity of the species starts with,
+	// both when the grid is populated and, usually, when one is born.
+	Newborn(cfg Config) Entity
+	// Act gives one entity of the species its turn, deciding through the
+	// Turn whether it moves, eats, breeds or dies. Act must end the turn by
+	// calling exactly one of Stay, Move or Die.
+	Act(t *Turn)
+}
+
+// maxSpecies is the most species a Rules can hold, as every species needs
+// its own CellType, CellType zero is Empty and the last one is Land
+const maxSpecies = numCellTypes - 2
+
+// Rules maps each cell type to the species living in it. Rules must not be
+// changed once a simulation is using them.
+type Rules struct {
+	species []Species // indexed by CellType, with nil for Empty
+}
+
+// builtinRules are the rules used by configurations without any
+var builtinRules = DefaultRules()
+
+/**
+ * @brief Creates rules with no species registered.
+ *
+ * @return The empty rules.
+ */
+func NewRules() *Rules {
+	return &Rules{species: []Species{nil}}
+}
+
+/**
+ * @brief Creates the classic Wator rules of fish and sharks.
+ *
+ * Fish are registered first and sharks second, so they are given the cell
+ * types Fish and Shark.
+ *
+ * @return The rules holding FishSpecies and SharkSpecies.
+ */
+func DefaultRules() *Rules {
+	r := NewRules()
+	r.species = append(r.species, FishSpecies{}, SharkSpecies{})
+	return r
+}
+
+/**
+ * @brief Adds a species, giving it the next free cell type.
+ *
+ * @param s The species to add.
+ * @return The cell type of the species, or an error if the species is nil,
+ *         its name is already taken or there are no cell types left.
+ */
+func (r *Rules) Register(s Species) (CellType, error) {
+	if s == nil {
+		return Empty, errors.New("cannot register a nil species")
+	}
+	if _, taken := r.Lookup(s.Name()); taken {
+		return Empty, fmt.Errorf("a species named %q is already registered", s.Name())
+	}
+	if len(r.species) > maxSpecies {
+		return Empty, fmt.Errorf("cannot register more than %d species", maxSpecies)
+	}
+	r.species = append(r.species, s)
+	return CellType(len(r.species) - 1), nil
+}
+
+/**
+ * @brief Returns the species living in a cell type.
+ *
+ * @param t The cell type.
+ * @return The species, or nil for Empty and unregistered types.
+ */
+func (r *Rules) Species(t CellType) Species {
+	if int(t) >= len(r.species) {
+		return nil
+	}
+	return r.species[t]
+}
+
+/**
+ * @brief Finds the cell type of a species by name.
+ *
+ * @param name The name of the species.
+ * @return The cell type, and false if no species has that name.
+ */
+func (r *Rules) Lookup(name string) (CellType, bool) {
+	for t, s := range r.species {
+		if s != nil && s.Name() == name {
+			return CellType(t), true
+		}
+	}
+	return Empty, false
+}
+
+/**
+ * @brief Lists the cell types of the registered species.
+ *
+ * @return The types in the order the species were registered.
+ */
+func (r *Rules) Types() []CellType {
+	types := make([]CellType, 0, len(r.species)-1)
+	for t := 1; t < len(r.species); t++ {
+		types = append(types, CellType(t))
+	}
+	return types
+}
+
+/**
+ * @brief Works out which cell types each species eats.
+ *
+ * @return For each cell type, the set of types its species feeds on.
+ */
+func (r *Rules) diets() [numCellTypes]CellSet {
+	var diets [numCellTypes]CellSet
+	for t, predator := range r.species {
+		if predator == nil {
+			continue
+		}
+		for p, prey := range r.species {
+			if prey != nil && predator.Eats(prey) {
+				diets[t] = diets[t].With(CellType(p))
+			}
+		}
+	}
+	return diets
+}
+
+// CellSet is a set of cell types, used to say which neighbours an entity
+// is looking for
+type CellSet [4]uint64
+
+// emptyCells matches cells with nothing in them
+var emptyCells = CellSet{}.With(Empty)
+
+/**
+ * @brief Returns the set with one more cell type in it.
+ *
+ * @param t The type to add.
+ * @return The new set.
+ */
+func (s CellSet) With(t CellType) CellSet {
+	s[t>>6] |= 1 << (t & 63)
+	return s
+}
+
+/**
+ * @brief Reports whether a cell type is in the set.
+ *
+ * @param t The type to look for.
+ * @return true if the set holds t.
+ */
+func (s *CellSet) Has(t CellType) bool {
+	return s[t>>6]&(1<<(t&63)) != 0
+}
+
+// Turn is what a Species sees and does while one of its entities acts. The
+// update loop keeps a Turn per band and reuses it for every entity, so a
+// Species must not keep the pointer beyond the call to Act.
+//
+// Entities that have acted this step, including newborns, are kept apart
+// from those still to act (see World), so an entity that moves is never
+// given a second turn in the same step.
+type Turn struct {
+	// Config holds the parameters of the step
+	Config Config
+	// Rand is the random source of the band being updated
+	Rand RandSource
+	// X and Y are the row and column of the acting entity
+	X, Y int
+	// Type is the cell type of the acting entity's species
+	Type CellType
+
+	w      *World
+	report *StepReport
+	from   int
+}
+
+/**
+ * @brief Points the turn at the next entity to act.
+ *
+ * @param x The row of the entity.
+ * @param y The column of the entity.
+ * @param cellType The type of the entity.
+ */
+func (t *Turn) begin(x, y int, cellType CellType) {
+	t.X, t.Y, t.Type = x, y, cellType
+	t.from = t.w.front.Index(x, y)
+}
+
+/**
+ * @brief Returns the position of the acting entity.
+ *
+ * @return The row and column.
+ */
+func (t *Turn) Pos() [2]int {
+	return [2]int{t.X, t.Y}
+}
+
+/**
+ * @brief Returns the acting entity as it was at the start of its turn.
+ *
+ * @return A copy of the entity.
+ */
+func (t *Turn) Entity() Entity {
+	return t.w.front.At(t.X, t.Y)
+}
+
+/**
+ * @brief Returns the cell types the acting species eats.
+ *
+ * @return The set of prey types.
+ */
+func (t *Turn) Prey() CellSet {
+	return t.w.diets[t.Type]
+}
+
+/**
+ * @brief Counts the neighbours holding one of a set of cell types.
+ *
+ * @param set The types to look for; include Empty to count empty cells.
+ * @return The number of matching neighbours.
+ */
+func (t *Turn) Count(set CellSet) int {
+	return t.w.countNeighbours(t.X, t.Y, &set)
+}
+
+/**
+ * @brief Returns one of the neighbours counted by Count.
+ *
+ * @param set The types to look for, as passed to Count.
+ * @param k Which matching neighbour to return, counting from zero.
+ * @return The row and column of the neighbour.
+ */
+func (t *Turn) Choose(set CellSet, k int) [2]int {
+	return t.w.chooseNeighbour(t.X, t.Y, &set, k)
+}
+
+/**
+ * @brief Picks a random neighbour holding one of a set of cell types.
+ *
+ * Where the environment has a current, neighbours it flows towards are
+ * more likely to be picked (see Environment). Otherwise this is the same
+ * as Choose with a random k below Count, drawing the same random number.
+ *
+ * @param set The types to look for; include Empty to pick an empty cell.
+ * @return The row and column of the neighbour, and false if no neighbour
+ *         matches.
+ */
+func (t *Turn) Pick(set CellSet) ([2]int, bool) {
+	count := t.Count(set)
+	if count == 0 {
+		return [2]int{}, false
+	}
+	if t.w.currentX == nil {
+		return t.Choose(set, t.Rand.Intn(count)), true
+	}
+	return t.w.chooseWithCurrent(t.X, t.Y, &set, count, t.Rand), true
+}
+
+/**
+ * @brief Grazes a unit of nutrient from the acting entity's cell.
+ *
+ * @return true if the cell held a whole unit, which is eaten, or the
+ *         environment has no nutrient map; false if the cell is grazed out.
+ */
+func (t *Turn) Graze() bool {
+	if t.w.nutrients == nil {
+		return true
+	}
+	if t.w.nutrients[t.from] < 1 {
+		return false
+	}
+	t.w.nutrients[t.from]--
+	return true
+}
+
+/**
+ * @brief Adjusts a breed time for the temperature of the acting entity's cell.
+ *
+ * @param base The breed time at the reference temperature of 15 °C.
+ * @return The breed time in the entity's cell, at least one, or base if
+ *         the environment has no temperature map.
+ */
+func (t *Turn) BreedTime(base int) int {
+	if t.w.breedScale == nil {
+		return base
+	}
+	return max(1, int(float32(base)*t.w.breedScale[t.from]+0.5))
+}
+
+/**
+ * @brief Eats the entity in a cell.
+ *
+ * The entity is removed whether or not it has acted yet this step.
+ *
+ * @param at The row and column of the entity to eat.
+ */
+func (t *Turn) Eat(at [2]int) {
+	i := t.w.front.Index(at[0], at[1])
+	prey := t.w.front.Types[i] | t.w.back.Types[i]
+	t.w.front.clear(i)
+	t.w.back.clear(i)
+	t.report.record(Eaten, prey, at, at)
+}
+
+/**
+ * @brief Ends the turn with the entity where it is.
+ *
+ * @param e The entity's counters after its turn; its Type and Age are
+ *        ignored, as the entity ages by one step whatever it does.
+ */
+func (t *Turn) Stay(e Entity) {
+	age := t.w.front.Age[t.from] + 1
+	t.w.front.clear(t.from)
+	t.w.back.put(t.from, t.Type, int32(e.BreedCounter), int32(e.StarveCounter), int32(e.Energy), age)
+	t.report.record(Stayed, t.Type, t.Pos(), t.Pos())
+}
+
+/**
+ * @brief Ends the turn by moving the entity to a cell.
+ *
+ * The cell must be empty, which it is if it was returned by Choose from a
+ * set holding only Empty, or has just been eaten. Moving to the entity's
+ * own cell is the same as Stay.
+ *
+ * @param to The row and column to move to.
+ * @param e The entity's counters after its turn; its Type and Age are
+ *        ignored, as for Stay.
+ */
+func (t *Turn) Move(to [2]int, e Entity) {
+	if to == t.Pos() {
+		t.Stay(e)
+		return
+	}
+	age := t.w.front.Age[t.from] + 1
+	t.w.front.clear(t.from)
+	t.w.back.put(t.w.back.Index(to[0], to[1]), t.Type, int32(e.BreedCounter), int32(e.StarveCounter), int32(e.Energy), age)
+	t.report.record(Moved, t.Type, t.Pos(), to)
+}
+
+/**
+ * @brief Ends the turn with the death of the entity.
+ */
+func (t *Turn) Die() {
+	t.w.front.clear(t.from)
+	t.report.record(Starved, t.Type, t.Pos(), t.Pos())
+}
+
+/**
+ * @brief Places a newborn of the acting species in an empty cell.
+ *
+ * The newborn will not act until the next step. It is usually placed in
+ * the cell its parent has just left.
+ *
+ * @param at The row and column of the newborn.
+ * @param e The newborn's counters; its Type and Age are ignored, as a
+ *        newborn's age is zero.
+ */
+func (t *Turn) Spawn(at [2]int, e Entity) {
+	i := t.w.back.Index(at[0], at[1])
+	t.w.back.put(i, t.Type, int32(e.BreedCounter), int32(e.StarveCounter), int32(e.Energy), 0)
+	t.report.record(Born, t.Type, at, at)
+}
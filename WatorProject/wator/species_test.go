@@ -0,0 +1,200 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"bytes"
+	"testing"
+)
+
+// crab is a test species that wanders without eating, breeding or dying
+type crab struct{ count int }
+
+func (crab) Name() string              { return "crab" }
+func (crab) Eats(Species) bool         { return false }
+func (c crab) InitialCount(Config) int { return c.count }
+func (crab) Newborn(cfg Config) Entity { return Entity{} }
+func (crab) Act(t *Turn) {
+	if n := t.Count(emptyCells); n > 0 {
+		t.Move(t.Choose(emptyCells, t.Rand.Intn(n)), t.Entity())
+		return
+	}
+	t.Stay(t.Entity())
+}
+
+// orca is a test species that eats sharks and stays put otherwise
+type orca struct{}
+
+func (orca) Name() string              { return "orca" }
+func (orca) Eats(prey Species) bool    { return prey.Name() == "shark" }
+func (orca) InitialCount(Config) int   { return 0 }
+func (orca) Newborn(cfg Config) Entity { return Entity{} }
+func (orca) Act(t *Turn) {
+	if n := t.Count(t.Prey()); n > 0 {
+		to := t.Choose(t.Prey(), t.Rand.Intn(n))
+		t.Eat(to)
+		t.Move(to, t.Entity())
+		return
+	}
+	t.Stay(t.Entity())
+}
+
+// rulesWith returns the default rules with extra species registered after
+// the fish and sharks
+func rulesWith(t *testing.T, extra ...Species) *Rules {
+	t.Helper()
+	rules := DefaultRules()
+	for _, s := range extra {
+		if _, err := rules.Register(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rules
+}
+
+func TestRulesRegister(t *testing.T) {
+	rules := DefaultRules()
+	if fish, ok := rules.Lookup("fish"); !ok || fish != Fish {
+		t.Errorf("Lookup(fish) = %d, %v, want %d", fish, ok, Fish)
+	}
+	if shark, ok := rules.Lookup("shark"); !ok || shark != Shark {
+		t.Errorf("Lookup(shark) = %d, %v, want %d", shark, ok, Shark)
+	}
+
+	crabType, err := rules.Register(crab{})
+	if err != nil || crabType != Shark+1 {
+		t.Fatalf("Register(crab) = %d, %v, want %d", crabType, err, Shark+1)
+	}
+	if _, err := rules.Register(crab{}); err == nil {
+		t.Error("registering a second crab should fail")
+	}
+	if _, err := rules.Register(nil); err == nil {
+		t.Error("registering nil should fail")
+	}
+	if s := rules.Species(Empty); s != nil {
+		t.Errorf("Species(Empty) = %v, want nil", s)
+	}
+	if got := len(rules.Types()); got != 3 {
+		t.Errorf("Types() lists %d species, want 3", got)
+	}
+}
+
+func TestDietsFollowEats(t *testing.T) {
+	rules := rulesWith(t, crab{}, orca{})
+	diets := rules.diets()
+	orcaType, _ := rules.Lookup("orca")
+
+	if !diets[Shark].Has(Fish) || diets[Shark].Has(Shark) {
+		t.Errorf("sharks should eat fish and only fish")
+	}
+	if !diets[orcaType].Has(Shark) || diets[orcaType].Has(Fish) {
+		t.Errorf("orcas should eat sharks and only sharks")
+	}
+	if diets[Fish] != (CellSet{}) {
+		t.Errorf("fish should eat nothing")
+	}
+}
+
+func TestPluginSpeciesTakesOneTurnPerStep(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Rules = rulesWith(t, crab{count: 100})
+	cfg.Seed = 5
+	sim, err := NewSimulation(cfg, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crabType, _ := cfg.Rules.Lookup("crab")
+
+	countCrabs := func() int {
+		n := 0
+		for _, cellType := range sim.world.Grid().Types {
+			if cellType == crabType {
+				n++
+			}
+		}
+		return n
+	}
+	if n := countCrabs(); n != 100 {
+		t.Fatalf("placed %d crabs, want 100", n)
+	}
+
+	for step := 0; step < 50; step++ {
+		fishBefore, sharksBefore := CountEntities(sim.world.Grid())
+		report := sim.Trace()
+		fishAfter, sharksAfter := CountEntities(sim.world.Grid())
+		if err := report.Check(fishBefore, sharksBefore, fishAfter, sharksAfter); err != nil {
+			t.Fatalf("step %d: %v", step, err)
+		}
+
+		turns := 0
+		for _, e := range report.Events {
+			if e.Type == crabType && (e.Kind == Moved || e.Kind == Stayed) {
+				turns++
+			}
+		}
+		if n := countCrabs(); turns != 100 || n != 100 {
+			t.Fatalf("step %d: %d crab turns and %d crabs, want 100 of each", step, turns, n)
+		}
+	}
+}
+
+func TestPluginSpeciesEatsItsPrey(t *testing.T) {
+	cfg := testConfig(5)
+	cfg.Rules = rulesWith(t, orca{})
+	orcaType, _ := cfg.Rules.Lookup("orca")
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: orcaType})
+	world.front.Set(2, 3, Entity{Type: Shark, StarveCounter: 3})
+	world.front.Set(1, 2, Entity{Type: Fish})
+
+	report := TraceSimulation(cfg, world, 1, 0)
+
+	if got := world.Grid().At(2, 3).Type; got != orcaType {
+		t.Errorf("cell (2, 3) holds type %d, want the orca", got)
+	}
+	if _, sharks := CountEntities(world.Grid()); sharks != 0 {
+		t.Errorf("%d sharks left, want the shark eaten", sharks)
+	}
+	eaten := 0
+	for _, e := range report.Events {
+		if e.Kind == Eaten && e.Type == Shark {
+			eaten++
+		}
+	}
+	if eaten != 1 {
+		t.Errorf("%d sharks eaten, want 1", eaten)
+	}
+}
+
+func TestSnapshotRestoresPluginSpecies(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Rules = rulesWith(t, crab{count: 30})
+	cfg.Seed = 8
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(5)
+
+	var buf bytes.Buffer
+	if err := WriteSnapshotBinary(&buf, sim.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := ReadSnapshotBinary(&buf)
+	if err != nil {
+		t.Fatalf("reading a snapshot with crabs: %v", err)
+	}
+	if _, err := NewSimulationFromSnapshot(snap, 1); err == nil {
+		t.Error("restoring crabs without their rules should fail")
+	}
+
+	snap.Config.Rules = cfg.Rules
+	resumed, err := NewSimulationFromSnapshot(snap, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(5)
+	resumed.StepN(5)
+	if !sim.world.Grid().Equal(resumed.world.Grid()) {
+		t.Error("resumed run with crabs diverged from the original")
+	}
+}
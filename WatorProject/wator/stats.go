@@ -0,0 +1,155 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// StepStats describes the population after one step of a simulation. The
+// entry for step zero describes the initial grid, so its event counts are
+// all zero. Populations lists every species when the simulation runs other
+// rules than the classic fish and sharks, whose counts are then those of
+// the first two species. A shark's reserve is kept in its starvation
+// counter under the classic rules and in its energy under the energy model,
+// so only one of MeanSharkStarve and MeanSharkEnergy is filled in.
+type StepStats struct {
+	Step          int `json:"step"`
+	Fish          int `json:"fish"`
+	Sharks        int `json:"sharks"`
+	FishBorn      int `json:"fishBorn"`
+	SharksBorn    int `json:"sharksBorn"`
+	FishEaten     int `json:"fishEaten"`
+	SharksStarved int `json:"sharksStarved"`
+	// MeanSharkStarve is the mean starvation counter of the sharks under
+	// the classic rules: the steps they can still go without eating
+	MeanSharkStarve float64 `json:"meanSharkStarve"`
+	// MeanSharkEnergy is the mean energy of the sharks under the energy model
+	MeanSharkEnergy float64 `json:"meanSharkEnergy"`
+	Occupancy       float64 `json:"occupancy"`
+
+	Populations []SpeciesPopulation `json:"populations,omitempty"`
+}
+
+// SpeciesPopulation is the number of entities of one species
+type SpeciesPopulation struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Statistics is the time series of a run, one entry per step
+type Statistics []StepStats
+
+// Column headings written by Statistics.WriteCSV
+var statsHeader = []string{
+	"step", "fish", "sharks", "fish_born", "sharks_born",
+	"fish_eaten", "sharks_starved", "mean_shark_starve", "mean_shark_energy", "occupancy",
+}
+
+/**
+ * @brief Builds the statistics of a step from the populations and report.
+ *
+ * @param step The number of steps taken so far.
+ * @param fish The number of fish after the step.
+ * @param sharks The number of sharks after the step.
+ * @param cells The number of cells in the grid.
+ * @param report The report of the step, or an empty report for step zero.
+ * @param sharkEnergy The total starvation counter of the surviving sharks,
+ *        or their total energy under the energy model.
+ * @param energyModel Whether the sharks run on energy rather than the
+ *        starvation counter.
+ * @param populations The population of every species, or nil under the
+ *        classic rules; the slice is kept.
+ * @return The statistics of the step.
+ */
+func newStepStats(step, fish, sharks, cells int, report StepReport, sharkEnergy int, energyModel bool, populations []SpeciesPopulation) StepStats {
+	stats := StepStats{
+		Step:          step,
+		Fish:          fish,
+		Sharks:        sharks,
+		FishBorn:      report.FishBorn,
+		SharksBorn:    report.SharksBorn,
+		FishEaten:     report.FishEaten,
+		SharksStarved: report.SharksStarved,
+		Occupancy:     float64(fish+sharks) / float64(cells),
+		Populations:   populations,
+	}
+	if populations != nil {
+		occupied := 0
+		for _, p := range populations {
+			occupied += p.Count
+		}
+		stats.Occupancy = float64(occupied) / float64(cells)
+	}
+	if sharks > 0 && energyModel {
+		stats.MeanSharkEnergy = float64(sharkEnergy) / float64(sharks)
+	} else if sharks > 0 {
+		stats.MeanSharkStarve = float64(sharkEnergy) / float64(sharks)
+	}
+	return stats
+}
+
+/**
+ * @brief Writes the statistics as CSV with a header row.
+ *
+ * If the steps list the population of every species, a column named after
+ * each species follows the standard columns.
+ *
+ * @param w Where the CSV is written.
+ * @return nil on success, or the error from writing.
+ */
+func (h Statistics) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	header := statsHeader
+	if len(h) > 0 {
+		header = slices.Clone(statsHeader)
+		for _, p := range h[0].Populations {
+			header = append(header, p.Name)
+		}
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	for _, s := range h {
+		record := []string{
+			strconv.Itoa(s.Step),
+			strconv.Itoa(s.Fish),
+			strconv.Itoa(s.Sharks),
+			strconv.Itoa(s.FishBorn),
+			strconv.Itoa(s.SharksBorn),
+			strconv.Itoa(s.FishEaten),
+			strconv.Itoa(s.SharksStarved),
+			strconv.FormatFloat(s.MeanSharkStarve, 'f', 4, 64),
+			strconv.FormatFloat(s.MeanSharkEnergy, 'f', 4, 64),
+			strconv.FormatFloat(s.Occupancy, 'f', 6, 64),
+		}
+		for _, p := range s.Populations {
+			record = append(record, strconv.Itoa(p.Count))
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+/**
+ * @brief Writes the statistics as an indented JSON array.
+ *
+ * @param w Where the JSON is written.
+ * @return nil on success, or the error from writing.
+ */
+func (h Statistics) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if h == nil {
+		h = Statistics{}
+	}
+	return enc.Encode(h)
+}
@@ -0,0 +1,76 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+	stats := Statistics{
+		newStepStats(0, 10, 3, 100, StepReport{}, 7, false, nil),
+		newStepStats(1, 12, 2, 100, StepReport{Accounting: Accounting{FishBorn: 4, FishEaten: 2, SharksStarved: 1}}, 5, true, nil),
+		newStepStats(2, 12, 0, 100, StepReport{}, 0, false, nil),
+	}
+	var buf bytes.Buffer
+	if err := stats.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"step", "fish", "sharks", "fish_born", "sharks_born", "fish_eaten", "sharks_starved",
+			"mean_shark_starve", "mean_shark_energy", "occupancy"},
+		{"0", "10", "3", "0", "0", "0", "0", "2.3333", "0.0000", "0.130000"},
+		{"1", "12", "2", "4", "0", "2", "1", "0.0000", "2.5000", "0.140000"},
+		// With no sharks left there is no mean to take
+		{"2", "12", "0", "0", "0", "0", "0", "0.0000", "0.0000", "0.120000"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("CSV has %d rows, want %d", len(records), len(want))
+	}
+	for i := range want {
+		if !slices.Equal(records[i], want[i]) {
+			t.Errorf("row %d = %v, want %v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestWriteJSONRoundTrips(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Seed = 3
+	cfg.SharkEnergyModel = true
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(5)
+	stats := sim.Stats()
+
+	var buf bytes.Buffer
+	if err := stats.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Statistics
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, stats) {
+		t.Errorf("statistics changed through JSON:\n%+v\nwant\n%+v", decoded, stats)
+	}
+	if stats[0].MeanSharkEnergy != float64(cfg.SharkInitialEnergy) || stats[0].MeanSharkStarve != 0 {
+		t.Errorf("energy model: step zero has mean energy %g and starve %g", stats[0].MeanSharkEnergy, stats[0].MeanSharkStarve)
+	}
+
+	buf.Reset()
+	if err := Statistics(nil).WriteJSON(&buf); err != nil || buf.String() != "[]\n" {
+		t.Errorf("empty statistics written as %q, error %v", buf.String(), err)
+	}
+}
@@ -1,33 +1,9 @@
 // Wator simulation project by Seán Rourke, C00251168
 package Wator
 
-import (
-	"fmt"
-	"image/color"
-	"math/rand"
-	"os"
-	"sync"
-	"time"
-
-	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/xuri/excelize/v2"
-)
-
-// Constants
-const (
-	ScreenWidth       = 500
-	ScreenHeight      = 500
-	GridSize          = 50
-	CellSize          = ScreenWidth / GridSize
-	InitialFishCount  = 200
-	InitialSharkCount = 50
-	FishBreedTime     = 5
-	SharkBreedTime    = 8
-	SharkStarveTime   = 5
-)
+import "fmt"
 
-type CellType int
+type CellType uint8
 
 const (
 	Empty CellType = iota
@@ -35,448 +11,614 @@ const (
 	Shark
 )
 
+// Land is a static cell type that no entity can enter, used for coastlines
+// and islands (see WorldMap). It is never given to a species and never
+// takes a turn.
+const Land CellType = numCellTypes - 1
+
+// numCellTypes is the number of values a CellType can hold
+const numCellTypes = 256
+
+// Entity is a copy of the contents of one cell. Grids store the fields of
+// their entities in separate arrays, so an Entity is only used to read or
+// write a single cell.
+// Sharks use StarveCounter under the classic rules and Energy under the
+// energy model (see Config.SharkEnergyModel); the other stays zero. Age is
+// the number of steps the entity has survived, kept by the update loop
+// rather than by its species.
 type Entity struct {
 	Type          CellType
 	BreedCounter  int
 	StarveCounter int
-}
-
-type Grid [][]*Entity
-
-type Game struct {
-	grid       Grid
-	numThreads int
+	Energy        int
+	Age           int
 }
 
 /**
  * @brief Initializes the grid with entities.
  *
  * This function creates a new grid of specified size and populates it with
- * initial counts of fish and sharks by calling the `PlaceEntities` function.
- * The grid is represented as a two-dimensional slice of entity pointers,
- * where each cell can either be empty or contain an entity.
+ * the initial count of every species in the rules, in the order they were
+ * registered, by calling the `PlaceEntities` function, spread as the
+ * Placement of the configuration describes. With the default rules these
+ * are the initial fish and then the initial sharks. A world map in the
+ * configuration is laid down first, so its land is never used and its fish
+ * and sharks come on top of the initial counts, and so are the entities of
+ * the start grid of FromSnapshot placement.
+ * The grid has GridHeight rows of GridWidth cells, so grid.At(x, y) is the
+ * cell in row x and column y.
+ *
+ * The entities are placed using a random stream derived from the seed in
+ * the configuration, so the same configuration always gives the same grid.
  *
- * @return The initialized grid containing entities.
+ * @param cfg The simulation parameters describing the grid and populations.
+ * @return The initialized grid containing entities, or an error if the
+ *         configuration is invalid or the placement leaves too few cells
+ *         for a species.
  */
-func InitialiseGrid() Grid {
-	grid := make(Grid, GridSize)
-	for i := range grid {
-		grid[i] = make([]*Entity, GridSize)
+func InitialiseGrid(cfg Config) (Grid, error) {
+	if err := cfg.Validate(); err != nil {
+		return Grid{}, err
+	}
+
+	grid := NewGrid(cfg.GridHeight, cfg.GridWidth)
+	if cfg.Map != nil {
+		if err := cfg.Map.place(cfg, grid); err != nil {
+			return Grid{}, err
+		}
+	}
+	if cfg.Placement.Kind == FromSnapshot {
+		cfg.Placement.placeStart(grid)
 	}
 
-	PlaceEntities(grid, Fish, InitialFishCount)
-	PlaceEntities(grid, Shark, InitialSharkCount)
+	rng := newSource(cfg, StreamSeed(cfg.Seed, placementStep, 0))
+	rules := cfg.rules()
+	for _, t := range rules.Types() {
+		if err := PlaceEntities(cfg, grid, rng, t, rules.Species(t).InitialCount(cfg)); err != nil {
+			return Grid{}, err
+		}
+	}
 
-	return grid
+	return grid, nil
 }
 
 /**
  * @brief Places a specified number of entities of a given type in the grid.
  *
- * This function randomly selects empty cells in the grid and places the specified
- * number of entities of the given type (either fish or sharks) into those cells.
- * If the entity type is a shark, it initializes the starvation counter for the shark.
+ * This function selects free cells in the grid and places the specified
+ * number of entities of the given type (either fish or sharks) into those
+ * cells, spread as the Placement of the configuration describes. Under
+ * Uniform placement, and around the start grid of FromSnapshot placement,
+ * every free cell is equally likely. UniformDensity placement fills each
+ * free cell with a chance of count in the number of free cells, so about
+ * count entities are placed. The other kinds weight the cells, never using
+ * a cell of weight zero.
+ * Each entity starts with the counters given by its species' Newborn method,
+ * so sharks start with a full starvation counter, or their initial energy
+ * under the energy model. Types with no species in the rules are not placed.
  *
+ * @param cfg The simulation parameters.
  * @param grid The grid where entities will be placed.
+ * @param rng The random number generator used to pick cells.
  * @param entityType The type of entity to place in the grid (e.g., Fish or Shark).
  * @param count The number of entities to place in the grid.
+ * @return nil on success, or an error if there are not enough free cells
+ *         the placement allows, in which case no entity is placed.
  */
-func PlaceEntities(grid Grid, entityType CellType, count int) {
-	for i := 0; i < count; {
-		x, y := rand.Intn(GridSize), rand.Intn(GridSize)
-		if grid[x][y] == nil {
-			entity := &Entity{Type: entityType}
-			if entityType == Shark {
-				entity.StarveCounter = SharkStarveTime
+func PlaceEntities(cfg Config, grid Grid, rng RandSource, entityType CellType, count int) error {
+	species := cfg.rules().Species(entityType)
+	if species == nil || count <= 0 {
+		return nil
+	}
+	e := species.Newborn(cfg)
+	put := func(cell int) {
+		grid.put(cell, entityType, int32(e.BreedCounter), int32(e.StarveCounter), int32(e.Energy), 0)
+	}
+
+	if cfg.Placement.Kind == UniformDensity {
+		var free []int
+		for cell, cellType := range grid.Types {
+			if cellType == Empty {
+				free = append(free, cell)
 			}
-			grid[x][y] = entity
-			i++
 		}
+		if count > len(free) {
+			return fmt.Errorf("cannot place %d %s: only %d cells are free", count, species.Name(), len(free))
+		}
+		// Each free cell is filled with a chance of count in len(free)
+		for _, cell := range free {
+			if rng.Intn(len(free)) < count {
+				put(cell)
+			}
+		}
+		return nil
 	}
+	if cfg.Placement.Kind == Uniform || cfg.Placement.Kind == FromSnapshot {
+		free := 0
+		for _, cellType := range grid.Types {
+			if cellType == Empty {
+				free++
+			}
+		}
+		if count > free {
+			return fmt.Errorf("cannot place %d %s: only %d cells are free", count, species.Name(), free)
+		}
+		for i := 0; i < count; {
+			cell := grid.Index(rng.Intn(cfg.GridHeight), rng.Intn(cfg.GridWidth))
+			if grid.Types[cell] == Empty {
+				put(cell)
+				i++
+			}
+		}
+		return nil
+	}
+
+	cells := newWeightedCells(grid, cfg.Placement.weights(cfg, rng, entityType))
+	if count > len(cells.cells) {
+		return fmt.Errorf("cannot place %d %s: only %d free cells can hold them under %s placement",
+			count, species.Name(), len(cells.cells), cfg.Placement.Kind)
+	}
+	for i := 0; i < count; i++ {
+		put(cells.draw(rng))
+	}
+	return nil
 }
 
+// FishSpecies is the built-in fish. Fish eat nothing and never starve.
+type FishSpecies struct{}
+
 /**
- * @brief Moves a fish in the simulation based on its current state and surroundings.
- *
- * This function updates the position of a fish in the grid. The fish can either
- * move to a random empty cell or stay in its current position based on the
- * availability of empty cells in its neighbourhood. The function also handles
- * the breeding mechanics for the fish.
+ * @brief Returns the name of the species.
  *
- * @param grid The current state of the grid containing entities.
- * @param newGrid The grid where the updated state will be recorded.
- * @param x The x-coordinate of the fish's current position.
- * @param y The y-coordinate of the fish's current position.
+ * @return "fish".
  */
-func MoveFish(grid, newGrid Grid, x, y int) {
-	cell := grid[x][y]
-	cell.BreedCounter++
-
-	// Find empty neighbors
-	neighbours := GetNeighbours(x, y)
-	emptyCells := FilterEmptyCells(grid, neighbours)
-
-	if len(emptyCells) > 0 {
-		// Move to a random empty cell
-		randomCell := emptyCells[rand.Intn(len(emptyCells))]
-		newX, newY := randomCell[0], randomCell[1]
-		newGrid[newX][newY] = cell
-	} else {
-		// Stay in place
-		newGrid[x][y] = cell
-	}
+func (FishSpecies) Name() string {
+	return "fish"
+}
 
-	// Breed fish
-	if cell.BreedCounter >= FishBreedTime {
-		cell.BreedCounter = 0
-		if newGrid[x][y] == nil {
-			newGrid[x][y] = &Entity{Type: Fish}
-		}
-	}
+/**
+ * @brief Reports whether fish eat another species.
+ *
+ * @param prey The other species.
+ * @return false, as fish feed on nothing in the grid.
+ */
+func (FishSpecies) Eats(prey Species) bool {
+	return false
 }
 
 /**
- * @brief Moves a shark in the simulation based on its current state and surroundings.
+ * @brief Returns the number of fish placed in a new grid.
  *
- * This function updates the position of a shark in the grid. The shark can either
- * eat a fish, move to an empty cell, or stay in its current position based on the
- * availability of fish and empty cells in its neighbourhood. The function also
- * handles the breeding and starvation mechanics for the shark.
+ * @param cfg The simulation parameters.
+ * @return The configured initial fish count.
+ */
+func (FishSpecies) InitialCount(cfg Config) int {
+	return cfg.InitialFishCount
+}
+
+/**
+ * @brief Returns a newly placed or newborn fish.
  *
- * @param grid The current state of the grid containing entities.
- * @param newGrid The grid where the updated state will be recorded.
- * @param x The x-coordinate of the shark's current position.
- * @param y The y-coordinate of the shark's current position.
+ * @param cfg The simulation parameters.
+ * @return A fish with every counter at zero.
  */
-func MoveShark(grid, newGrid Grid, x, y int) {
-	cell := grid[x][y]
-	cell.BreedCounter++
-	cell.StarveCounter--
+func (FishSpecies) Newborn(cfg Config) Entity {
+	return Entity{Type: Fish}
+}
 
-	neighbours := GetNeighbours(x, y)
-	fishCells := FilterFishCells(grid, neighbours)
-	emptyCells := FilterEmptyCells(grid, neighbours)
+/**
+ * @brief Moves a fish in the simulation based on its current state and surroundings.
+ *
+ * The fish moves to a random empty cell of its neighbourhood, or stays in
+ * its current position if every neighbour is occupied. A fish that moves
+ * once its breed counter has reached the fish breed time leaves a newborn
+ * fish in the cell it left and its counter is reset; a fish that cannot
+ * move keeps counting until it can.
+ *
+ * Under an Environment the fish only counts towards breeding on turns it
+ * grazes nutrient from its cell, its breed time follows the temperature of
+ * the cell and its moves drift with the current.
+ *
+ * @param t The turn of the fish.
+ */
+func (FishSpecies) Act(t *Turn) {
+	fish := t.Entity()
+	if t.Graze() {
+		fish.BreedCounter++
+	}
 
-	if len(fishCells) > 0 {
-		// Eat fish
-		randomCell := fishCells[rand.Intn(len(fishCells))]
-		newX, newY := randomCell[0], randomCell[1]
-		newGrid[newX][newY] = cell
-		cell.StarveCounter = SharkStarveTime
-	} else if len(emptyCells) > 0 {
-		// Move to an empty cell
-		randomCell := emptyCells[rand.Intn(len(emptyCells))]
-		newX, newY := randomCell[0], randomCell[1]
-		newGrid[newX][newY] = cell
-		// Starve shark
-		if cell.StarveCounter <= 0 {
-			newGrid[newX][newY] = nil
-		}
-	} else {
+	// Move to a random empty neighbour
+	to, ok := t.Pick(emptyCells)
+	if !ok {
 		// Stay in place
-		newGrid[x][y] = cell
-		// Starve shark
-		if cell.StarveCounter <= 0 {
-			newGrid[x][y] = nil
-		}
+		t.Stay(fish)
+		return
 	}
-
-	// Breed shark
-	if cell.BreedCounter >= SharkBreedTime {
-		cell.BreedCounter = 0
-		if newGrid[x][y] == nil {
-			newGrid[x][y] = &Entity{Type: Shark, StarveCounter: SharkStarveTime}
-		}
+	if fish.BreedCounter < t.BreedTime(t.Config.FishBreedTime) {
+		t.Move(to, fish)
+		return
 	}
+
+	// Breed fish
+	fish.BreedCounter = 0
+	t.Move(to, fish)
+	t.Spawn(t.Pos(), FishSpecies{}.Newborn(t.Config))
 }
 
+// SharkSpecies is the built-in shark, which eats fish and starves without
+// them, under either the classic rules or the energy model.
+type SharkSpecies struct{}
+
 /**
- * @brief Returns the coordinates of the neighbouring cells for a given cell.
- *
- * This function calculates the coordinates of the four direct neighbours (up, down,
- * left, right) of the cell located at (x, y) in a toroidal grid. It ensures that
- * the coordinates wrap around the edges of the grid.
+ * @brief Returns the name of the species.
  *
- * @param x The x-coordinate of the cell for which neighbours are to be found.
- * @param y The y-coordinate of the cell for which neighbours are to be found.
- * @return A slice of coordinates representing the neighbours of the specified cell.
+ * @return "shark".
  */
-func GetNeighbours(x, y int) [][2]int {
-	return [][2]int{
-		{x, (y - 1 + GridSize) % GridSize},
-		{x, (y + 1) % GridSize},
-		{(x - 1 + GridSize) % GridSize, y},
-		{(x + 1) % GridSize, y},
-	}
+func (SharkSpecies) Name() string {
+	return "shark"
 }
 
 /**
- * @brief Filters and returns the coordinates of empty cells from the given neighbours.
+ * @brief Reports whether sharks eat another species.
  *
- * This function iterates through the provided list of neighbour coordinates
- * and checks each corresponding cell in the grid. If the cell is nil (empty),
- * the coordinate is added to the result list.
- *
- * @param grid The grid containing the cells to be checked.
- * @param neighbours A slice of coordinates representing the neighbours to filter.
- * @return A slice of coordinates of the empty cells found among the neighbours.
+ * @param prey The other species.
+ * @return true if the other species is the built-in fish.
  */
-func FilterEmptyCells(grid Grid, neighbours [][2]int) [][2]int {
-	var emptyCells [][2]int
-	for _, n := range neighbours {
-		if grid[n[0]][n[1]] == nil {
-			emptyCells = append(emptyCells, n)
-		}
-	}
-	return emptyCells
+func (SharkSpecies) Eats(prey Species) bool {
+	_, fish := prey.(FishSpecies)
+	return fish
 }
 
 /**
- * @brief Filters and returns the coordinates of fish cells from the given neighbours.
+ * @brief Returns the number of sharks placed in a new grid.
  *
- * This function iterates through the provided list of neighbour coordinates
- * and checks each corresponding cell in the grid. If the cell is not nil
- * and its type is `Fish`, the coordinate is added to the result list.
+ * @param cfg The simulation parameters.
+ * @return The configured initial shark count.
+ */
+func (SharkSpecies) InitialCount(cfg Config) int {
+	return cfg.InitialSharkCount
+}
+
+/**
+ * @brief Returns a newly placed or newborn shark.
  *
- * @param grid The grid containing the cells to be checked.
- * @param neighbours A slice of coordinates representing the neighbours to filter.
- * @return A slice of coordinates of the fish cells found among the neighbours.
+ * @param cfg The simulation parameters.
+ * @return A shark with a full starvation counter, or with the initial
+ *         energy under the energy model.
  */
-func FilterFishCells(grid Grid, neighbours [][2]int) [][2]int {
-	var fishCells [][2]int
-	for _, n := range neighbours {
-		if cell := grid[n[0]][n[1]]; cell != nil && cell.Type == Fish {
-			fishCells = append(fishCells, n)
-		}
+func (SharkSpecies) Newborn(cfg Config) Entity {
+	if cfg.SharkEnergyModel {
+		return Entity{Type: Shark, Energy: cfg.SharkInitialEnergy}
 	}
-	return fishCells
+	return Entity{Type: Shark, StarveCounter: cfg.SharkStarveTime}
 }
 
 /**
- * @brief Updates the simulation of the grid using multiple threads.
+ * @brief Moves a shark in the simulation based on its current state and surroundings.
  *
- * This function creates a new grid to hold the updated state and divides
- * the work of updating the grid across multiple threads. Each thread processes
- * a specific range of rows, moving fish and sharks according to the rules
- * defined in the simulation.
+ * The shark eats a random fish in its neighbourhood if there is one,
+ * otherwise it moves to a random empty cell of its neighbourhood, or stays
+ * in place if it is surrounded. Eating resets the starvation counter; a
+ * shark whose counter runs out without eating dies. A surviving shark that
+ * moves once its breed counter has reached the shark breed time leaves a
+ * newborn shark in the cell it left.
  *
- * @param grid The current state of the grid containing entities (fish and sharks).
- * @param numThreads The number of threads to use for processing the grid update.
+ * Under the energy model (see Config.SharkEnergyModel) the shark instead
+ * spends SharkMoveCost each time it moves, including onto a fish it eats,
+ * but nothing when it stays where it is, and gains SharkEnergyPerFish, up to
+ * SharkMaxEnergy, for the fish it eats, dying once its energy is used up.
+ * Breeding gives half of the parent's energy to the newborn, so a shark
+ * with too little energy to share does not breed until it has eaten.
+ *
+ * A fish that is eaten is removed whether or not it has already moved this
+ * step, so it is eaten the same way in either case. Under an Environment
+ * the shark's breed time follows the temperature of its cell and its moves,
+ * including those onto a fish, drift with the current.
+ *
+ * @param t The turn of the shark.
  */
-func UpdateSimulation(grid Grid, numThreads int) {
-	newGrid := make(Grid, GridSize)
-	for i := range newGrid {
-		newGrid[i] = make([]*Entity, GridSize)
+func (SharkSpecies) Act(t *Turn) {
+	cfg := &t.Config
+	shark := t.Entity()
+	shark.BreedCounter++
+	// Only one of these is used, depending on the model; the other stays zero
+	if cfg.SharkEnergyModel {
+		shark.StarveCounter = 0
+	} else {
+		shark.StarveCounter, shark.Energy = shark.StarveCounter-1, 0
 	}
 
-	var wg sync.WaitGroup
-	rowsPerThread := GridSize / numThreads
-
-	for i := 0; i < numThreads; i++ {
-		startRow := i * rowsPerThread
-		endRow := startRow + rowsPerThread
-		if i == numThreads-1 {
-			endRow = GridSize
+	to := t.Pos()
+	fish, eating := t.Pick(t.Prey())
+	if eating {
+		to = fish
+	} else if empty, ok := t.Pick(emptyCells); ok {
+		// Move to an empty cell
+		to = empty
+	}
+	if cfg.SharkEnergyModel && to != t.Pos() {
+		shark.Energy -= cfg.SharkMoveCost
+	}
+	if eating {
+		// Eat fish
+		t.Eat(to)
+		if cfg.SharkEnergyModel {
+			shark.Energy = min(shark.Energy+cfg.SharkEnergyPerFish, cfg.SharkMaxEnergy)
+		} else {
+			shark.StarveCounter = cfg.SharkStarveTime
 		}
+	}
 
-		wg.Add(1)
-		go func(startRow, endRow int) {
-			defer wg.Done()
-			for x := startRow; x < endRow; x++ {
-				for y, cell := range grid[x] {
-					if cell == nil || (newGrid[x][y] != nil) {
-						continue
-					}
-
-					if cell.Type == Fish {
-						MoveFish(grid, newGrid, x, y)
-					} else if cell.Type == Shark {
-						MoveShark(grid, newGrid, x, y)
-					}
-				}
-			}
-		}(startRow, endRow)
+	if shark.StarveCounter+shark.Energy <= 0 {
+		// Starve shark
+		t.Die()
+		return
+	}
+	if to == t.Pos() {
+		// Stay in place
+		t.Stay(shark)
+		t.report.SharkEnergy += shark.StarveCounter + shark.Energy
+		return
 	}
 
-	wg.Wait()
-	CopyGrid(grid, newGrid)
+	if shark.BreedCounter < t.BreedTime(cfg.SharkBreedTime) || (cfg.SharkEnergyModel && shark.Energy < 2) {
+		t.Move(to, shark)
+		t.report.SharkEnergy += shark.StarveCounter + shark.Energy
+		return
+	}
+
+	// Breed shark
+	child := SharkSpecies{}.Newborn(*cfg)
+	shark.BreedCounter = 0
+	if cfg.SharkEnergyModel {
+		// The parent shares its energy with the newborn
+		child.Energy = shark.Energy / 2
+		shark.Energy -= child.Energy
+	}
+	t.Move(to, shark)
+	t.Spawn(t.Pos(), child)
+	t.report.SharkEnergy += shark.StarveCounter + shark.Energy + child.StarveCounter + child.Energy
 }
 
 /**
- * @brief Copies the contents of one grid to another.
+ * @brief Gives the fish in a cell its turn under the built-in fish rules.
  *
- * This function iterates over the source grid and copies each cell's value
- * to the destination grid.
+ * The fish is taken from the world's front grid and put into its back grid,
+ * where it will not be updated again this step. A cell counts as occupied
+ * if either grid holds an entity, so every decision sees the moves already
+ * made this step and no two entities can end up in the same cell.
+ * The world's species and neighbourhood are built from `cfg` the first time
+ * they are needed. See FishSpecies.Act for the rules themselves.
  *
- * @param dest The destination grid where the values will be copied to.
- * @param src The source grid from which values will be copied.
+ * @param cfg The simulation parameters.
+ * @param w The world being updated.
+ * @param x The x-coordinate of the fish's current position.
+ * @param y The y-coordinate of the fish's current position.
+ * @param rng The random number generator used to pick a destination.
+ * @param report Where the events of the move are recorded.
  */
-func CopyGrid(dest, src Grid) {
-	for i := range src {
-		for j := range src[i] {
-			dest[i][j] = src[i][j]
-		}
-	}
+func MoveFish(cfg Config, w *World, x, y int, rng RandSource, report *StepReport) {
+	t := w.turn(cfg, x, y, rng, report)
+	FishSpecies{}.Act(&t)
 }
 
 /**
- * @brief Draws the game grid onto the provided screen.
+ * @brief Gives the shark in a cell its turn under the built-in shark rules.
  *
- * This method fills the screen with a black background and draws each cell
- * of the grid based on its type. Cells representing fish and sharks are
- * drawn in green and red, respectively.
+ * As with MoveFish, the shark moves from the front grid to the back grid.
+ * See SharkSpecies.Act for the rules themselves.
  *
- * @param screen A pointer to an `ebiten.Image` where the game grid will be drawn.
+ * @param cfg The simulation parameters.
+ * @param w The world being updated.
+ * @param x The x-coordinate of the shark's current position.
+ * @param y The y-coordinate of the shark's current position.
+ * @param rng The random number generator used to pick a destination.
+ * @param report Where the events of the move are recorded.
  */
-func (g *Game) Draw(screen *ebiten.Image) {
-	screen.Fill(color.RGBA{0, 0, 0, 255})
-
-	for x := 0; x < GridSize; x++ {
-		for y := 0; y < GridSize; y++ {
-			cell := g.grid[x][y]
-			if cell == nil {
-				continue
-			}
+func MoveShark(cfg Config, w *World, x, y int, rng RandSource, report *StepReport) {
+	t := w.turn(cfg, x, y, rng, report)
+	SharkSpecies{}.Act(&t)
+}
 
-			var colour color.RGBA
-			if cell.Type == Fish {
-				colour = color.RGBA{0, 255, 0, 255}
-			} else if cell.Type == Shark {
-				colour = color.RGBA{255, 0, 0, 255}
-			}
+/**
+ * @brief Returns the coordinates of the neighbouring cells for a given cell.
+ *
+ * This function lists the cells in the configured neighbourhood of the cell
+ * located at (x, y), treating the edges of the grid as the configured
+ * Boundary says: wrapping them round (Torus), leaving out neighbours beyond
+ * them (Walls) or bouncing back off them (Reflective). Land cells of the
+ * configured world map are left out too, as no entity can enter them. With the default
+ * von Neumann neighbourhood these are the four direct neighbours (left,
+ * right, up, down). The neighbourhood is built on every call, so this is
+ * meant for callers outside the update loop.
+ *
+ * @param dst The slice the coordinates are appended to, usually empty.
+ * @param cfg The simulation parameters giving the grid, boundary and neighbourhood.
+ * @param x The x-coordinate of the cell for which neighbours are to be found.
+ * @param y The y-coordinate of the cell for which neighbours are to be found.
+ * @return `dst` extended with the coordinates of the neighbours of the cell,
+ *         or `dst` unchanged if the configured neighbourhood is invalid.
+ */
+func GetNeighbours(dst [][2]int, cfg Config, x, y int) [][2]int {
+	neighbourhood, err := NewNeighbourhood(cfg.Neighbourhood, cfg.Radius)
+	if err != nil {
+		return dst
+	}
 
-			ebitenutil.DrawRect(screen, float64(y*CellSize), float64(x*CellSize), float64(CellSize), float64(CellSize), colour)
+	for i := 0; i < neighbourhood.Size(); i++ {
+		dx, dy := neighbourhood.Offset(x, i)
+		nx, okX := cfg.Boundary.resolve(x+dx, cfg.GridHeight)
+		ny, okY := cfg.Boundary.resolve(y+dy, cfg.GridWidth)
+		if okX && okY && (cfg.Map == nil || !cfg.Map.isLand(nx, ny)) {
+			dst = append(dst, [2]int{nx, ny})
 		}
 	}
+	return dst
 }
 
 /**
- * @brief Updates the simulation for the game.
+ * @brief Returns the coordinates of the empty neighbours of a cell.
  *
- * This method invokes the UpdateSimulation function with the game's grid
- * and the number of threads being used. It performs the necessary updates
- * to the game's state.
+ * A neighbour is empty if neither grid of the world holds an entity there,
+ * so a cell an entity has already moved into this step is not empty, and
+ * land is never empty. These are the cells countNeighbours and
+ * chooseNeighbour find for a moving entity. Like GetNeighbours, this is
+ * meant for callers outside the update loop.
  *
- * @return nil if the update is successful; an error is returned if
- *         an issue occurs during the update process (note: currently
- *         it always returns nil).
- */func (g *Game) Update() error {
-	UpdateSimulation(g.grid, g.numThreads)
-	return nil
+ * @param dst The slice the coordinates are appended to, usually empty.
+ * @param cfg The simulation parameters giving the neighbourhood and boundary.
+ * @param w The world containing the cells to be checked.
+ * @param x The row of the cell whose neighbours are checked.
+ * @param y The column of the cell whose neighbours are checked.
+ * @return `dst` extended with the coordinates of the empty neighbours found.
+ */
+func FilterEmptyCells(dst [][2]int, cfg Config, w *World, x, y int) [][2]int {
+	return filterNeighbours(dst, cfg, w, x, y, emptyCells)
 }
 
 /**
- * @brief Sets the layout dimensions for the game screen.
+ * @brief Returns the coordinates of the neighbours of a cell holding fish.
  *
- * This method defines the layout for the game's screen based on the given
- * dimensions.
+ * A fish in either grid of the world is counted, whether or not it has
+ * taken its turn this step, as a shark can catch it either way.
  *
- * @param outsideWidth The width of the game screen.
- * @param outsideHeight The height of the game screen.
- * @return The dimensions of the game screen as two integers,
- *         representing the width and height, respectively.
+ * @param dst The slice the coordinates are appended to, usually empty.
+ * @param cfg The simulation parameters giving the neighbourhood and boundary.
+ * @param w The world containing the cells to be checked.
+ * @param x The row of the cell whose neighbours are checked.
+ * @param y The column of the cell whose neighbours are checked.
+ * @return `dst` extended with the coordinates of the fish found.
  */
-func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
-	return ScreenWidth, ScreenHeight
+func FilterFishCells(dst [][2]int, cfg Config, w *World, x, y int) [][2]int {
+	return filterNeighbours(dst, cfg, w, x, y, CellSet{}.With(Fish))
 }
 
 /**
- * @brief Benchmarks the performance of a simulation using different thread counts
- *        and outputs the results to a XLSX file.
- *
- * This function performs the following steps:
- * 1. Creates a XLSX file specified by `outputFile`.
- * 2. Writes a header row to the XLSX file.
- * 3. For each thread count specified in `threadCounts`, it initializes
- *    a grid, runs the simulation for the given number of steps, and
- *    measures the elapsed time.
- * 4. Calculates the speedup compared to the baseline (the time taken
- *    with the first thread count).
- * 5. Writes the thread count, execution time, and speedup to the XLSX file.
- *
- * @param steps The number of simulation steps to execute.
- * @param threadCounts A slice of integers representing the number of threads
- *                     to benchmark.
- * @param outputFile The path to the XLSX file where the results will be saved.
+ * @brief Shared implementation of FilterEmptyCells and FilterFishCells.
+ *
+ * @param dst The slice the coordinates are appended to.
+ * @param cfg The simulation parameters giving the neighbourhood and boundary.
+ * @param w The world containing the cells to be checked.
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @param set The cell types to look for.
+ * @return `dst` extended with the matching neighbours, in neighbourhood order.
  */
-func BenchmarkSimulationToXLSX(steps int, threadCounts []int, outputFile string) {
-	// Create a new Excel file
-	f := excelize.NewFile()
-
-	// Create a new sheet and handle both return values
-	index, err := f.NewSheet("Benchmark Results")
-	if err != nil {
-		fmt.Printf("Error creating sheet: %v\n", err)
-		return
+func filterNeighbours(dst [][2]int, cfg Config, w *World, x, y int, set CellSet) [][2]int {
+	w.prepare(cfg)
+	count := w.countNeighbours(x, y, &set)
+	for k := 0; k < count; k++ {
+		dst = append(dst, w.chooseNeighbour(x, y, &set, k))
 	}
+	return dst
+}
 
-	// Write the header
-	f.SetCellValue("Benchmark Results", "A1", "Threads")
-	f.SetCellValue("Benchmark Results", "B1", "Time (seconds)")
-	f.SetCellValue("Benchmark Results", "C1", "Speedup")
-
-	// Benchmark each thread count
-	baselineTime := 0.0
-	for i, numThreads := range threadCounts {
-		grid := InitialiseGrid() // Ensure you have this function defined
-		startTime := time.Now()
-
-		for step := 0; step < steps; step++ {
-			UpdateSimulation(grid, numThreads) // Ensure you have this function defined
-		}
-
-		duration := time.Since(startTime).Seconds()
-		if i == 0 {
-			baselineTime = duration
-		}
-
-		speedup := baselineTime / duration
-
-		// Write the result to Excel
-		f.SetCellValue("Benchmark Results", fmt.Sprintf("A%d", i+2), numThreads)
-		f.SetCellValue("Benchmark Results", fmt.Sprintf("B%d", i+2), duration)
-		f.SetCellValue("Benchmark Results", fmt.Sprintf("C%d", i+2), speedup)
-	}
+/**
+ * @brief Updates the simulation of the world using multiple threads.
+ *
+ * This function advances the world by one step, giving every entity alive
+ * at the start of the step exactly one turn. The rows of the grid are
+ * divided into bands (see partitionBands) which are updated in two phases,
+ * even bands then odd bands, with up to `numThreads` threads sharing the
+ * bands of each phase. Because bands in the same phase never touch the
+ * same rows, the threads never write to a cell another thread is reading
+ * or writing.
+ *
+ * Each band draws its random numbers from its own stream, seeded from the
+ * configured seed, the step number and the band (see StreamSeed). Since the
+ * bands do not depend on the thread count, a given seed, configuration and
+ * sequence of steps always produces the same grids.
+ *
+ * The world's buffers, reports and random sources are reused from step to
+ * step, so a step run on a single thread allocates no memory.
+ *
+ * @param cfg The simulation parameters.
+ * @param w The world to advance.
+ * @param numThreads The number of threads to use for processing the grid update.
+ * @param step The number of the step being taken, counting from zero.
+ * @return The counts of entities moved, born, eaten and starved this step.
+ */
+func UpdateSimulation(cfg Config, w *World, numThreads, step int) StepReport {
+	return updateSimulation(cfg, w, numThreads, step, false)
+}
 
-	// Set the active sheet
-	f.SetActiveSheet(index)
+/**
+ * @brief Updates the simulation like UpdateSimulation, recording every event.
+ *
+ * The returned report lists an Event for every entity that moved, stayed,
+ * was born, was eaten or starved, in the order the bands were processed.
+ * This is slower than UpdateSimulation and intended for tests and debugging.
+ *
+ * @param cfg The simulation parameters.
+ * @param w The world to advance.
+ * @param numThreads The number of threads to use for processing the grid update.
+ * @param step The number of the step being taken, counting from zero.
+ * @return The counts and events of the step.
+ */
+func TraceSimulation(cfg Config, w *World, numThreads, step int) StepReport {
+	return updateSimulation(cfg, w, numThreads, step, true)
+}
 
-	// Save the Excel file
-	if err := f.SaveAs(outputFile); err != nil {
-		fmt.Printf("Failed to save file: %v\n", err)
-		os.Exit(1)
+/**
+ * @brief Shared implementation of UpdateSimulation and TraceSimulation.
+ *
+ * Each band records into its own report, and the reports are merged in band
+ * order once every band has finished. The buffers are then swapped so the
+ * entities, all of which are now in the back grid, become the current state.
+ *
+ * @param cfg The simulation parameters.
+ * @param w The world to advance.
+ * @param numThreads The number of threads to use.
+ * @param step The number of the step being taken.
+ * @param trace Whether to record individual events.
+ * @return The merged report of the step.
+ */
+func updateSimulation(cfg Config, w *World, numThreads, step int, trace bool) StepReport {
+	w.prepare(cfg)
+	w.cfg, w.step, w.trace = cfg, step, trace
+	runBands(w.bands, numThreads, w.work)
+
+	report := StepReport{trace: trace}
+	for i := range w.reports {
+		report.merge(&w.reports[i])
 	}
-
-	fmt.Printf("Results saved to %s\n", outputFile)
+	w.swap()
+	return report
 }
 
 /**
- * @brief Main function to start simulation and benchmarking.
+ * @brief Gives every entity in a band of rows its turn.
+ *
+ * Each entity is handed to the Act method of its species, through the
+ * band's Turn. The nutrient of the band's cells grows back first, so the
+ * regrowth is done in parallel and each cell is only touched by one thread.
  *
- * This function initializes the simulation environment and begins the
- * benchmarking process.
+ * The parameters of the step are read from the world rather than passed in,
+ * so the world can hand the same function to runBands every step without
+ * allocating a closure.
  *
- * @return int Returns 0 on successful completion.
+ * @param band The index of the band.
+ * @param startRow The first row of the band.
+ * @param endRow The row after the last row of the band.
  */
-func RunSimulation() {
-	rand.Seed(time.Now().UnixNano())
-
-	threadCounts := []int{1, 2, 4, 8}      // Thread configurations to test
-	steps := 100                           // Number of steps for benchmarking
-	outputFile := "benchmark_results.xlsx" // File to save results to
-
-	fmt.Println("Benchmarking Wator Simulation:")
-	BenchmarkSimulationToXLSX(steps, threadCounts, outputFile)
-
-	game := &Game{
-		grid:       InitialiseGrid(),
-		numThreads: 1,
+func (w *World) updateBand(band, startRow, endRow int) {
+	report := &w.reports[band]
+	*report = StepReport{trace: w.trace}
+	turn := &w.turns[band]
+	turn.Config = w.cfg
+	turn.Rand = w.source(w.cfg, band, StreamSeed(w.cfg.Seed, w.step, band))
+
+	front := w.front
+	if w.nutrients != nil {
+		w.regrow(front.Index(startRow, 0), front.Index(endRow, 0))
 	}
-
-	ebiten.SetWindowSize(ScreenWidth, ScreenHeight)
-	ebiten.SetWindowTitle("Wator Simulation")
-
-	if err := ebiten.RunGame(game); err != nil {
-		panic(err)
+	for x := startRow; x < endRow; x++ {
+		row := front.Types[front.Index(x, 0):front.Index(x+1, 0)]
+		for y, cellType := range row {
+			if cellType != Empty && cellType != Land {
+				turn.begin(x, y, cellType)
+				w.species[cellType].Act(turn)
+			}
+		}
 	}
 }
@@ -0,0 +1,1005 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConfig returns a configuration for an empty grid of the given size
+func testConfig(size int) Config {
+	cfg := DefaultConfig()
+	cfg.GridWidth = size
+	cfg.GridHeight = size
+	cfg.InitialFishCount = 0
+	cfg.InitialSharkCount = 0
+	return cfg
+}
+
+// emptyWorld returns a world with a square grid of the given size and no entities
+func emptyWorld(size int) *World {
+	return NewWorld(NewGrid(size, size))
+}
+
+func TestGetNeighboursWrapsAround(t *testing.T) {
+	cfg := testConfig(5)
+
+	tests := []struct {
+		x, y int
+		want [][2]int
+	}{
+		{2, 2, [][2]int{{2, 1}, {2, 3}, {1, 2}, {3, 2}}},
+		{0, 0, [][2]int{{0, 4}, {0, 1}, {4, 0}, {1, 0}}},
+		{4, 4, [][2]int{{4, 3}, {4, 0}, {3, 4}, {0, 4}}},
+		{0, 4, [][2]int{{0, 3}, {0, 0}, {4, 4}, {1, 4}}},
+	}
+	for _, tt := range tests {
+		if got := GetNeighbours(nil, cfg, tt.x, tt.y); !slices.Equal(got, tt.want) {
+			t.Errorf("GetNeighbours(%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestGetNeighboursOnRectangularGrid(t *testing.T) {
+	cfg := testConfig(1)
+	cfg.GridWidth = 7
+	cfg.GridHeight = 3
+
+	got := GetNeighbours(nil, cfg, 2, 6)
+	want := [][2]int{{2, 5}, {2, 0}, {1, 6}, {0, 6}}
+	if !slices.Equal(got, want) {
+		t.Errorf("GetNeighbours(2, 6) on a 7x3 grid = %v, want %v", got, want)
+	}
+}
+
+func TestGetNeighboursAtCorners(t *testing.T) {
+	cfg := testConfig(1)
+	cfg.GridWidth = 5
+	cfg.GridHeight = 4
+
+	tests := []struct {
+		boundary Boundary
+		x, y     int
+		want     [][2]int
+	}{
+		{Torus, 0, 0, [][2]int{{0, 4}, {0, 1}, {3, 0}, {1, 0}}},
+		{Torus, 0, 4, [][2]int{{0, 3}, {0, 0}, {3, 4}, {1, 4}}},
+		{Torus, 3, 0, [][2]int{{3, 4}, {3, 1}, {2, 0}, {0, 0}}},
+		{Torus, 3, 4, [][2]int{{3, 3}, {3, 0}, {2, 4}, {0, 4}}},
+		{Walls, 0, 0, [][2]int{{0, 1}, {1, 0}}},
+		{Walls, 0, 4, [][2]int{{0, 3}, {1, 4}}},
+		{Walls, 3, 0, [][2]int{{3, 1}, {2, 0}}},
+		{Walls, 3, 4, [][2]int{{3, 3}, {2, 4}}},
+		{Walls, 0, 2, [][2]int{{0, 1}, {0, 3}, {1, 2}}},
+		{Reflective, 0, 0, [][2]int{{0, 1}, {0, 1}, {1, 0}, {1, 0}}},
+		{Reflective, 0, 4, [][2]int{{0, 3}, {0, 3}, {1, 4}, {1, 4}}},
+		{Reflective, 3, 0, [][2]int{{3, 1}, {3, 1}, {2, 0}, {2, 0}}},
+		{Reflective, 3, 4, [][2]int{{3, 3}, {3, 3}, {2, 4}, {2, 4}}},
+		{Reflective, 2, 2, [][2]int{{2, 1}, {2, 3}, {1, 2}, {3, 2}}},
+	}
+	for _, tt := range tests {
+		cfg.Boundary = tt.boundary
+		if got := GetNeighbours(nil, cfg, tt.x, tt.y); !slices.Equal(got, tt.want) {
+			t.Errorf("%v: GetNeighbours(%d, %d) = %v, want %v", tt.boundary, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestSingleRowReflectsOnlyAlongRow(t *testing.T) {
+	cfg := testConfig(1)
+	cfg.GridWidth = 3
+	cfg.Boundary = Reflective
+
+	got := GetNeighbours(nil, cfg, 0, 0)
+	if want := [][2]int{{0, 1}, {0, 1}}; !slices.Equal(got, want) {
+		t.Errorf("GetNeighbours(0, 0) on a 3x1 grid = %v, want %v", got, want)
+	}
+}
+
+func TestWallsKeepEntitiesInsideGrid(t *testing.T) {
+	cfg := testConfig(4)
+	cfg.Boundary = Walls
+	world := emptyWorld(4)
+	// The fish in the corner is boxed in by its only two neighbours
+	world.front.Set(0, 0, Entity{Type: Fish})
+	world.front.Set(0, 1, Entity{Type: Shark, StarveCounter: cfg.SharkStarveTime})
+	world.front.Set(1, 0, Entity{Type: Shark, StarveCounter: cfg.SharkStarveTime})
+
+	var report StepReport
+	MoveFish(cfg, world, 0, 0, newSource(cfg, 1), &report)
+	if report.FishStayed != 1 || world.back.At(0, 0).Type != Fish {
+		t.Fatalf("fish in a walled corner should stay put, report %+v", report.Accounting)
+	}
+
+	for _, boundary := range []Boundary{Walls, Reflective} {
+		cfg := DefaultConfig()
+		cfg.Boundary = boundary
+		cfg.Seed = 5
+		sim, err := NewSimulation(cfg, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for step := 0; step < 100; step++ {
+			report := sim.Trace()
+			for _, e := range report.Events {
+				dx, dy := e.To[0]-e.From[0], e.To[1]-e.From[1]
+				if e.Kind == Moved && dx*dx+dy*dy != 1 {
+					t.Fatalf("%v: step %d: %v moved from %v to %v across the edge", boundary, step, e.Type, e.From, e.To)
+				}
+			}
+		}
+	}
+}
+
+func TestRectangularGridShape(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.GridWidth = 80
+	cfg.GridHeight = 20
+	grid, err := InitialiseGrid(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grid.Rows != 20 || grid.Cols != 80 || len(grid.Types) != 1600 {
+		t.Fatalf("grid has %d rows of %d cells, want 20 rows of 80", grid.Rows, grid.Cols)
+	}
+
+	cfg.ScreenWidth, cfg.ScreenHeight = 500, 500
+	cfg.GridWidth, cfg.GridHeight = 4000, 2000
+	if w, h := cfg.WindowSize(); w != 500 || h != 250 {
+		t.Errorf("WindowSize() for a 4000x2000 grid = %dx%d, want 500x250", w, h)
+	}
+}
+
+func TestCountAndChooseNeighbours(t *testing.T) {
+	cfg := testConfig(3)
+	world := emptyWorld(3)
+	world.prepare(cfg)
+	world.front.Set(1, 0, Entity{Type: Fish})
+	world.front.Set(0, 1, Entity{Type: Shark})
+	// A fish that has already acted this step is in the back grid
+	world.back.Set(2, 1, Entity{Type: Fish})
+
+	// The neighbours of (1, 1) are (1, 0), (1, 2), (0, 1) and (2, 1)
+	fish := CellSet{}.With(Fish)
+	if got := world.countNeighbours(1, 1, &emptyCells); got != 1 {
+		t.Errorf("empty neighbours = %d, want 1", got)
+	}
+	if got := world.countNeighbours(1, 1, &fish); got != 2 {
+		t.Errorf("fish neighbours = %d, want 2", got)
+	}
+	if animals := fish.With(Shark); world.countNeighbours(1, 1, &animals) != 3 {
+		t.Errorf("fish and shark neighbours = %d, want 3", world.countNeighbours(1, 1, &animals))
+	}
+	if got, want := world.chooseNeighbour(1, 1, &fish, 1), [2]int{2, 1}; got != want {
+		t.Errorf("second fish neighbour = %v, want %v", got, want)
+	}
+	if got, want := world.chooseNeighbour(1, 1, &emptyCells, 0), [2]int{1, 2}; got != want {
+		t.Errorf("first empty neighbour = %v, want %v", got, want)
+	}
+}
+
+func TestFilterCells(t *testing.T) {
+	cfg := testConfig(4)
+	world := emptyWorld(4)
+	world.front.Set(0, 1, Entity{Type: Fish})
+	world.front.Set(1, 0, Entity{Type: Shark})
+	// A fish that has already acted this step is in the back grid
+	world.back.Set(2, 1, Entity{Type: Fish})
+	// Land is kept in both grids and is neither empty nor a fish
+	world.front.Set(1, 2, Entity{Type: Land})
+	world.back.Set(1, 2, Entity{Type: Land})
+
+	if got := FilterEmptyCells(nil, cfg, world, 1, 1); len(got) != 0 {
+		t.Errorf("FilterEmptyCells(1, 1) = %v, want none", got)
+	}
+	if got, want := FilterEmptyCells(nil, cfg, world, 2, 2), [][2]int{{2, 3}, {3, 2}}; !slices.Equal(got, want) {
+		t.Errorf("FilterEmptyCells(2, 2) = %v, want %v", got, want)
+	}
+	if got, want := FilterFishCells(nil, cfg, world, 1, 1), [][2]int{{0, 1}, {2, 1}}; !slices.Equal(got, want) {
+		t.Errorf("FilterFishCells(1, 1) = %v, want %v", got, want)
+	}
+}
+
+func TestNeighbourhoodSizes(t *testing.T) {
+	tests := []struct {
+		kind   NeighbourhoodKind
+		radius int
+		size   int
+	}{
+		{VonNeumann, 1, 4},
+		{VonNeumann, 2, 12},
+		{Moore, 1, 8},
+		{Moore, 2, 24},
+		{Hexagonal, 1, 6},
+		{Hexagonal, 2, 18},
+		{Hexagonal, 3, 36},
+	}
+	for _, tt := range tests {
+		n, err := NewNeighbourhood(tt.kind, tt.radius)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Size() != tt.size || n.Reach() != tt.radius {
+			t.Errorf("%v radius %d: size %d reach %d, want %d and %d", tt.kind, tt.radius, n.Size(), n.Reach(), tt.size, tt.radius)
+		}
+	}
+	if _, err := NewNeighbourhood(Moore, 0); err == nil {
+		t.Error("expected an error for radius 0")
+	}
+}
+
+func TestHexNeighboursDependOnRowParity(t *testing.T) {
+	cfg := testConfig(6)
+	cfg.Neighbourhood = Hexagonal
+
+	// Odd rows are shifted right, so an even row reaches up and down to the
+	// left and an odd row up and down to the right
+	tests := []struct {
+		x, y int
+		want [][2]int
+	}{
+		{2, 2, [][2]int{{2, 1}, {2, 3}, {1, 2}, {3, 2}, {1, 1}, {3, 1}}},
+		{3, 2, [][2]int{{3, 1}, {3, 3}, {2, 2}, {4, 2}, {2, 3}, {4, 3}}},
+	}
+	for _, tt := range tests {
+		if got := GetNeighbours(nil, cfg, tt.x, tt.y); !slices.Equal(got, tt.want) {
+			t.Errorf("GetNeighbours(%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestNeighbourhoodsAreSymmetric(t *testing.T) {
+	for _, kind := range []NeighbourhoodKind{VonNeumann, Moore, Hexagonal} {
+		for radius := 1; radius <= 3; radius++ {
+			cfg := testConfig(12)
+			cfg.Neighbourhood = kind
+			cfg.Radius = radius
+			for x := 0; x < 12; x++ {
+				for y := 0; y < 12; y++ {
+					for _, n := range GetNeighbours(nil, cfg, x, y) {
+						if !slices.Contains(GetNeighbours(nil, cfg, n[0], n[1]), [2]int{x, y}) {
+							t.Fatalf("%v radius %d: %v neighbours (%d, %d) but not the other way round", kind, radius, n, x, y)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEveryNeighbourhoodConservesPopulation(t *testing.T) {
+	for _, kind := range []NeighbourhoodKind{Moore, Hexagonal} {
+		for _, radius := range []int{1, 2} {
+			cfg := DefaultConfig()
+			cfg.Neighbourhood = kind
+			cfg.Radius = radius
+			cfg.Seed = 13
+
+			var grids []Grid
+			for _, threads := range []int{1, 4} {
+				sim, err := NewSimulation(cfg, threads)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for step := 0; step < 50; step++ {
+					fishBefore, sharksBefore := sim.Population()
+					report := sim.Step()
+					fishAfter, sharksAfter := CountEntities(sim.world.Grid())
+					if err := report.Check(fishBefore, sharksBefore, fishAfter, sharksAfter); err != nil {
+						t.Fatalf("%v radius %d, step %d: %v", kind, radius, step, err)
+					}
+				}
+				grids = append(grids, sim.Grid())
+			}
+			if !grids[0].Equal(grids[1]) {
+				t.Errorf("%v radius %d: thread count changed the outcome", kind, radius)
+			}
+		}
+	}
+}
+
+func TestFishMovesAndBreeds(t *testing.T) {
+	cfg := testConfig(5)
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: Fish, BreedCounter: cfg.FishBreedTime - 1})
+
+	var report StepReport
+	MoveFish(cfg, world, 2, 2, newSource(cfg, 1), &report)
+
+	if child := world.back.At(2, 2); child != (Entity{Type: Fish}) {
+		t.Fatalf("expected a newborn fish at the old position, got %+v", child)
+	}
+	parents := 0
+	for _, n := range GetNeighbours(nil, cfg, 2, 2) {
+		if parent := world.back.At(n[0], n[1]); parent.Type == Fish {
+			parents++
+			if parent.BreedCounter != 0 {
+				t.Errorf("parent breed counter = %d, want 0", parent.BreedCounter)
+			}
+		}
+	}
+	if fish, _ := CountEntities(world.back); parents != 1 || fish != 2 {
+		t.Errorf("found %d fish in the neighbours of (2, 2) and %d in total, want 1 and 2", parents, fish)
+	}
+	if fish, _ := CountEntities(world.front); fish != 0 {
+		t.Errorf("the fish that moved is still waiting to act")
+	}
+	if report.FishMoved != 1 || report.FishBorn != 1 {
+		t.Errorf("report = %+v, want one fish moved and one born", report.Accounting)
+	}
+}
+
+func TestSurroundedFishStaysAndDoesNotBreed(t *testing.T) {
+	cfg := testConfig(3)
+	world := emptyWorld(3)
+	world.front.Set(1, 1, Entity{Type: Fish, BreedCounter: cfg.FishBreedTime - 1})
+	for _, n := range GetNeighbours(nil, cfg, 1, 1) {
+		world.front.Set(n[0], n[1], Entity{Type: Fish})
+	}
+
+	var report StepReport
+	MoveFish(cfg, world, 1, 1, newSource(cfg, 1), &report)
+
+	fish := world.At(1, 1)
+	if fish.Type != Fish {
+		t.Fatalf("surrounded fish should stay in place")
+	}
+	if fish.BreedCounter != cfg.FishBreedTime {
+		t.Errorf("breed counter = %d, want %d", fish.BreedCounter, cfg.FishBreedTime)
+	}
+	if report.FishStayed != 1 || report.FishBorn != 0 {
+		t.Errorf("report = %+v, want one fish stayed and none born", report.Accounting)
+	}
+}
+
+func TestSharkEatsFish(t *testing.T) {
+	cfg := testConfig(5)
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: Shark, StarveCounter: 2})
+	world.front.Set(2, 3, Entity{Type: Fish})
+
+	var report StepReport
+	MoveShark(cfg, world, 2, 2, newSource(cfg, 1), &report)
+
+	shark := world.At(2, 3)
+	if shark.Type != Shark || world.front.At(2, 3).Type != Empty {
+		t.Fatalf("shark should have moved onto the fish at (2, 3)")
+	}
+	if cell := world.At(2, 2); cell.Type != Empty {
+		t.Errorf("old shark position should be empty, got %+v", cell)
+	}
+	if shark.StarveCounter != cfg.SharkStarveTime {
+		t.Errorf("starve counter = %d, want %d", shark.StarveCounter, cfg.SharkStarveTime)
+	}
+	if report.FishEaten != 1 || report.SharksMoved != 1 {
+		t.Errorf("report = %+v, want one fish eaten and one shark moved", report.Accounting)
+	}
+}
+
+func TestSharkStarves(t *testing.T) {
+	cfg := testConfig(5)
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: Shark, StarveCounter: 1, BreedCounter: cfg.SharkBreedTime})
+
+	var report StepReport
+	MoveShark(cfg, world, 2, 2, newSource(cfg, 1), &report)
+
+	if fish, sharks := countWorld(world); fish != 0 || sharks != 0 {
+		t.Fatalf("starved shark should leave an empty grid, found %d fish and %d sharks", fish, sharks)
+	}
+	if report.SharksStarved != 1 || report.SharksBorn != 0 {
+		t.Errorf("report = %+v, want one shark starved and none born", report.Accounting)
+	}
+}
+
+func TestSharkBreeds(t *testing.T) {
+	cfg := testConfig(5)
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: Shark, StarveCounter: cfg.SharkStarveTime, BreedCounter: cfg.SharkBreedTime - 1})
+
+	var report StepReport
+	MoveShark(cfg, world, 2, 2, newSource(cfg, 1), &report)
+
+	child := world.back.At(2, 2)
+	if child.Type != Shark || child.BreedCounter != 0 {
+		t.Fatalf("expected a newborn shark at the old position, got %+v", child)
+	}
+	if child.StarveCounter != cfg.SharkStarveTime {
+		t.Errorf("newborn starve counter = %d, want %d", child.StarveCounter, cfg.SharkStarveTime)
+	}
+	if _, sharks := CountEntities(world.front); sharks != 0 {
+		t.Errorf("newborn shark should not act in the step it was born")
+	}
+	if report.SharksMoved != 1 || report.SharksBorn != 1 {
+		t.Errorf("report = %+v, want one shark moved and one born", report.Accounting)
+	}
+}
+
+// energyConfig returns testConfig with the shark energy model switched on
+func energyConfig(size int) Config {
+	cfg := testConfig(size)
+	cfg.SharkEnergyModel = true
+	cfg.SharkInitialEnergy = 4
+	cfg.SharkEnergyPerFish = 3
+	cfg.SharkMaxEnergy = 6
+	cfg.SharkMoveCost = 1
+	return cfg
+}
+
+func TestSharkEnergyIsCappedWhenEating(t *testing.T) {
+	cfg := energyConfig(5)
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: Shark, Energy: 5})
+	world.front.Set(2, 3, Entity{Type: Fish})
+
+	var report StepReport
+	MoveShark(cfg, world, 2, 2, newSource(cfg, 1), &report)
+
+	// 5 - 1 + 3 would be 7, above the cap of 6
+	if shark := world.At(2, 3); shark.Type != Shark || shark.Energy != cfg.SharkMaxEnergy || shark.StarveCounter != 0 {
+		t.Fatalf("shark after eating = %+v, want energy %d and no starve counter", shark, cfg.SharkMaxEnergy)
+	}
+	if report.FishEaten != 1 || report.SharkEnergy != cfg.SharkMaxEnergy {
+		t.Errorf("report = %+v with energy %d, want one fish eaten and energy %d",
+			report.Accounting, report.SharkEnergy, cfg.SharkMaxEnergy)
+	}
+}
+
+func TestSharkRunsOutOfEnergy(t *testing.T) {
+	cfg := energyConfig(5)
+	cfg.SharkMoveCost = 2
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: Shark, Energy: 2, StarveCounter: cfg.SharkStarveTime})
+
+	var report StepReport
+	MoveShark(cfg, world, 2, 2, newSource(cfg, 1), &report)
+
+	if _, sharks := countWorld(world); sharks != 0 || report.SharksStarved != 1 {
+		t.Errorf("shark spending its last energy should starve, found %d sharks and report %+v", sharks, report.Accounting)
+	}
+}
+
+func TestSharkThatStaysSpendsNoEnergy(t *testing.T) {
+	cfg := energyConfig(3)
+	world := emptyWorld(3)
+	world.front.Set(1, 1, Entity{Type: Shark, Energy: 1})
+	for _, pos := range [][2]int{{0, 1}, {2, 1}, {1, 0}, {1, 2}} {
+		world.front.Set(pos[0], pos[1], Entity{Type: Shark, Energy: 4})
+	}
+
+	var report StepReport
+	MoveShark(cfg, world, 1, 1, newSource(cfg, 1), &report)
+
+	if shark := world.back.At(1, 1); shark.Type != Shark || shark.Energy != 1 {
+		t.Fatalf("surrounded shark = %+v, want it in place with its energy of 1", shark)
+	}
+	if report.SharksStayed != 1 || report.SharksStarved != 0 {
+		t.Errorf("report = %+v, want one shark stayed", report.Accounting)
+	}
+}
+
+func TestSharkSplitsEnergyWhenBreeding(t *testing.T) {
+	cfg := energyConfig(5)
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: Shark, Energy: 6, BreedCounter: cfg.SharkBreedTime - 1})
+
+	var report StepReport
+	MoveShark(cfg, world, 2, 2, newSource(cfg, 1), &report)
+
+	child := world.back.At(2, 2)
+	if child.Type != Shark || child.Energy != 2 || child.StarveCounter != 0 {
+		t.Fatalf("newborn = %+v, want a shark with energy 2", child)
+	}
+	parentEnergy := TotalSharkEnergy(world.back) - child.Energy
+	if parentEnergy != 3 || report.SharkEnergy != 5 {
+		t.Errorf("parent energy = %d and report energy %d, want 3 and 5", parentEnergy, report.SharkEnergy)
+	}
+}
+
+func TestSharkWithoutEnergyToShareDoesNotBreed(t *testing.T) {
+	cfg := energyConfig(5)
+	world := emptyWorld(5)
+	world.front.Set(2, 2, Entity{Type: Shark, Energy: 2, BreedCounter: cfg.SharkBreedTime - 1})
+
+	var report StepReport
+	MoveShark(cfg, world, 2, 2, newSource(cfg, 1), &report)
+
+	if _, sharks := countWorld(world); sharks != 1 || report.SharksBorn != 0 {
+		t.Fatalf("shark left with 1 energy should not breed, found %d sharks", sharks)
+	}
+	if child := world.back.At(2, 2); child.Type != Empty {
+		t.Errorf("old position should be empty, got %+v", child)
+	}
+}
+
+func TestEnergyModelConservesPopulation(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SharkEnergyModel = true
+	cfg.Seed = 11
+	sim, err := NewSimulation(cfg, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if energy := TotalSharkEnergy(sim.world.Grid()); energy != cfg.InitialSharkCount*cfg.SharkInitialEnergy {
+		t.Fatalf("initial shark energy = %d, want %d", energy, cfg.InitialSharkCount*cfg.SharkInitialEnergy)
+	}
+
+	for step := 0; step < 100; step++ {
+		fishBefore, sharksBefore := CountEntities(sim.world.Grid())
+		report := sim.Trace()
+		grid := sim.world.Grid()
+		fishAfter, sharksAfter := CountEntities(grid)
+		if err := report.Check(fishBefore, sharksBefore, fishAfter, sharksAfter); err != nil {
+			t.Fatalf("step %d: %v", step, err)
+		}
+		if energy := TotalSharkEnergy(grid); energy != report.SharkEnergy {
+			t.Fatalf("step %d: grid holds %d shark energy, report says %d", step, energy, report.SharkEnergy)
+		}
+		for i, cellType := range grid.Types {
+			if cellType == Shark && (grid.Energy[i] <= 0 || int(grid.Energy[i]) > cfg.SharkMaxEnergy) {
+				t.Fatalf("step %d: shark energy %d outside 1..%d", step, grid.Energy[i], cfg.SharkMaxEnergy)
+			}
+		}
+	}
+}
+
+func TestPopulationConservation(t *testing.T) {
+	for _, threads := range []int{1, 2, 3, 8} {
+		t.Run(fmt.Sprintf("threads=%d", threads), func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Seed = 7
+			sim, err := NewSimulation(cfg, threads)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for step := 0; step < 200; step++ {
+				fishBefore, sharksBefore := CountEntities(sim.world.Grid())
+				report := sim.Trace()
+				fishAfter, sharksAfter := CountEntities(sim.world.Grid())
+
+				if err := report.Check(fishBefore, sharksBefore, fishAfter, sharksAfter); err != nil {
+					t.Fatalf("step %d: %v", step, err)
+				}
+				if fish, sharks := sim.Population(); fish != fishAfter || sharks != sharksAfter {
+					t.Fatalf("step %d: Population() = %d, %d, grid holds %d, %d", step, fish, sharks, fishAfter, sharksAfter)
+				}
+				if got := tally(report.Events); got != report.Accounting {
+					t.Fatalf("step %d: events tally to %+v, counts are %+v", step, got, report.Accounting)
+				}
+			}
+		})
+	}
+}
+
+func TestAccountingCheck(t *testing.T) {
+	tests := []struct {
+		name                     string
+		a                        Accounting
+		fishBefore, sharksBefore int
+		fishAfter, sharksAfter   int
+		wantErr                  bool
+	}{
+		{"balanced", Accounting{FishMoved: 8, FishStayed: 2, FishBorn: 3, FishEaten: 4, SharksMoved: 4, SharksStayed: 1, SharksBorn: 2, SharksStarved: 1}, 10, 6, 9, 7, false},
+		{"shark eaten before its turn", Accounting{SharksMoved: 2, SharksEaten: 1}, 0, 3, 0, 2, false},
+		{"fish missing", Accounting{FishMoved: 10, FishBorn: 1}, 10, 0, 10, 0, true},
+		{"fish starved", Accounting{FishStayed: 5, FishStarved: 2}, 5, 0, 3, 0, false},
+		{"shark missing", Accounting{SharksMoved: 5, SharksBorn: 1}, 0, 5, 0, 5, true},
+		{"shark never acted", Accounting{SharksMoved: 4}, 0, 5, 0, 5, true},
+		{"shark acted twice", Accounting{SharksMoved: 5, SharksStayed: 1}, 0, 5, 0, 5, true},
+	}
+	for _, tt := range tests {
+		err := tt.a.Check(tt.fishBefore, tt.sharksBefore, tt.fishAfter, tt.sharksAfter)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Check() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// Every discrepancy is reported, not just the first
+	err := Accounting{}.Check(1, 1, 0, 0)
+	if err == nil || !strings.Contains(err.Error(), "fish") || !strings.Contains(err.Error(), "sharks") {
+		t.Errorf("Check() = %v, want both the fish and the sharks reported", err)
+	}
+}
+
+func TestSameSeedGivesSameGridsForAnyThreadCount(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Seed = 42
+
+	reference, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	others := make([]*Simulation, 0, 3)
+	for _, threads := range []int{2, 4, 8} {
+		sim, err := NewSimulation(cfg, threads)
+		if err != nil {
+			t.Fatal(err)
+		}
+		others = append(others, sim)
+	}
+
+	for step := 0; step < 50; step++ {
+		reference.Step()
+		for _, sim := range others {
+			sim.Step()
+			if !reference.world.Grid().Equal(sim.world.Grid()) {
+				t.Fatalf("step %d: grid with %d threads differs from grid with 1 thread", step, sim.Threads())
+			}
+		}
+	}
+}
+
+// The stream of random numbers an entity draws depends on its band and the
+// step, never on the thread that happens to update the band, so runs with
+// the same seed match step for step under every rule set and thread count
+func TestSameSeedMatchesAcrossThreadCountsForEveryRule(t *testing.T) {
+	configs := map[string]func(*Config){
+		"moore walls":       func(c *Config) { c.Neighbourhood, c.Boundary = Moore, Walls },
+		"hex reflective":    func(c *Config) { c.Neighbourhood, c.Boundary = Hexagonal, Reflective },
+		"radius 2":          func(c *Config) { c.Radius = 2 },
+		"shark energy":      func(c *Config) { c.SharkEnergyModel = true },
+		"rectangular torus": func(c *Config) { c.GridWidth, c.GridHeight = 150, 60 },
+	}
+	for name, change := range configs {
+		cfg := DefaultConfig()
+		cfg.Seed = 5
+		change(&cfg)
+
+		var runs []*Simulation
+		for _, threads := range []int{1, 3, 5, 16} {
+			sim, err := NewSimulation(cfg, threads)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			sim.StepN(30)
+			runs = append(runs, sim)
+		}
+		for _, sim := range runs[1:] {
+			if !runs[0].world.Grid().Equal(sim.world.Grid()) {
+				t.Errorf("%s: grid with %d threads differs from grid with 1 thread", name, sim.Threads())
+			}
+			if !reflect.DeepEqual(runs[0].Stats(), sim.Stats()) {
+				t.Errorf("%s: statistics with %d threads differ from 1 thread", name, sim.Threads())
+			}
+		}
+	}
+}
+
+func TestResetReproducesRun(t *testing.T) {
+	cfg := DefaultConfig()
+	sim, err := NewSimulation(cfg, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sim.Reset(99); err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(20)
+	first := sim.Grid()
+
+	if err := sim.Reset(99); err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(20)
+	if !first.Equal(sim.world.Grid()) {
+		t.Fatal("resetting with the same seed did not reproduce the run")
+	}
+	if sim.StepCount() != 20 || len(sim.Stats()) != 21 {
+		t.Errorf("step count %d with %d stats entries, want 20 and 21", sim.StepCount(), len(sim.Stats()))
+	}
+}
+
+func TestRecentStatsReturnsTheLatestSteps(t *testing.T) {
+	sim, err := NewSimulation(DefaultConfig(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(10)
+
+	recent := sim.RecentStats(4)
+	if len(recent) != 4 || recent[0].Step != 7 || recent[3].Step != 10 {
+		t.Errorf("RecentStats(4) holds %d entries from step %d", len(recent), recent[0].Step)
+	}
+	if all := sim.RecentStats(100); len(all) != 11 {
+		t.Errorf("RecentStats(100) holds %d entries, want all 11", len(all))
+	}
+	if none := sim.RecentStats(0); len(none) != 0 {
+		t.Errorf("RecentStats(0) holds %d entries", len(none))
+	}
+}
+
+func TestKeepStatsBoundsTheHistory(t *testing.T) {
+	sim, err := NewSimulation(testConfig(10), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(5)
+	sim.KeepStats(3)
+	if stats := sim.Stats(); len(stats) != 3 || stats[0].Step != 3 {
+		t.Errorf("after limiting, Stats holds %d entries from step %d, want 3 from step 3", len(stats), stats[0].Step)
+	}
+
+	for step := 6; step <= 50; step++ {
+		sim.Step()
+		if len(sim.stats) > 6 {
+			t.Fatalf("step %d: %d entries kept with a limit of 3", step, len(sim.stats))
+		}
+		stats := sim.Stats()
+		if len(stats) != 3 || stats[2].Step != step {
+			t.Fatalf("step %d: Stats holds %d entries up to step %d", step, len(stats), stats[len(stats)-1].Step)
+		}
+		if recent := sim.RecentStats(2); len(recent) != 2 || recent[0].Step != step-1 {
+			t.Fatalf("step %d: RecentStats(2) holds %d entries from step %d", step, len(recent), recent[0].Step)
+		}
+	}
+
+	sim.KeepStats(0)
+	sim.StepN(10)
+	if stats := sim.Stats(); len(stats) != 13 {
+		t.Errorf("without a limit, Stats holds %d entries, want 13", len(stats))
+	}
+}
+
+func TestEntitiesAgeEachStep(t *testing.T) {
+	cfg := testConfig(6)
+	cfg.FishBreedTime = 3
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Paint(2, 2, Fish); err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(3)
+
+	// The fish has bred on its third step, leaving a newborn behind
+	var ages []int
+	grid := sim.View()
+	for x := 0; x < grid.Rows; x++ {
+		for y := 0; y < grid.Cols; y++ {
+			if e := grid.At(x, y); e.Type == Fish {
+				ages = append(ages, e.Age)
+			}
+		}
+	}
+	slices.Sort(ages)
+	if !slices.Equal(ages, []int{0, 3}) {
+		t.Errorf("fish ages are %v, want [0 3]", ages)
+	}
+}
+
+func TestViewSharesTheGrid(t *testing.T) {
+	sim, err := NewSimulation(testConfig(8), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(3)
+	if view, grid := sim.View(), sim.Grid(); !slices.Equal(view.Types, grid.Types) {
+		t.Fatal("View and Grid differ")
+	}
+	if err := sim.Paint(0, 0, Shark); err != nil {
+		t.Fatal(err)
+	}
+	if got := sim.View().At(0, 0).Type; got != Shark {
+		t.Errorf("View shows %v at the painted cell, want Shark", got)
+	}
+}
+
+func TestPaintPutsNewbornsAndEmptiesCells(t *testing.T) {
+	cfg := testConfig(6)
+	cfg.Map = &WorldMap{Rows: 6, Cols: 6, Cells: make([]CellType, 36)}
+	cfg.Map.Cells[0] = Land
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cell := range [][2]int{{1, 1}, {2, 2}} {
+		if err := sim.Paint(cell[0], cell[1], Fish); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sim.Paint(3, 3, Shark); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Paint(2, 2, Empty); err != nil {
+		t.Fatal(err)
+	}
+	if e := sim.Cell(3, 3); e.Type != Shark || e.StarveCounter != cfg.SharkStarveTime {
+		t.Errorf("painted shark is %+v, want a newborn", e)
+	}
+	if fish, sharks := sim.Population(); fish != 1 || sharks != 1 {
+		t.Errorf("population is %d fish and %d sharks after painting, want 1 and 1", fish, sharks)
+	}
+	if latest := sim.Stats()[0]; latest.Fish != 1 || latest.Sharks != 1 {
+		t.Errorf("statistics of the painted grid are %+v", latest)
+	}
+
+	for _, bad := range []struct {
+		x, y     int
+		cellType CellType
+	}{{0, 0, Fish}, {6, 0, Fish}, {1, 1, 7}} {
+		if err := sim.Paint(bad.x, bad.y, bad.cellType); err == nil {
+			t.Errorf("painting type %d at (%d, %d) was accepted", bad.cellType, bad.x, bad.y)
+		}
+	}
+
+	// The painted world carries on like any other
+	fishBefore, sharksBefore := CountEntities(sim.world.Grid())
+	report := sim.Trace()
+	fishAfter, sharksAfter := CountEntities(sim.world.Grid())
+	if err := report.Check(fishBefore, sharksBefore, fishAfter, sharksAfter); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+
+	tests := map[string]func(*Config){
+		"zero width":      func(c *Config) { c.GridWidth = 0 },
+		"zero height":     func(c *Config) { c.GridHeight = 0 },
+		"too many":        func(c *Config) { c.InitialFishCount = c.Cells() },
+		"negative fish":   func(c *Config) { c.InitialFishCount = -1 },
+		"zero fish breed": func(c *Config) { c.FishBreedTime = 0 },
+		"zero starve":     func(c *Config) { c.SharkStarveTime = 0 },
+		"bad boundary":    func(c *Config) { c.Boundary = Reflective + 1 },
+		"zero radius":     func(c *Config) { c.Radius = 0 },
+		"odd hex torus":   func(c *Config) { c.Neighbourhood, c.GridHeight = Hexagonal, 51 },
+		"zero energy":     func(c *Config) { c.SharkEnergyModel, c.SharkInitialEnergy = true, 0 },
+		"cap below start": func(c *Config) { c.SharkEnergyModel, c.SharkMaxEnergy = true, c.SharkInitialEnergy-1 },
+		"free moves":      func(c *Config) { c.SharkEnergyModel, c.SharkMoveCost = true, 0 },
+		"huge fish breed": func(c *Config) { c.FishBreedTime = math.MaxInt32 + 1 },
+		"huge breed":      func(c *Config) { c.SharkBreedTime = math.MaxInt32 + 1 },
+		"huge starve":     func(c *Config) { c.SharkStarveTime = math.MaxInt32 + 1 },
+	}
+	for name, change := range tests {
+		cfg := DefaultConfig()
+		change(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if _, err := InitialiseGrid(cfg); err == nil {
+			t.Errorf("%s: InitialiseGrid accepted an invalid config", name)
+		}
+	}
+}
+
+func TestCounterTimesFitTheGrid(t *testing.T) {
+	cfg := testConfig(4)
+	cfg.InitialSharkCount = 3
+	cfg.FishBreedTime, cfg.SharkBreedTime, cfg.SharkStarveTime = math.MaxInt32, math.MaxInt32, math.MaxInt32
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("times of MaxInt32 rejected: %v", err)
+	}
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Step()
+	if _, sharks := CountEntities(sim.Grid()); sharks != 3 {
+		t.Errorf("3 sharks with the longest starve time became %d after a step", sharks)
+	}
+
+	web := ExampleFoodWeb()
+	web[0].BreedTime = math.MaxInt32 + 1
+	if _, err := NewFoodWebRules(web); err == nil || !strings.Contains(err.Error(), "at most") {
+		t.Errorf("food web breed time above MaxInt32: error = %v", err)
+	}
+}
+
+func TestPartitionBandsCoverEveryRow(t *testing.T) {
+	for reach := 1; reach <= 3; reach++ {
+		for rows := 1; rows <= 300; rows++ {
+			bands := partitionBands(rows, reach)
+			if len(bands) > 1 && len(bands)%2 != 0 {
+				t.Fatalf("%d rows: odd band count %d", rows, len(bands))
+			}
+			next := 0
+			for _, band := range bands {
+				if band[0] != next {
+					t.Fatalf("%d rows: band %v does not start at %d", rows, band, next)
+				}
+				if len(bands) > 1 && band[1]-band[0] < 2*reach {
+					t.Fatalf("%d rows, reach %d: band %v is shorter than %d rows", rows, reach, band, 2*reach)
+				}
+				next = band[1]
+			}
+			if next != rows {
+				t.Fatalf("%d rows: bands end at %d", rows, next)
+			}
+		}
+	}
+}
+
+// The bands of a phase run at the same time, so no row within reach of one
+// band may be touched by another band of the same phase. Each band marks
+// the rows it can reach as busy while it works; run with -race, the plain
+// writes to touched also show up any overlap the busy counts miss.
+func TestRunBandsNeverShareRows(t *testing.T) {
+	for reach := 1; reach <= 3; reach++ {
+		for _, rows := range []int{6, 40, 129, 1000} {
+			bands := partitionBands(rows, reach)
+			busy := make([]atomic.Int32, rows)
+			touched := make([]int, rows)
+			runBands(bands, 8, func(band, startRow, endRow int) {
+				for row := startRow - reach; row < endRow+reach; row++ {
+					r := (row%rows + rows) % rows
+					if busy[r].Add(1) > 1 && len(bands) > 1 {
+						t.Errorf("%d rows, reach %d: band %d shares row %d with another band", rows, reach, band, r)
+					}
+					touched[r]++
+				}
+				time.Sleep(time.Millisecond)
+				for row := startRow - reach; row < endRow+reach; row++ {
+					busy[(row%rows+rows)%rows].Add(-1)
+				}
+			})
+		}
+	}
+}
+
+// Every neighbourhood and boundary is stepped on many threads at once, so
+// run with -race this shows any cell two bands touch together
+func TestParallelStepsDoNotRace(t *testing.T) {
+	for _, neighbourhood := range []NeighbourhoodKind{VonNeumann, Moore, Hexagonal} {
+		for _, boundary := range []Boundary{Torus, Walls, Reflective} {
+			cfg := DefaultConfig()
+			cfg.GridWidth, cfg.GridHeight = 64, 64
+			cfg.Neighbourhood, cfg.Boundary, cfg.Radius = neighbourhood, boundary, 2
+			cfg.Seed = 3
+			sim, err := NewSimulation(cfg, 8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sim.StepN(20)
+		}
+	}
+}
+
+// countWorld counts the entities in both grids of a world part way through a step
+func countWorld(w *World) (fish, sharks int) {
+	fish, sharks = CountEntities(w.front)
+	backFish, backSharks := CountEntities(w.back)
+	return fish + backFish, sharks + backSharks
+}
+
+// tally recounts a list of events into an Accounting
+func tally(events []Event) Accounting {
+	var report StepReport
+	for _, e := range events {
+		report.record(e.Kind, e.Type, e.From, e.To)
+	}
+	return report.Accounting
+}
+
+func BenchmarkUpdateSimulation(b *testing.B) {
+	for _, size := range []int{50, 200, 1000} {
+		for _, threads := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("grid=%d/threads=%d", size, threads), func(b *testing.B) {
+				cfg := ScaledConfig(size)
+				cfg.Seed = 1
+				sim, err := NewSimulation(cfg, threads)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					sim.Step()
+				}
+				b.ReportMetric(float64(size*size)*float64(b.N)/b.Elapsed().Seconds(), "cells/s")
+			})
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"math"
+	"slices"
+)
+
+// World is a grid together with everything needed to update it without
+// allocating: a second grid of the same size used as a back buffer, the
+// species and neighbourhood of the cells, the bands the rows are split
+// into, and a report, random source and Turn per band.
+//
+// During a step, entities that have not acted yet are in the front grid and
+// entities that have acted, including newborns, are in the back grid. Each
+// entity is moved from the front to the back when it takes its turn, so by
+// the end of the step the front grid is empty and the two are swapped.
+// Land never moves, so it is kept in both grids.
+type World struct {
+	front         Grid
+	back          Grid
+	neighbourhood Neighbourhood
+	shape         [2]int      // kind and radius the neighbourhood was built from
+	offsets       [2][][2]int // neighbour offsets for even and odd rows
+	boundary      Boundary
+	rules         *Rules
+	web           []SpeciesConfig       // food web the rules were built from, if any
+	species       [numCellTypes]Species // copied from rules, indexed by CellType
+	diets         [numCellTypes]CellSet
+	bands         [][2]int
+	reports       []StepReport
+	sources       []RandSource
+	turns         []Turn
+	work          func(band, startRow, endRow int)
+
+	// Maps of the environment stretched over the grid, or nil without them
+	env        *Environment // environment the maps were built from
+	nutrients  []float32    // nutrient left in each cell
+	capacity   []float32
+	regrowth   float32
+	breedScale []float32 // breed time of each cell over the configured one
+	currentX   []float32
+	currentY   []float32
+
+	// Parameters of the step in progress, read by updateBand
+	cfg   Config
+	step  int
+	trace bool
+}
+
+/**
+ * @brief Creates a world that updates the given grid.
+ *
+ * The world takes ownership of the grid, which must not be changed by the
+ * caller afterwards.
+ *
+ * @param grid The starting state of the world.
+ * @return The new world.
+ */
+func NewWorld(grid Grid) *World {
+	w := &World{
+		front: grid,
+		back:  NewGrid(grid.Rows, grid.Cols),
+	}
+	for i, cellType := range grid.Types {
+		if cellType == Land {
+			w.back.Types[i] = Land
+		}
+	}
+	w.work = w.updateBand
+	return w
+}
+
+/**
+ * @brief Builds the species tables, neighbourhood and bands needed to update
+ *        with a configuration, unless they are already built.
+ *
+ * Only the first step, and any step that changes the rules, the
+ * environment or the neighbourhood, allocates anything.
+ *
+ * @param cfg The simulation parameters of the next step.
+ */
+func (w *World) prepare(cfg Config) {
+	w.boundary = cfg.Boundary
+	if cfg.Environment != w.env {
+		w.setEnvironment(cfg.Environment)
+	}
+	rules := cfg.Rules
+	if rules == nil && len(cfg.FoodWeb) > 0 && len(w.web) == len(cfg.FoodWeb) && &w.web[0] == &cfg.FoodWeb[0] {
+		// Still the same web, so its rules need not be built again
+		rules = w.rules
+	}
+	if rules == nil {
+		rules, w.web = cfg.rules(), cfg.FoodWeb
+	}
+	if rules != w.rules {
+		w.rules = rules
+		w.species = [numCellTypes]Species{}
+		copy(w.species[:], rules.species)
+		w.diets = rules.diets()
+	}
+
+	shape := [2]int{int(cfg.Neighbourhood), cfg.Radius}
+	if w.neighbourhood != nil && shape == w.shape {
+		return
+	}
+
+	neighbourhood, err := NewNeighbourhood(cfg.Neighbourhood, cfg.Radius)
+	if err != nil {
+		// Configurations are validated before a world is built from them
+		panic(err)
+	}
+	w.neighbourhood = neighbourhood
+	w.shape = shape
+	for parity := range w.offsets {
+		// Copied out so the update loop does not call through the interface
+		w.offsets[parity] = make([][2]int, neighbourhood.Size())
+		for i := range w.offsets[parity] {
+			dx, dy := neighbourhood.Offset(parity, i)
+			w.offsets[parity][i] = [2]int{dx, dy}
+		}
+	}
+	w.bands = partitionBands(w.front.Rows, neighbourhood.Reach())
+	w.reports = make([]StepReport, len(w.bands))
+	w.sources = make([]RandSource, len(w.bands))
+	w.turns = make([]Turn, len(w.bands))
+	for band := range w.turns {
+		w.turns[band] = Turn{w: w, report: &w.reports[band]}
+	}
+}
+
+/**
+ * @brief Stretches the maps of an environment over the grid.
+ *
+ * Every cell starts with as much nutrient as it can hold.
+ *
+ * @param env The environment, or nil for a uniform ocean.
+ */
+func (w *World) setEnvironment(env *Environment) {
+	w.env = env
+	w.nutrients, w.capacity, w.breedScale, w.currentX, w.currentY = nil, nil, nil, nil, nil
+	if env == nil {
+		return
+	}
+
+	rows, cols := w.front.Rows, w.front.Cols
+	if env.Nutrients != nil {
+		w.capacity = env.Nutrients.resample(rows, cols)
+		w.nutrients = slices.Clone(w.capacity)
+		w.regrowth = float32(env.NutrientRegrowth)
+	}
+	if env.Temperature != nil {
+		w.breedScale = env.Temperature.resample(rows, cols)
+		for i, temperature := range w.breedScale {
+			// Breeding twice as fast for every 10 °C warmer
+			w.breedScale[i] = float32(math.Exp2((referenceTemperature - float64(temperature)) / 10))
+		}
+	}
+	if env.CurrentX != nil && env.CurrentY != nil {
+		w.currentX = env.CurrentX.resample(rows, cols)
+		w.currentY = env.CurrentY.resample(rows, cols)
+	}
+}
+
+/**
+ * @brief Returns the nutrient left in a cell.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return The nutrient, and false if the world has no nutrient map.
+ */
+func (w *World) Nutrient(x, y int) (float32, bool) {
+	if w.nutrients == nil {
+		return 0, false
+	}
+	return w.nutrients[w.front.Index(x, y)], true
+}
+
+/**
+ * @brief Lets the nutrient of a run of cells grow back towards capacity.
+ *
+ * @param start The index of the first cell.
+ * @param end The index after the last cell.
+ */
+func (w *World) regrow(start, end int) {
+	for i := start; i < end; i++ {
+		w.nutrients[i] = min(w.nutrients[i]+w.regrowth, w.capacity[i])
+	}
+}
+
+/**
+ * @brief Creates a turn for the entity in one cell, outside of a step.
+ *
+ * @param cfg The simulation parameters.
+ * @param x The row of the entity.
+ * @param y The column of the entity.
+ * @param rng The random source the entity draws from.
+ * @param report Where the events of the turn are recorded.
+ * @return The turn.
+ */
+func (w *World) turn(cfg Config, x, y int, rng RandSource, report *StepReport) Turn {
+	if w.neighbourhood == nil {
+		w.prepare(cfg)
+	}
+	t := Turn{Config: cfg, Rand: rng, w: w, report: report}
+	t.begin(x, y, w.front.Types[w.front.Index(x, y)])
+	return t
+}
+
+/**
+ * @brief Returns the current state of the world.
+ *
+ * The grid shares storage with the world, so it is only valid until the
+ * next step and must not be changed; use Grid.Clone to keep a copy.
+ *
+ * @return The current grid.
+ */
+func (w *World) Grid() Grid {
+	return w.front
+}
+
+/**
+ * @brief Returns the entity in a cell, whichever buffer it is in.
+ *
+ * Between steps every entity is in the front grid, but this also finds
+ * entities that have already acted part way through a step.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return The entity in the cell, or an Entity of type Empty if there is none.
+ */
+func (w *World) At(x, y int) Entity {
+	if e := w.front.At(x, y); e.Type != Empty {
+		return e
+	}
+	return w.back.At(x, y)
+}
+
+/**
+ * @brief Returns the random source for a band, reseeded for a new step.
+ *
+ * Sources are created on first use and reused after that, so the kind of
+ * source is fixed by the configuration of the first step.
+ *
+ * @param cfg The simulation parameters.
+ * @param band The index of the band.
+ * @param seed The seed of the band's stream for this step.
+ * @return The seeded source.
+ */
+func (w *World) source(cfg Config, band int, seed int64) RandSource {
+	if w.sources[band] == nil {
+		w.sources[band] = newSource(cfg, seed)
+	} else {
+		w.sources[band].Seed(seed)
+	}
+	return w.sources[band]
+}
+
+/**
+ * @brief Makes the back grid the current state once a step is complete.
+ */
+func (w *World) swap() {
+	w.front, w.back = w.back, w.front
+}
+
+/**
+ * @brief Finds a neighbour of a cell, applying the boundary.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @param i The index of the neighbour in the neighbourhood.
+ * @return The row and column of the neighbour, and false if it lies
+ *         beyond a wall.
+ */
+func (w *World) neighbour(x, y, i int) (nx, ny int, ok bool) {
+	offset := w.offsets[x&1][i]
+	if nx, ok = w.boundary.resolve(x+offset[0], w.front.Rows); !ok {
+		return 0, 0, false
+	}
+	ny, ok = w.boundary.resolve(y+offset[1], w.front.Cols)
+	return nx, ny, ok
+}
+
+/**
+ * @brief Reports whether a cell is what an entity is looking for.
+ *
+ * A cell never holds an entity in both grids at once, so the type of
+ * whichever one it holds, or Empty, is the two types or'ed together.
+ *
+ * @param i The index of the cell.
+ * @param set The cell types being looked for.
+ * @return true if the cell's entity, counting either grid, is in the set,
+ *         or the cell is empty in both and the set holds Empty.
+ */
+func (w *World) matches(i int, set *CellSet) bool {
+	return set.Has(w.front.Types[i] | w.back.Types[i])
+}
+
+/**
+ * @brief Counts the neighbours of a cell that hold one of a set of types.
+ *
+ * A neighbour reached through more than one offset, which can happen on
+ * small or reflective grids, is counted once for each.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @param set The cell types to count.
+ * @return The number of matching neighbours.
+ */
+func (w *World) countNeighbours(x, y int, set *CellSet) int {
+	count := 0
+	for i := range w.offsets[x&1] {
+		if nx, ny, ok := w.neighbour(x, y, i); ok && w.matches(w.front.Index(nx, ny), set) {
+			count++
+		}
+	}
+	return count
+}
+
+/**
+ * @brief Returns one of the neighbours counted by countNeighbours.
+ *
+ * Choosing by position in the neighbourhood, rather than collecting the
+ * matching neighbours into a list first, means no memory is needed however
+ * large the neighbourhood is.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @param set The cell types to choose among.
+ * @param k Which matching neighbour to return, counting from zero.
+ * @return The row and column of the chosen neighbour.
+ */
+func (w *World) chooseNeighbour(x, y int, set *CellSet, k int) [2]int {
+	for i := range w.offsets[x&1] {
+		if nx, ny, ok := w.neighbour(x, y, i); ok && w.matches(w.front.Index(nx, ny), set) {
+			if k == 0 {
+				return [2]int{nx, ny}
+			}
+			k--
+		}
+	}
+	panic("chooseNeighbour: fewer matching neighbours than counted")
+}
+
+/**
+ * @brief Chooses a random neighbour among those counted by countNeighbours,
+ *        favouring those the current flows towards.
+ *
+ * Each neighbour is weighted by one plus the part of the cell's current
+ * along the direction to it, so a neighbour straight against a current of
+ * length one is never chosen. When every weight is zero the choice is even.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @param set The cell types to choose among.
+ * @param count The number of matching neighbours, at least one.
+ * @param rng The random source to draw from.
+ * @return The row and column of the chosen neighbour.
+ */
+func (w *World) chooseWithCurrent(x, y int, set *CellSet, count int, rng RandSource) [2]int {
+	cell := w.front.Index(x, y)
+	total := 0
+	for i := range w.offsets[x&1] {
+		if nx, ny, ok := w.neighbour(x, y, i); ok && w.matches(w.front.Index(nx, ny), set) {
+			total += w.currentWeight(cell, w.offsets[x&1][i])
+		}
+	}
+	if total == 0 {
+		return w.chooseNeighbour(x, y, set, rng.Intn(count))
+	}
+
+	k := rng.Intn(total)
+	for i := range w.offsets[x&1] {
+		if nx, ny, ok := w.neighbour(x, y, i); ok && w.matches(w.front.Index(nx, ny), set) {
+			if k -= w.currentWeight(cell, w.offsets[x&1][i]); k < 0 {
+				return [2]int{nx, ny}
+			}
+		}
+	}
+	panic("chooseWithCurrent: weights changed while choosing")
+}
+
+/**
+ * @brief Weighs a move by how far it goes with the current.
+ *
+ * @param cell The index of the cell being left.
+ * @param offset The row and column offset of the move.
+ * @return The weight of the move, scaled to an integer.
+ */
+func (w *World) currentWeight(cell int, offset [2]int) int {
+	dx, dy := float64(offset[0]), float64(offset[1])
+	along := (float64(w.currentX[cell])*dx + float64(w.currentY[cell])*dy) / math.Hypot(dx, dy)
+	return int(max(0, 1+along)*currentWeightScale + 0.5)
+}
@@ -0,0 +1,204 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"slices"
+)
+
+// WorldMap is the starting layout of a grid: which cells are land and which
+// hold the first fish and sharks. Land stays where it is for the whole run,
+// so coastlines and islands can be modelled instead of an open ocean.
+type WorldMap struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+	// Cells holds Empty, Land or the type of a species for every cell, in
+	// row-major order
+	Cells []CellType `json:"cells"`
+}
+
+// mapPalette is the colour of each kind of cell in a map image. Pixels are
+// matched to the nearest colour, so maps saved with lossy compression or
+// painted by hand still load.
+var mapPalette = []struct {
+	colour   color.RGBA
+	cellType CellType
+}{
+	{color.RGBA{0, 0, 0, 255}, Empty},
+	{color.RGBA{0, 0, 255, 255}, Empty},
+	{color.RGBA{194, 178, 128, 255}, Land},
+	{color.RGBA{255, 255, 255, 255}, Land},
+	{color.RGBA{0, 255, 0, 255}, Fish},
+	{color.RGBA{255, 0, 0, 255}, Shark},
+}
+
+/**
+ * @brief Loads a world map from a PNG, JPEG or GIF image.
+ *
+ * Each pixel is one cell. Black or blue pixels are open water, sand
+ * coloured (#c2b280) or white pixels are land, green pixels are fish and
+ * red pixels are sharks; other colours count as the nearest of these.
+ *
+ * @param path The image to read.
+ * @return The map, or an error if the image cannot be read or decoded.
+ */
+func LoadWorldMap(path string) (*WorldMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	bounds := img.Bounds()
+	m := &WorldMap{Rows: bounds.Dy(), Cols: bounds.Dx(), Cells: make([]CellType, 0, bounds.Dx()*bounds.Dy())}
+	if !gridSizeInRange(m.Rows, m.Cols) {
+		return nil, fmt.Errorf("%s: map size %dx%d is out of range", path, m.Cols, m.Rows)
+	}
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			m.Cells = append(m.Cells, nearestMapCell(img.At(px, py)))
+		}
+	}
+	return m, nil
+}
+
+/**
+ * @brief Makes a world map of the layout of a grid.
+ *
+ * The map holds the land and the type of every entity of the grid, such as
+ * the grid of a snapshot, so a new run can start from the same layout with
+ * newborn entities. Counters are not kept; start with Config.StartFrom to
+ * keep them, or restore the snapshot to carry on a run.
+ *
+ * @param grid The grid to copy the layout of.
+ * @return The map, of the same size as the grid.
+ */
+func WorldMapFromGrid(grid Grid) *WorldMap {
+	return &WorldMap{Rows: grid.Rows, Cols: grid.Cols, Cells: slices.Clone(grid.Types)}
+}
+
+/**
+ * @brief Finds the kind of cell a pixel of a map image stands for.
+ *
+ * @param c The colour of the pixel.
+ * @return The cell type of the nearest colour in mapPalette.
+ */
+func nearestMapCell(c color.Color) CellType {
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	best, bestDistance := Empty, -1
+	for _, entry := range mapPalette {
+		dr := int(rgba.R) - int(entry.colour.R)
+		dg := int(rgba.G) - int(entry.colour.G)
+		db := int(rgba.B) - int(entry.colour.B)
+		if distance := dr*dr + dg*dg + db*db; bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = entry.cellType, distance
+		}
+	}
+	return best
+}
+
+/**
+ * @brief Checks that a map fits a configuration.
+ *
+ * @param c The configuration the map belongs to.
+ * @return An error for each problem found.
+ */
+func (m *WorldMap) validate(c Config) []error {
+	var errs []error
+	if m.Rows != c.GridHeight || m.Cols != c.GridWidth {
+		errs = append(errs, fmt.Errorf("world map is %dx%d, but the grid is %dx%d", m.Cols, m.Rows, c.GridWidth, c.GridHeight))
+	}
+	if len(m.Cells) != m.Rows*m.Cols {
+		errs = append(errs, fmt.Errorf("world map holds %d cells, want %d for %dx%d", len(m.Cells), m.Rows*m.Cols, m.Cols, m.Rows))
+	}
+	rules := c.rules()
+	for i, cellType := range m.Cells {
+		if cellType != Empty && cellType != Land && rules.Species(cellType) == nil {
+			errs = append(errs, fmt.Errorf("world map cell (%d, %d) has type %d, which is not water, land or a species",
+				i/max(m.Cols, 1), i%max(m.Cols, 1), cellType))
+			break
+		}
+	}
+	return errs
+}
+
+/**
+ * @brief Counts the cells of the map that are not open water.
+ *
+ * @return The number of land cells and the number of cells holding an entity.
+ */
+func (m *WorldMap) count() (land, entities int) {
+	for _, cellType := range m.Cells {
+		switch cellType {
+		case Empty:
+		case Land:
+			land++
+		default:
+			entities++
+		}
+	}
+	return land, entities
+}
+
+/**
+ * @brief Returns what the map puts in a cell.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return Land, the type of a species, or Empty for open water and for
+ *         cells outside the map.
+ */
+func (m *WorldMap) cell(x, y int) CellType {
+	i := x*m.Cols + y
+	if x < 0 || x >= m.Rows || y < 0 || y >= m.Cols || i >= len(m.Cells) {
+		return Empty
+	}
+	return m.Cells[i]
+}
+
+/**
+ * @brief Reports whether a cell of the map is land.
+ *
+ * @param x The row of the cell.
+ * @param y The column of the cell.
+ * @return true if the cell is inside the map and is land.
+ */
+func (m *WorldMap) isLand(x, y int) bool {
+	return m.cell(x, y) == Land
+}
+
+/**
+ * @brief Puts the land and the entities of the map into an empty grid.
+ *
+ * Each entity starts with the counters given by its species' Newborn
+ * method, as those placed by PlaceEntities do.
+ *
+ * @param cfg The simulation parameters.
+ * @param grid The grid, of the same size as the map.
+ * @return nil on success, or an error if the map does not fit the grid.
+ */
+func (m *WorldMap) place(cfg Config, grid Grid) error {
+	if m.Rows != grid.Rows || m.Cols != grid.Cols || len(m.Cells) != len(grid.Types) {
+		return errors.New("world map does not match the grid")
+	}
+	rules := cfg.rules()
+	for i, cellType := range m.Cells {
+		switch cellType {
+		case Empty:
+		case Land:
+			grid.put(i, Land, 0, 0, 0, 0)
+		default:
+			e := rules.Species(cellType).Newborn(cfg)
+			grid.put(i, cellType, int32(e.BreedCounter), int32(e.StarveCounter), int32(e.Energy), 0)
+		}
+	}
+	return nil
+}
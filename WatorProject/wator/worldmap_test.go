@@ -0,0 +1,187 @@
+// Wator simulation project by Seán Rourke, C00251168
+package Wator
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// islandMap returns a map of the given size with a block of land in the
+// middle, a fish in the top left corner and a shark in the bottom right
+func islandMap(rows, cols int) *WorldMap {
+	m := &WorldMap{Rows: rows, Cols: cols, Cells: make([]CellType, rows*cols)}
+	for x := rows / 3; x < 2*rows/3; x++ {
+		for y := cols / 3; y < 2*cols/3; y++ {
+			m.Cells[x*cols+y] = Land
+		}
+	}
+	m.Cells[0] = Fish
+	m.Cells[rows*cols-1] = Shark
+	return m
+}
+
+func TestLoadWorldMap(t *testing.T) {
+	colours := []color.RGBA{
+		{0, 0, 0, 255}, {10, 20, 240, 255}, {200, 180, 120, 255},
+		{250, 250, 250, 255}, {20, 230, 30, 255}, {240, 10, 10, 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, len(colours), 1))
+	for i, c := range colours {
+		img.SetRGBA(i, 0, c)
+	}
+	path := filepath.Join(t.TempDir(), "map.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	m, err := LoadWorldMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CellType{Empty, Empty, Land, Land, Fish, Shark}
+	if m.Rows != 1 || m.Cols != len(colours) || !slices.Equal(m.Cells, want) {
+		t.Errorf("loaded %+v, want cells %v", m, want)
+	}
+}
+
+func TestInitialiseGridLaysDownMap(t *testing.T) {
+	cfg := testConfig(9)
+	cfg.InitialFishCount, cfg.InitialSharkCount = 20, 5
+	cfg.Map = islandMap(9, 9)
+
+	grid, err := InitialiseGrid(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, cellType := range cfg.Map.Cells {
+		if cellType == Land && grid.Types[i] != Land {
+			t.Fatalf("cell %d should be land, holds type %d", i, grid.Types[i])
+		}
+	}
+	if e := grid.At(8, 8); e.Type != Shark || e.StarveCounter != cfg.SharkStarveTime {
+		t.Errorf("the mapped shark is %+v, want a newborn shark", e)
+	}
+	if fish, sharks := CountEntities(grid); fish != 21 || sharks != 6 {
+		t.Errorf("grid holds %d fish and %d sharks, want the mapped ones and the initial counts", fish, sharks)
+	}
+}
+
+func TestNoEntityEntersLand(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.GridWidth, cfg.GridHeight = 30, 30
+	cfg.Map = islandMap(30, 30)
+	cfg.Seed = 4
+	sim, err := NewSimulation(cfg, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for step := 0; step < 50; step++ {
+		fishBefore, sharksBefore := CountEntities(sim.world.Grid())
+		report := sim.Trace()
+		fishAfter, sharksAfter := CountEntities(sim.world.Grid())
+		if err := report.Check(fishBefore, sharksBefore, fishAfter, sharksAfter); err != nil {
+			t.Fatalf("step %d: %v", step, err)
+		}
+		for i, cellType := range cfg.Map.Cells {
+			if (cellType == Land) != (sim.world.Grid().Types[i] == Land) {
+				t.Fatalf("step %d: cell %d holds type %d, the map says %d", step, i, sim.world.Grid().Types[i], cellType)
+			}
+		}
+	}
+}
+
+func TestGetNeighboursLeavesOutLand(t *testing.T) {
+	cfg := testConfig(5)
+	cfg.Map = &WorldMap{Rows: 5, Cols: 5, Cells: make([]CellType, 25)}
+	cfg.Map.Cells[2*5+3] = Land
+
+	got := GetNeighbours(nil, cfg, 2, 2)
+	want := [][2]int{{2, 1}, {1, 2}, {3, 2}}
+	if !slices.Equal(got, want) {
+		t.Errorf("GetNeighbours(2, 2) beside land = %v, want %v", got, want)
+	}
+}
+
+func TestWorldMapValidation(t *testing.T) {
+	cfg := testConfig(5)
+	cfg.Map = islandMap(4, 5)
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "world map is 5x4") {
+		t.Errorf("a map of the wrong size gave %v", err)
+	}
+
+	cfg.Map = islandMap(5, 5)
+	cfg.InitialFishCount = 24
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "water cells") {
+		t.Errorf("more entities than water gave %v", err)
+	}
+	if got, want := cfg.WaterCells(), 25-4; got != want {
+		t.Errorf("WaterCells() = %d, want %d", got, want)
+	}
+}
+
+func TestSnapshotKeepsWorldMap(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.GridWidth, cfg.GridHeight = 24, 12
+	cfg.InitialFishCount, cfg.InitialSharkCount = 50, 8
+	cfg.Map = islandMap(12, 24)
+	cfg.Seed = 21
+	sim, err := NewSimulation(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.StepN(6)
+
+	formats := map[string]struct {
+		write func(*bytes.Buffer, Snapshot) error
+		read  func(*bytes.Buffer) (Snapshot, error)
+	}{
+		"json": {
+			func(b *bytes.Buffer, s Snapshot) error { return WriteSnapshotJSON(b, s) },
+			func(b *bytes.Buffer) (Snapshot, error) { return ReadSnapshotJSON(b) },
+		},
+		"binary": {
+			func(b *bytes.Buffer, s Snapshot) error { return WriteSnapshotBinary(b, s) },
+			func(b *bytes.Buffer) (Snapshot, error) { return ReadSnapshotBinary(b) },
+		},
+	}
+	for name, format := range formats {
+		var buf bytes.Buffer
+		if err := format.write(&buf, sim.Snapshot()); err != nil {
+			t.Fatalf("%s: write: %v", name, err)
+		}
+		snap, err := format.read(&buf)
+		if err != nil {
+			t.Fatalf("%s: read: %v", name, err)
+		}
+		if snap.Config.Map == nil || !slices.Equal(snap.Config.Map.Cells, cfg.Map.Cells) {
+			t.Fatalf("%s: world map lost in the round trip", name)
+		}
+
+		original, _ := NewSimulationFromSnapshot(sim.Snapshot(), 1)
+		resumed, err := NewSimulationFromSnapshot(snap, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		original.StepN(5)
+		resumed.StepN(5)
+		if !original.Grid().Equal(resumed.Grid()) {
+			t.Errorf("%s: resumed run with land diverged from the original", name)
+		}
+		if err := resumed.Reset(3); err != nil || resumed.Grid().Types[cfg.Map.Rows/2*cfg.Map.Cols+cfg.Map.Cols/2] != Land {
+			t.Errorf("%s: reset lost the land of the map (%v)", name, err)
+		}
+	}
+}